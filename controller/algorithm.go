@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Algorithms returns the algorithm types runs can be created for.
+func Algorithms(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "Algorithms API called.")
+
+	util.JSONResponse(res, http.StatusOK, "Algorithms", map[string]any{"types": modules.GeneratorTypes()})
+}
+
+// CreateRun creates and queues a run of the algorithm type in the path.
+func CreateRun(res http.ResponseWriter, req *http.Request) {
+	createRun(res, req, req.PathValue("type"))
+}
+
+// CreateRunOf returns a handler that creates runs of runType, for the
+// per-type routes.
+func CreateRunOf(runType string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		createRun(res, req, runType)
+	}
+}
+
+func createRun(res http.ResponseWriter, req *http.Request, runType string) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, fmt.Sprintf("CreateRun API called for %s.", runType))
+
+	// Comment this out to test the API without authentication.
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	if !slices.Contains(modules.GeneratorTypes(), runType) {
+		util.JSONResponse(res, http.StatusNotFound, fmt.Sprintf("unknown algorithm type %q", runType), nil)
+		return
+	}
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	run, err := modules.RunFromJSON(runType, data)
+	if err != nil {
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	// Check user-supplied Python against the code policy before enqueuing.
+	policy, err := modules.CodePolicy(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	check := modules.CheckCode(policy, run.Snippets)
+	if err := check.Err(); err != nil {
+		if err := check.Record(req.Context(), "", user["id"], runType, logger); err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	template, err := modules.ActiveTemplate(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	runID, err := run.Create(req.Context(), user["id"], check, template, logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("RunID: %s", runID))
+
+	data["runID"] = runID
+	data["seed"] = run.Seed
+	if ref := template.Ref(); ref != nil {
+		data["template"] = ref
+	}
+	util.JSONResponse(res, http.StatusOK, "It works! 👍🏻", data)
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+)
+
+// CreateExperiment creates one child run per point of a parameter sweep,
+// grouped under an experiment.
+func CreateExperiment(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "CreateExperiment API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	experiment, err := modules.ExperimentReqFromJSON(data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	runs, err := experiment.Runs()
+	if err != nil {
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	// Every run has the snippets of the base config.
+	policy, err := modules.CodePolicy(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	check := modules.CheckCode(policy, runs[0].Snippets)
+	if err := check.Err(); err != nil {
+		if err := check.Record(req.Context(), "", user["id"], experiment.Type, logger); err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	template, err := modules.ActiveTemplate(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	experimentID, runIDs, err := experiment.Create(req.Context(), runs, user["id"], check, template, logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("ExperimentID: %s", experimentID))
+
+	util.JSONResponse(res, http.StatusOK, "Experiment created", map[string]any{"experimentID": experimentID, "runIDs": runIDs})
+}
+
+// UserExperiment returns the progress of an experiment and the best
+// fitness of each of its runs.
+func UserExperiment(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "UserExperiment API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	experiment, err := modules.ExperimentDataReqFromJSON(data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("Experiment: %s", experiment.ExperimentID))
+
+	summary, err := experiment.Summary(req.Context(), user["id"], logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	util.JSONResponse(res, http.StatusOK, "User experiment", summary)
+}
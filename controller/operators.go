@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+)
+
+// Operators lists the crossover and mutation operators
+// and their parameters, for building config forms.
+func Operators(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "Operators API called.")
+
+	if req.Method != "GET" {
+		util.JSONResponse(res, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", req.Method), nil)
+		return
+	}
+
+	util.JSONResponse(res, http.StatusOK, "Operators", modules.OperatorCatalog)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CodePolicy returns the policy for user-supplied Python on GET, and
+// replaces it on POST. Only admins can see or change it.
+func CodePolicy(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "CodePolicy API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	if !strings.EqualFold(user["role"], "admin") {
+		util.JSONResponse(res, http.StatusForbidden, "admin role required", nil)
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		policy, err := modules.CodePolicy(req.Context(), logger)
+		if err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.JSONResponse(res, http.StatusOK, "Code policy", policy)
+
+	case "POST":
+		data, err := util.Body(req)
+		if err != nil {
+			util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		policy, err := modules.CodePolicyFromJSON(data)
+		if err != nil {
+			util.ValidationResponse(res, err)
+			return
+		}
+
+		if err := modules.SetCodePolicy(req.Context(), *policy, user["id"], logger); err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.JSONResponse(res, http.StatusOK, "Code policy updated", policy)
+
+	default:
+		util.JSONResponse(res, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", req.Method), nil)
+	}
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// PreviewRun validates a request for a run of the algorithm type in the
+// path and returns the code it would run.
+func PreviewRun(res http.ResponseWriter, req *http.Request) {
+	preview(res, req, req.PathValue("type"))
+}
+
+// PreviewRunOf returns a handler that previews runs of runType, for the
+// per-type routes.
+func PreviewRunOf(runType string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		preview(res, req, runType)
+	}
+}
+
+// preview validates a request and returns the code it would run, without
+// creating a run, uploading files or enqueuing a job. Python snippets are
+// checked against the code policy and reported as warnings. The code is
+// rendered with the active template.
+func preview(res http.ResponseWriter, req *http.Request, runType string) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, fmt.Sprintf("Preview API called for %s.", runType))
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	if !slices.Contains(modules.GeneratorTypes(), runType) {
+		util.JSONResponse(res, http.StatusNotFound, fmt.Sprintf("unknown algorithm type %q", runType), nil)
+		return
+	}
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	g, err := modules.NewGenerator(runType, data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	p, err := g.Preview()
+	if err != nil {
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	if snippets := g.Snippets(); snippets != nil {
+		policy, err := modules.CodePolicy(req.Context(), logger)
+		if err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		p.CheckCode(policy, snippets)
+	}
+
+	template, err := modules.ActiveTemplate(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	p.UseTemplate(template)
+
+	util.JSONResponse(res, http.StatusOK, "Preview", p)
+}
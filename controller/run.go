@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"evolve/modules"
 	"evolve/util"
 	"fmt"
@@ -97,3 +98,49 @@ func ShareRun(res http.ResponseWriter, req *http.Request) {
 
 	util.JSONResponse(res, http.StatusOK, "Run shared.", nil)
 }
+
+func ResumeRun(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "ResumeRun API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	resume, err := modules.ResumeRunReqFromJSON(data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("Run: %s", resume.RunID))
+
+	runID, err := resume.Resume(req.Context(), user["id"], logger)
+	switch {
+	case errors.Is(err, modules.ErrRunNotFound):
+		util.JSONResponse(res, http.StatusNotFound, err.Error(), nil)
+		return
+	case errors.Is(err, modules.ErrRunReadOnly):
+		util.JSONResponse(res, http.StatusForbidden, err.Error(), nil)
+		return
+	case errors.Is(err, modules.ErrNoCheckpoint):
+		util.JSONResponse(res, http.StatusConflict, err.Error(), nil)
+		return
+	case err != nil:
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	util.JSONResponse(res, http.StatusOK, "Run resumed", map[string]string{"runID": runID, "resumedFrom": resume.RunID})
+}
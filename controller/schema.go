@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+)
+
+// Schemas returns the JSON Schema of the config of every algorithm type,
+// for building and checking config forms.
+func Schemas(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "Schemas API called.")
+
+	if req.Method != "GET" {
+		util.JSONResponse(res, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", req.Method), nil)
+		return
+	}
+
+	schemas := map[string]*modules.Schema{}
+	for _, runType := range modules.GeneratorTypes() {
+		schemas[runType], _ = modules.GeneratorSchema(runType)
+	}
+	util.JSONResponse(res, http.StatusOK, "Schemas", schemas)
+}
+
+// AlgorithmSchema returns the JSON Schema of the config of the algorithm
+// type in the path.
+func AlgorithmSchema(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "AlgorithmSchema API called.")
+
+	if req.Method != "GET" {
+		util.JSONResponse(res, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", req.Method), nil)
+		return
+	}
+
+	runType := req.PathValue("type")
+	schema, ok := modules.GeneratorSchema(runType)
+	if !ok {
+		util.JSONResponse(res, http.StatusNotFound, fmt.Sprintf("unknown algorithm type %q", runType), nil)
+		return
+	}
+	util.JSONResponse(res, http.StatusOK, "Schema", schema)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CodeTemplates returns every version of every code template and the
+// active one on GET, and saves the next version of a template on POST.
+// Only admins can see or change them.
+func CodeTemplates(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "CodeTemplates API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	if !strings.EqualFold(user["role"], "admin") {
+		util.JSONResponse(res, http.StatusForbidden, "admin role required", nil)
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		templates, err := modules.CodeTemplates(req.Context(), logger)
+		if err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		active, err := modules.ActiveTemplate(req.Context(), logger)
+		if err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.JSONResponse(res, http.StatusOK, "Code templates", map[string]any{"templates": templates, "active": active.Ref()})
+
+	case "POST":
+		data, err := util.Body(req)
+		if err != nil {
+			util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		template, err := modules.CodeTemplateFromJSON(data)
+		if err != nil {
+			util.ValidationResponse(res, err)
+			return
+		}
+
+		if err := template.Save(req.Context(), user["id"], logger); err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.JSONResponse(res, http.StatusOK, "Code template saved", template)
+
+	default:
+		util.JSONResponse(res, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", req.Method), nil)
+	}
+}
+
+// ActiveTemplate returns the template new runs are generated with on GET,
+// and activates a template version, or none, on POST. Only admins can see
+// or change it.
+func ActiveTemplate(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "ActiveTemplate API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	if !strings.EqualFold(user["role"], "admin") {
+		util.JSONResponse(res, http.StatusForbidden, "admin role required", nil)
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		template, err := modules.ActiveTemplate(req.Context(), logger)
+		if err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.JSONResponse(res, http.StatusOK, "Active code template", template)
+
+	case "POST":
+		data, err := util.Body(req)
+		if err != nil {
+			util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		ref, err := modules.TemplateRefFromJSON(data)
+		if err != nil {
+			util.ValidationResponse(res, err)
+			return
+		}
+
+		template, err := modules.SetActiveTemplate(req.Context(), *ref, user["id"], logger)
+		var verr *util.ValidationError
+		if errors.As(err, &verr) {
+			util.ValidationResponse(res, err)
+			return
+		}
+		if err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.JSONResponse(res, http.StatusOK, "Active code template updated", template)
+
+	default:
+		util.JSONResponse(res, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", req.Method), nil)
+	}
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"evolve/modules"
+	"evolve/util"
+	"fmt"
+	"net/http"
+)
+
+// CreateTrials creates a trial group of runs of one config with distinct
+// seeds.
+func CreateTrials(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "CreateTrials API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	trials, err := modules.TrialReqFromJSON(data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	runs, err := trials.Runs()
+	if err != nil {
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	// Every run has the snippets of the config.
+	policy, err := modules.CodePolicy(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	check := modules.CheckCode(policy, runs[0].Snippets)
+	if err := check.Err(); err != nil {
+		if err := check.Record(req.Context(), "", user["id"], trials.Type, logger); err != nil {
+			util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		util.ValidationResponse(res, err)
+		return
+	}
+
+	template, err := modules.ActiveTemplate(req.Context(), logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	groupID, runIDs, err := trials.Create(req.Context(), runs, user["id"], check, template, logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("GroupID: %s", groupID))
+
+	util.JSONResponse(res, http.StatusOK, "Trials created", map[string]any{"groupID": groupID, "runIDs": runIDs})
+}
+
+// TrialGroup returns the progress of a trial group and the statistics of
+// its completed runs.
+func TrialGroup(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "TrialGroup API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	group, err := modules.TrialDataReqFromJSON(data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("Trial group: %s", group.GroupID))
+
+	summary, err := group.Summary(req.Context(), user["id"], logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	util.JSONResponse(res, http.StatusOK, "Trial group", summary)
+}
+
+// CompareTrials compares the best fitness of two trial groups with the
+// Wilcoxon rank-sum test.
+func CompareTrials(res http.ResponseWriter, req *http.Request) {
+	var logger = util.SharedLogger
+	logger.InfoCtx(req, "CompareTrials API called.")
+
+	user, err := modules.Auth(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	// User has id, role, userName, email & fullName.
+	logger.InfoCtx(req, fmt.Sprintf("User: %s", user))
+
+	data, err := util.Body(req)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	compare, err := modules.TrialCompareReqFromJSON(data)
+	if err != nil {
+		util.JSONResponse(res, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	logger.InfoCtx(req, fmt.Sprintf("Trial groups: %s, %s", compare.GroupA, compare.GroupB))
+
+	comparison, err := compare.Compare(req.Context(), user["id"], logger)
+	if err != nil {
+		util.JSONResponse(res, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	util.JSONResponse(res, http.StatusOK, "Trial comparison", comparison)
+}
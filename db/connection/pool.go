@@ -5,11 +5,20 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var dbpool *pgxpool.Pool
 
+// Querier runs statements on the pool or in a transaction, so that a
+// series of inserts can be made together.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func PoolConn(ctx context.Context) (*pgxpool.Pool, error) {
 	if dbpool != nil {
 		return dbpool, nil
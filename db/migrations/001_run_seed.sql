@@ -0,0 +1,3 @@
+-- Seed used by the generated code, so a run can be reproduced.
+-- Runs created before this migration have no seed.
+ALTER TABLE run ADD COLUMN IF NOT EXISTS seed INT8;
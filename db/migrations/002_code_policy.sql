@@ -0,0 +1,20 @@
+-- Policy for user-supplied Python, set by admins. A single row; the
+-- default policy applies until one is set.
+CREATE TABLE IF NOT EXISTS code_policy (
+	id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+	policy JSONB NOT NULL,
+	updatedBy STRING NOT NULL,
+	updatedAt TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Every code policy decision. Rejected requests create no run.
+CREATE TABLE IF NOT EXISTS code_check (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	runID UUID NULL REFERENCES run (id),
+	userID STRING NOT NULL,
+	type STRING NOT NULL,
+	decision STRING NOT NULL,
+	violations JSONB NOT NULL,
+	policy JSONB NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT now()
+);
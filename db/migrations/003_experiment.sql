@@ -0,0 +1,18 @@
+-- Hyperparameter sweeps. Every point of the sweep is a child run.
+CREATE TABLE IF NOT EXISTS experiment (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name STRING NOT NULL,
+	type STRING NOT NULL,
+	config JSONB NOT NULL,
+	sweep JSONB NOT NULL,
+	createdBy STRING NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS experiment_run (
+	experimentID UUID NOT NULL REFERENCES experiment (id),
+	runID UUID NOT NULL REFERENCES run (id),
+	position INT NOT NULL,
+	point JSONB NOT NULL,
+	PRIMARY KEY (experimentID, runID)
+);
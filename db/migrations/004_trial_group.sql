@@ -0,0 +1,18 @@
+-- Repeated runs of one config with distinct seeds.
+CREATE TABLE IF NOT EXISTS trial_group (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name STRING NOT NULL,
+	type STRING NOT NULL,
+	config JSONB NOT NULL,
+	trials INT NOT NULL,
+	createdBy STRING NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS trial_run (
+	groupID UUID NOT NULL REFERENCES trial_group (id),
+	runID UUID NOT NULL REFERENCES run (id),
+	position INT NOT NULL,
+	seed INT8 NOT NULL,
+	PRIMARY KEY (groupID, runID)
+);
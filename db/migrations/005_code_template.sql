@@ -0,0 +1,28 @@
+-- Python that admins wrap every generated script in. Versions are never
+-- changed; saving a template adds its next version.
+CREATE TABLE IF NOT EXISTS code_template (
+	name STRING NOT NULL,
+	version INT NOT NULL,
+	prologue STRING NOT NULL,
+	epilogue STRING NOT NULL,
+	sections JSONB NOT NULL,
+	createdBy STRING NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT now(),
+	PRIMARY KEY (name, version)
+);
+
+-- The template new runs are generated with. A single row; runs use no
+-- template until one is activated.
+CREATE TABLE IF NOT EXISTS code_template_active (
+	id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+	name STRING NULL,
+	version INT NULL,
+	updatedBy STRING NOT NULL,
+	updatedAt TIMESTAMP NOT NULL DEFAULT now(),
+	FOREIGN KEY (name, version) REFERENCES code_template (name, version)
+);
+
+-- Template version a run was generated with. Runs generated without one,
+-- or before this migration, have neither.
+ALTER TABLE run ADD COLUMN IF NOT EXISTS templateName STRING;
+ALTER TABLE run ADD COLUMN IF NOT EXISTS templateVersion INT;
@@ -54,13 +54,32 @@ func main() {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc(routes.TEST, controller.Test)
-	mux.HandleFunc(routes.EA, controller.CreateEA)
-	mux.HandleFunc(routes.GP, controller.CreateGP)
-	mux.HandleFunc(routes.ML, controller.CreateML)
-	mux.HandleFunc(routes.PSO, controller.CreatePSO)
+	mux.HandleFunc(routes.EA, controller.CreateRunOf("ea"))
+	mux.HandleFunc(routes.GP, controller.CreateRunOf("gp"))
+	mux.HandleFunc(routes.ML, controller.CreateRunOf("ml"))
+	mux.HandleFunc(routes.PSO, controller.CreateRunOf("pso"))
+	mux.HandleFunc(routes.EA_PREVIEW, controller.PreviewRunOf("ea"))
+	mux.HandleFunc(routes.GP_PREVIEW, controller.PreviewRunOf("gp"))
+	mux.HandleFunc(routes.ML_PREVIEW, controller.PreviewRunOf("ml"))
+	mux.HandleFunc(routes.PSO_PREVIEW, controller.PreviewRunOf("pso"))
+	mux.HandleFunc(routes.ALGORITHMS, controller.Algorithms)
+	mux.HandleFunc(routes.ALGORITHM, controller.CreateRun)
+	mux.HandleFunc(routes.ALGORITHM_PREVIEW, controller.PreviewRun)
+	mux.HandleFunc(routes.SCHEMAS, controller.Schemas)
+	mux.HandleFunc(routes.SCHEMA, controller.AlgorithmSchema)
+	mux.HandleFunc(routes.OPERATORS, controller.Operators)
 	mux.HandleFunc(routes.RUNS, controller.UserRuns)
 	mux.HandleFunc(routes.SHARE_RUN, controller.ShareRun)
 	mux.HandleFunc(routes.RUN, controller.UserRun)
+	mux.HandleFunc(routes.RESUME, controller.ResumeRun)
+	mux.HandleFunc(routes.POLICY, controller.CodePolicy)
+	mux.HandleFunc(routes.TEMPLATES, controller.CodeTemplates)
+	mux.HandleFunc(routes.ACTIVE_TEMPLATE, controller.ActiveTemplate)
+	mux.HandleFunc(routes.EXPERIMENTS, controller.CreateExperiment)
+	mux.HandleFunc(routes.EXPERIMENT, controller.UserExperiment)
+	mux.HandleFunc(routes.TRIALS, controller.CreateTrials)
+	mux.HandleFunc(routes.TRIAL_GROUP, controller.TrialGroup)
+	mux.HandleFunc(routes.TRIAL_COMPARE, controller.CompareTrials)
 
 	sseHandler := sse.GetSSEHandler(*logger)
 	mux.HandleFunc(routes.LOGS, sseHandler)
@@ -0,0 +1,165 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Upper bounds accepted for sizes in any config.
+const (
+	maxPopulationSize = 100000
+	maxGenerations    = 100000
+	maxIndividualSize = 100000
+	maxObjectives     = 10
+	maxTreeHeight     = 90             // Python's recursion limit makes deeper trees unusable.
+	maxSeed           = math.MaxUint32 // numpy.random.seed only accepts 32-bit seeds.
+)
+
+// Benchmark functions available in deap.benchmarks.
+var benchmarkFunctions = []string{"rand", "plane", "sphere", "cigar", "rosenbrock", "h1", "ackley", "bohachevsky", "griewank", "rastrigin", "rastrigin_scaled", "rastrigin_skew", "schaffer", "schwefel", "himmelblau"}
+
+// Selection functions that can be registered with only "k" (plus tournsize
+// for selTournament).
+var selectionFunctions = []string{"selTournament", "selRoulette", "selRandom", "selBest", "selWorst", "selStochasticUniversalSampling", "selLexicase", "selAutomaticEpsilonLexicase", "selNSGA2", "selSPEA2"}
+
+// Algorithms that use mu and lambda_.
+var muLambdaAlgorithms = []string{"eaMuPlusLambda", "eaMuCommaLambda"}
+
+// validateRun checks the fields shared by every evolutionary config.
+func validateRun(v *util.ValidationError, populationSize int, generations int, cxpb float64, mutpb float64) {
+	v.IntRange("populationSize", populationSize, 1, maxPopulationSize)
+	v.IntRange("generations", generations, 1, maxGenerations)
+	v.FloatRange("cxpb", cxpb, 0, 1)
+	v.FloatRange("mutpb", mutpb, 0, 1)
+}
+
+// validateWeights checks the fitness weights, one per objective.
+func validateWeights(v *util.ValidationError, weights []float64, maxLen int) {
+	if !v.Length("weights", len(weights), 1, maxLen) {
+		return
+	}
+	for i, w := range weights {
+		v.Relation(fmt.Sprintf("weights[%d]", i), w != 0, "must not be 0")
+	}
+}
+
+// validateMuLambda checks mu and lambda_ for the Mu+Lambda and Mu,Lambda
+// algorithms. DEAP's varOr also requires cxpb + mutpb <= 1.
+func validateMuLambda(v *util.ValidationError, algorithm string, mu int, lambda int, cxpb float64, mutpb float64) {
+	if !slices.Contains(muLambdaAlgorithms, algorithm) {
+		return
+	}
+	if v.IntRange("lambda_", lambda, 1, maxPopulationSize) {
+		v.IntRange("mu", mu, 1, lambda)
+	}
+	v.Relation("mutpb", cxpb+mutpb <= 1, "cxpb + mutpb must not exceed 1")
+}
+
+// validateSelection checks a selection function and its tournament size.
+// Custom selection code is allowed to register any identifier.
+func validateSelection(v *util.ValidationError, selection string, tournamentSize int, populationSize int, custom bool) {
+	if custom {
+		if !validateIdentifier(v, "selectionFunction", selection) {
+			return
+		}
+	} else if !v.OneOf("selectionFunction", selection, selectionFunctions) {
+		return
+	}
+	if selection == "selTournament" {
+		v.IntRange("tournamentSize", tournamentSize, 1, max(populationSize, 1))
+	}
+}
+
+// resolveSeed checks a given seed, or draws one when it is omitted so that
+// every run records the seed it used.
+func resolveSeed(v *util.ValidationError, seed *int64) *int64 {
+	if seed == nil {
+		s := rand.Int64N(maxSeed + 1)
+		return &s
+	}
+	v.IntRange("seed", int(*seed), 0, maxSeed)
+	return seed
+}
+
+// seedCode seeds Python's and numpy's generators. It is placed right after
+// the imports, before anything draws a random number.
+func seedCode(seed int64) py.Stmt {
+	return py.Block{
+		py.Do(py.Call("random.seed", py.Int(seed))),
+		py.Do(py.Call("numpy.random.seed", py.Int(seed))),
+	}
+}
+
+// mainGuard runs main() when the script is run.
+var mainGuard = py.If("__name__ == '__main__'", py.Line("main()"))
+
+// scriptPath is the path of the file name next to the generated script.
+func scriptPath(name string) py.Expr {
+	return py.Call("os.path.join", py.Raw("os.path.dirname(os.path.abspath(__file__))"), py.Str(name))
+}
+
+// validateHof checks that the hall of fame holds at least the best individual.
+func validateHof(v *util.ValidationError, hofSize int, populationSize int) {
+	v.IntRange("hofSize", hofSize, 1, max(populationSize, 1))
+}
+
+// runSchema describes the fields validateRun checks, and the seed.
+func runSchema(s *Schema) {
+	s.at("populationSize").between(1, maxPopulationSize).describe("Individuals in the population.")
+	s.at("generations").between(1, maxGenerations).describe("Generations to run, the upper bound of any termination rule.")
+	s.at("cxpb").between(0, 1).describe("Probability of mating two individuals.")
+	s.at("mutpb").between(0, 1).describe("Probability of mutating an individual.")
+	s.require("populationSize", "generations")
+	seedSchema(s)
+}
+
+func seedSchema(s *Schema) {
+	s.at("seed").between(0, maxSeed).describe("Seed for random and numpy.random, drawn when omitted.")
+}
+
+// weightsSchema describes the fitness weights validateWeights checks.
+func weightsSchema(s *Schema, maxLen int) {
+	s.at("weights").count(1, maxLen).describe("Fitness weight of each objective, negative to minimise and positive to maximise. None may be 0.")
+	s.require("weights")
+}
+
+// muLambdaSchema requires mu and lambda_ for the Mu+Lambda and Mu,Lambda
+// algorithms, like validateMuLambda.
+func muLambdaSchema(s *Schema) {
+	s.at("mu").describe("Individuals selected for the next generation, at most lambda_. Only for eaMuPlusLambda and eaMuCommaLambda.")
+	s.at("lambda_").describe("Children produced each generation. Only for eaMuPlusLambda and eaMuCommaLambda.")
+	s.when(propertyIn("algorithm", muLambdaAlgorithms...), object(map[string]*Schema{
+		"mu":      new(Schema).atLeast(1),
+		"lambda_": new(Schema).between(1, maxPopulationSize),
+	}, "mu", "lambda_"))
+}
+
+// selectionSchema describes the selection function of configs matching
+// applies, like validateSelection. With custom, customSelection may
+// register any name.
+func selectionSchema(s *Schema, applies *Schema, custom bool) {
+	s.at("selectionFunction").describe("DEAP selection function.")
+	s.at("tournamentSize").describe("Individuals in each tournament of selTournament, at most populationSize.")
+
+	known := applies
+	if custom {
+		known = all(applies, unset("customSelection"))
+	}
+	s.when(known, object(map[string]*Schema{"selectionFunction": new(Schema).enum(selectionFunctions)}, "selectionFunction"))
+	s.when(all(applies, propertyIn("selectionFunction", "selTournament")), object(map[string]*Schema{"tournamentSize": new(Schema).atLeast(1)}, "tournamentSize"))
+}
+
+// hofSchema describes the hall of fame validateHof checks.
+func hofSchema(s *Schema) {
+	s.at("hofSize").atLeast(1).describe("Best individuals kept in the hall of fame, at most populationSize.")
+	s.require("hofSize")
+}
+
+// orEmpty lists values and "", which picks the default.
+func orEmpty(values []string) []string {
+	return append([]string{""}, values...)
+}
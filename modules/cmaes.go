@@ -0,0 +1,215 @@
+package modules
+
+import (
+	"encoding/json"
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+)
+
+// Centroid is the CMA-ES starting point. It is given either as a scalar,
+// repeated for every dimension, or as a full vector.
+type Centroid []float64
+
+func (c *Centroid) UnmarshalJSON(data []byte) error {
+	var scalar float64
+	if err := json.Unmarshal(data, &scalar); err == nil {
+		*c = Centroid{scalar}
+		return nil
+	}
+
+	var vector []float64
+	if err := json.Unmarshal(data, &vector); err != nil {
+		return fmt.Errorf("centroid must be a number or a list of numbers")
+	}
+	*c = vector
+	return nil
+}
+
+func (Centroid) jsonSchema() *Schema {
+	return &Schema{Type: schemaTypes{"number", "array"}, Items: &Schema{Type: schemaTypes{"number"}}}
+}
+
+// CMAES configures the eaGenerateUpdate (CMA-ES) algorithm.
+type CMAES struct {
+	Centroid    Centroid `json:"centroid,omitempty"`
+	Sigma       float64  `json:"sigma,omitempty"`
+	Lambda      int      `json:"lambda_,omitempty"`     // Offspring per generation, 0 uses 4 + 3 ln(N).
+	Restarts    string   `json:"restarts,omitempty"`    // "", "ipop" or "bipop".
+	MaxRestarts int      `json:"maxRestarts,omitempty"` // Restarts allowed within the generation budget.
+	IncPopSize  float64  `json:"incPopSize,omitempty"`  // Population growth factor per large restart.
+	TolFun      float64  `json:"tolFun,omitempty"`      // Restart when best fitness stalls within this range.
+	TolX        float64  `json:"tolX,omitempty"`        // Restart when the step size falls below this.
+}
+
+// Defaults for the IPOP/BIPOP restart rules (Hansen, 2009).
+const (
+	defaultCMAMaxRestarts = 9
+	defaultCMAIncPopSize  = 2
+	defaultCMATolFun      = 1e-12
+	defaultCMATolX        = 1e-12
+)
+
+// applyDefaults fills unset fields. centroid and sigma are the defaults of
+// the calling generator.
+func (c *CMAES) applyDefaults(centroid float64, sigma float64) {
+	if len(c.Centroid) == 0 {
+		c.Centroid = Centroid{centroid}
+	}
+	if c.Sigma == 0 {
+		c.Sigma = sigma
+	}
+	if c.Restarts == "" {
+		return
+	}
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = defaultCMAMaxRestarts
+	}
+	if c.IncPopSize == 0 {
+		c.IncPopSize = defaultCMAIncPopSize
+	}
+	if c.TolFun == 0 {
+		c.TolFun = defaultCMATolFun
+	}
+	if c.TolX == 0 {
+		c.TolX = defaultCMATolX
+	}
+}
+
+// validate checks the strategy. dims is the problem dimension, or 0 when it
+// is only known at runtime.
+func (c *CMAES) validate(v *util.ValidationError, dims int) {
+	if dims > 0 && len(c.Centroid) > 1 {
+		v.Length("cma.centroid", len(c.Centroid), dims, dims)
+	}
+	v.FloatRange("cma.sigma", c.Sigma, 1e-12, 1e12)
+	if c.Lambda != 0 {
+		v.IntRange("cma.lambda_", c.Lambda, 2, maxPopulationSize)
+	}
+	if c.Restarts == "" {
+		return
+	}
+	v.OneOf("cma.restarts", c.Restarts, []string{"ipop", "bipop"})
+	v.IntRange("cma.maxRestarts", c.MaxRestarts, 1, 100)
+	v.FloatRange("cma.incPopSize", c.IncPopSize, 1.1, 10)
+	v.FloatRange("cma.tolFun", c.TolFun, 0, 1e12)
+	v.FloatRange("cma.tolX", c.TolX, 0, 1e12)
+}
+
+// cmaSchema describes the strategy validate checks. Unset fields are 0 and
+// take their defaults.
+func cmaSchema(s *Schema) {
+	c := s.at("cma").describe("CMA-ES strategy. Only for eaGenerateUpdate.")
+	c.at("centroid").describe("Starting point, a number repeated for every dimension or one per dimension.")
+	c.at("sigma").between(0, 1e12).describe("Initial step size.")
+	c.at("lambda_").between(0, maxPopulationSize).describe("Offspring per generation, at least 2. 0 uses 4 + 3 ln(N).")
+	c.at("restarts").enum(orEmpty([]string{"ipop", "bipop"})).describe("Restart strategy, none when empty.")
+	c.at("maxRestarts").between(0, 100).withDefault(defaultCMAMaxRestarts).describe("Restarts allowed within the generation budget.")
+	c.at("incPopSize").between(0, 10).withDefault(defaultCMAIncPopSize).describe("Population growth factor per large restart, at least 1.1.")
+	c.at("tolFun").between(0, 1e12).withDefault(defaultCMATolFun).describe("Restart when the best fitness stalls within this range.")
+	c.at("tolX").between(0, 1e12).withDefault(defaultCMATolX).describe("Restart when the step size falls below this.")
+}
+
+// centroidExpr renders the centroid for dims dimensions, where dims is a
+// Python expression.
+func (c *CMAES) centroidExpr(dims string) py.Expr {
+	if len(c.Centroid) == 1 {
+		return py.Rawf("[%s] * %s", py.Float(c.Centroid[0]), dims)
+	}
+	return py.List(py.Floats(c.Centroid)...)
+}
+
+// callAlgo runs the strategy for the generations budget shared by all restarts.
+// With stop set it passes the Termination object stop.
+func (c *CMAES) callAlgo(centroid py.Expr, stats string, stop bool) py.Stmt {
+	restarts := py.None
+	if c.Restarts != "" {
+		restarts = py.Str(c.Restarts)
+	}
+	termination := py.None
+	if stop {
+		termination = py.Raw("stop")
+	}
+	return py.Assign("pop, logbook", py.Call("run_cma", centroid).
+		Kw("sigma", py.Float(c.Sigma)).
+		Kw("lambda_", py.Int(c.Lambda)).
+		Kw("ngen", py.Raw("generations")).
+		Kw("stats", py.Raw(stats)).
+		Kw("halloffame", py.Raw("hof")).
+		Kw("restarts", restarts).
+		Kw("max_restarts", py.Int(c.MaxRestarts)).
+		Kw("inc_popsize", py.Float(c.IncPopSize)).
+		Kw("tolfun", py.Float(c.TolFun)).
+		Kw("tolx", py.Float(c.TolX)).
+		Kw("stop", termination))
+}
+
+// runFunction is the CMA-ES loop with optional IPOP/BIPOP restarts. Without
+// restarts it behaves like algorithms.eaGenerateUpdate.
+func (c *CMAES) runFunction() py.Stmt {
+	return py.Source(`
+		def run_cma(centroid, sigma, lambda_, ngen, stats, halloffame, restarts=None, max_restarts=0, inc_popsize=2, tolfun=1e-12, tolx=1e-12, stop=None):
+			logbook = tools.Logbook()
+			logbook.header = ['gen', 'restart', 'lambda_', 'evals'] + (stats.fields if stats else [])
+			N = len(centroid)
+			default_lambda = lambda_ or int(4 + 3 * math.log(N))
+			gen, restart, large_runs = 0, 0, 0
+			large_evals, small_evals = 0, 0
+			population = []
+			while True:
+				# BIPOP runs a small-population regime whenever it has used fewer evaluations than the large one.
+				if restarts == 'bipop' and restart > 0 and small_evals < large_evals:
+					regime = 'small'
+					lambda_r = max(2, int(default_lambda * (0.5 * inc_popsize ** large_runs) ** (random.random() ** 2)))
+					sigma_r = sigma * 10 ** (-2 * random.random())
+				else:
+					regime = 'large'
+					lambda_r = int(default_lambda * inc_popsize ** large_runs)
+					sigma_r = sigma
+				strategy = cma.Strategy(centroid=centroid, sigma=sigma_r, lambda_=lambda_r)
+				toolbox.register('generate', strategy.generate, creator.Individual)
+				toolbox.register('update', strategy.update)
+				tolhist = 10 + int(math.ceil(30.0 * N / lambda_r))
+				history = []
+				reason = 'generations'
+				while gen < ngen:
+					gen += 1
+					population = toolbox.generate()
+					fitnesses = toolbox.map(toolbox.evaluate, population)
+					for ind, fit in zip(population, fitnesses):
+						ind.fitness.values = fit
+					if halloffame is not None:
+						halloffame.update(population)
+					# update() sorts the population, best first.
+					toolbox.update(population)
+					record = stats.compile(population) if stats else {}
+					logbook.record(gen=gen, restart=restart, lambda_=lambda_r, evals=len(population), **record)
+					print(logbook.stream)
+					emit_metrics(gen, len(population), population, halloffame[0] if halloffame else None)
+					if regime == 'large':
+						large_evals += len(population)
+					else:
+						small_evals += len(population)
+					if stop and stop.update(gen, population, len(population)):
+						break
+					if not restarts:
+						continue
+					history.append(population[0].fitness.values[0])
+					if len(history) >= tolhist and max(history[-tolhist:]) - min(history[-tolhist:]) < tolfun:
+						reason = 'tolfun'
+						break
+					if strategy.sigma * max(strategy.diagD) < tolx:
+						reason = 'tolx'
+						break
+					if strategy.cond > 1e14:
+						reason = 'conditioncov'
+						break
+				if not restarts or gen >= ngen or restart >= max_restarts or (stop and stop.reason):
+					break
+				if regime == 'large':
+					large_runs += 1
+				restart += 1
+				print(f'CMA-ES restart {restart} after {reason} (generation {gen})')
+			return population, logbook
+	`)
+}
@@ -0,0 +1,179 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evolve/db/connection"
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Decisions recorded for a CodeCheck.
+const (
+	CodeAllowed  = "allowed"
+	CodeRejected = "rejected"
+)
+
+// CodeCheck is the result of checking the Python snippets of a request
+// against the code policy. It is recorded with the run, or on its own when
+// the request is rejected.
+type CodeCheck struct {
+	Decision   string                    `json:"decision"`
+	Violations map[string][]py.Violation `json:"violations,omitempty"` // By request field.
+	policy     py.Policy
+}
+
+// CodePolicy returns the policy set by an admin, or py.DefaultPolicy if
+// none has been set.
+func CodePolicy(ctx context.Context, logger *util.LoggerService) (py.Policy, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodePolicy: %s", err.Error()), err)
+		return py.Policy{}, fmt.Errorf("something went wrong")
+	}
+
+	var policyJSON []byte
+	err = db.QueryRow(ctx, "SELECT policy FROM code_policy WHERE id = 1").Scan(&policyJSON)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return py.DefaultPolicy(), nil
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodePolicy.row.Scan: %s", err.Error()), err)
+		return py.Policy{}, fmt.Errorf("something went wrong")
+	}
+
+	var policy py.Policy
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		logger.Error(fmt.Sprintf("CodePolicy.json.Unmarshal: %s", err.Error()), err)
+		return py.Policy{}, fmt.Errorf("something went wrong")
+	}
+	return policy, nil
+}
+
+// SetCodePolicy replaces the code policy. The caller must be an admin.
+func SetCodePolicy(ctx context.Context, policy py.Policy, userID string, logger *util.LoggerService) error {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("SetCodePolicy: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		logger.Error(fmt.Sprintf("SetCodePolicy.json.Marshal: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+
+	_, err = db.Exec(ctx, `
+		UPSERT INTO code_policy (id, policy, updatedBy, updatedAt)
+		VALUES (1, $1, $2, now())
+	`, policyJSON, userID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("SetCodePolicy.db.Exec: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+	return nil
+}
+
+// CodePolicyFromJSON reads a policy sent by an admin.
+func CodePolicyFromJSON(jsonData map[string]any) (*py.Policy, error) {
+	p := &py.Policy{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, p); err != nil {
+		return nil, err
+	}
+
+	v := &util.ValidationError{}
+	p.Validate(v)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CheckCode checks snippets, keyed by request field, against policy.
+// Empty snippets are skipped.
+func CheckCode(policy py.Policy, snippets map[string]string) *CodeCheck {
+	c := &CodeCheck{Decision: CodeAllowed, Violations: map[string][]py.Violation{}, policy: policy}
+	for field, src := range snippets {
+		if src == "" {
+			continue
+		}
+		if violations := policy.Check(src); len(violations) > 0 {
+			c.Violations[field] = violations
+			c.Decision = CodeRejected
+		}
+	}
+	return c
+}
+
+// Err returns the violations as a ValidationError, or nil if the code was
+// allowed.
+func (c *CodeCheck) Err() error {
+	if c.Decision == CodeAllowed {
+		return nil
+	}
+	v := &util.ValidationError{}
+	for _, field := range slices.Sorted(maps.Keys(c.Violations)) {
+		for _, violation := range c.Violations[field] {
+			v.Add(util.FieldError{
+				Field:   field,
+				Rule:    util.RulePolicy,
+				Message: fmt.Sprintf("line %d, column %d: %s", violation.Line, violation.Column, violation.Message),
+				Line:    violation.Line,
+				Column:  violation.Column,
+			})
+		}
+	}
+	return v.Err()
+}
+
+// Record stores the decision, the violations and the policy they were
+// checked against. runID is empty for rejected requests, which create no
+// run.
+func (c *CodeCheck) Record(ctx context.Context, runID string, userID string, runType string, logger *util.LoggerService) error {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeCheck.Record: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+	return c.record(ctx, db, runID, userID, runType, logger)
+}
+
+// record is Record on db, which may be the transaction that inserts runID.
+func (c *CodeCheck) record(ctx context.Context, db connection.Querier, runID string, userID string, runType string, logger *util.LoggerService) error {
+	violationsJSON, err := json.Marshal(c.Violations)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeCheck.Record.json.Marshal: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+	policyJSON, err := json.Marshal(c.policy)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeCheck.Record.json.Marshal: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+
+	var run *string
+	if runID != "" {
+		run = &runID
+	}
+	_, err = db.Exec(ctx, `
+		INSERT INTO code_check (runID, userID, type, decision, violations, policy)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, run, userID, runType, c.Decision, violationsJSON, policyJSON)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeCheck.Record.db.Exec: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+	return nil
+}
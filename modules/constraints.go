@@ -0,0 +1,229 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"strings"
+)
+
+// Constraints turns an EA run into a constrained optimisation. The user
+// code defines feasible(individual), and optionally distance(individual) and
+// closest_valid(individual); the penalty decorates the evaluation. Repair
+// keeps floating-point offspring inside RandomRange.
+type Constraints struct {
+	Feasibility  string  `json:"feasibility,omitempty"`  // Defines feasible(individual) -> bool.
+	Distance     string  `json:"distance,omitempty"`     // Defines distance(individual) -> float, the constraint violation.
+	ClosestValid string  `json:"closestValid,omitempty"` // Defines closest_valid(individual), for the closestValid penalty.
+	Penalty      string  `json:"penalty,omitempty"`      // "delta", "closestValid", "static" or "dynamic".
+	Delta        float64 `json:"delta,omitempty"`        // delta: fitness of infeasible individuals.
+	Alpha        float64 `json:"alpha,omitempty"`        // closestValid: distance weight; dynamic: exponent.
+	Coefficient  float64 `json:"coefficient,omitempty"`  // static and dynamic: penalty per unit of distance.
+	Repair       string  `json:"repair,omitempty"`       // "clip", "reflect" or "reinit".
+}
+
+var (
+	penaltyStrategies = []string{"delta", "closestValid", "static", "dynamic"}
+	repairStrategies  = []string{"clip", "reflect", "reinit"}
+)
+
+// Dynamic penalty defaults, (C t)^alpha as in Joines and Houck (1994).
+const (
+	defaultDynamicCoefficient = 0.5
+	defaultDynamicAlpha       = 2
+)
+
+func (c *Constraints) validate(v *util.ValidationError, ea *EA) {
+	if c.Penalty == "" && c.Repair == "" {
+		v.Relation("constraints", false, "must set penalty or repair")
+		return
+	}
+
+	if c.Penalty != "" && v.OneOf("constraints.penalty", c.Penalty, penaltyStrategies) {
+		definesFunction(v, "constraints.feasibility", c.Feasibility, "feasible")
+		switch c.Penalty {
+		case "delta":
+			v.FloatRange("constraints.delta", c.Delta, -1e12, 1e12)
+			if c.Distance != "" {
+				definesFunction(v, "constraints.distance", c.Distance, "distance")
+			}
+		case "closestValid":
+			definesFunction(v, "constraints.closestValid", c.ClosestValid, "closest_valid")
+			if c.Distance != "" {
+				definesFunction(v, "constraints.distance", c.Distance, "distance")
+			}
+			v.FloatRange("constraints.alpha", c.Alpha, 0, 1e12)
+		case "static":
+			definesFunction(v, "constraints.distance", c.Distance, "distance")
+			v.FloatRange("constraints.coefficient", c.Coefficient, 1e-12, 1e12)
+		case "dynamic":
+			if c.Coefficient == 0 {
+				c.Coefficient = defaultDynamicCoefficient
+			}
+			if c.Alpha == 0 {
+				c.Alpha = defaultDynamicAlpha
+			}
+			definesFunction(v, "constraints.distance", c.Distance, "distance")
+			v.FloatRange("constraints.coefficient", c.Coefficient, 1e-12, 1e12)
+			v.FloatRange("constraints.alpha", c.Alpha, 1e-12, 10)
+		}
+	}
+
+	if c.Repair != "" && v.OneOf("constraints.repair", c.Repair, repairStrategies) {
+		v.Relation("individual", strings.ToLower(ea.Individual) == "floatingpoint", "must be floatingPoint for bounds repair")
+		v.Relation("algorithm", ea.Algorithm != "eaGenerateUpdate", "bounds repair is not supported for eaGenerateUpdate")
+	}
+}
+
+// constraintsSchema describes the penalties and repair validate checks.
+func constraintsSchema(s *Schema) {
+	c := s.at("constraints").describe("Penalties for infeasible individuals and bounds repair. Set penalty, repair or both.")
+	c.at("feasibility").describe("Python code defining feasible(individual), which returns whether it is valid.")
+	c.at("distance").describe("Python code defining distance(individual), the constraint violation.")
+	c.at("closestValid").describe("Python code defining closest_valid(individual), for the closestValid penalty.")
+	c.at("penalty").enum(orEmpty(penaltyStrategies)).describe("Fitness penalty for infeasible individuals, none when empty.")
+	c.at("delta").describe("delta: fitness of infeasible individuals.")
+	c.at("alpha").describe("closestValid: distance weight. dynamic: exponent.")
+	c.at("coefficient").describe("static and dynamic: penalty per unit of distance.")
+	c.at("repair").enum(orEmpty(repairStrategies)).describe("Keeps floatingPoint offspring inside randomRange, no repair when empty.")
+
+	code := new(Schema).nonEmpty()
+	c.when(propertyIn("penalty", penaltyStrategies...), object(map[string]*Schema{"feasibility": code}, "feasibility"))
+	c.when(propertyIn("penalty", "delta"), object(map[string]*Schema{"delta": new(Schema).between(-1e12, 1e12)}))
+	c.when(propertyIn("penalty", "closestValid"), object(map[string]*Schema{"closestValid": code, "alpha": new(Schema).between(0, 1e12)}, "closestValid"))
+	c.when(propertyIn("penalty", "static"), object(map[string]*Schema{"distance": code, "coefficient": new(Schema).between(1e-12, 1e12)}, "distance", "coefficient"))
+	c.when(propertyIn("penalty", "dynamic"), object(map[string]*Schema{
+		"distance":    code,
+		"coefficient": new(Schema).between(0, 1e12).withDefault(defaultDynamicCoefficient),
+		"alpha":       new(Schema).between(0, 10).withDefault(defaultDynamicAlpha),
+	}, "distance"))
+}
+
+// definesFunction checks that code defines a Python function called name.
+func definesFunction(v *util.ValidationError, field string, code string, name string) bool {
+	if !v.Required(field, code) {
+		return false
+	}
+	return v.Relation(field, strings.Contains(code, fmt.Sprintf("def %s(", name)), fmt.Sprintf("must define %s(individual)", name))
+}
+
+// functions returns the user code, placed at module level.
+func (c *Constraints) functions() py.Stmt {
+	return py.Block{py.Source(c.Feasibility), py.Source(c.Distance), py.Source(c.ClosestValid)}
+}
+
+// penaltyWeights defines PENALTY_WEIGHTS, the fitness weights the penalties
+// are applied against.
+func penaltyWeights(weights []float64) py.Stmt {
+	return py.Assign("PENALTY_WEIGHTS", py.Tuple(py.Floats(weights)...))
+}
+
+// decorateEvaluate renders the penalty for the evaluation function. weights
+// are the fitness weights; penalties always make the fitness worse.
+func (c *Constraints) decorateEvaluate(weights []float64) py.Stmt {
+	distance := py.None
+	if c.Distance != "" {
+		distance = py.Raw("distance")
+	}
+
+	switch c.Penalty {
+	case "delta":
+		return py.Do(py.Call("toolbox.decorate", py.Str("evaluate"), py.Call("tools.DeltaPenalty", py.Raw("feasible"), py.Float(c.Delta), distance)))
+	case "closestValid":
+		// DEAP measures the distance between the valid and the original
+		// individual; the violation of the original is used instead.
+		if c.Distance != "" {
+			distance = py.Raw("lambda valid, individual: distance(individual)")
+		}
+		return py.Do(py.Call("toolbox.decorate", py.Str("evaluate"), py.Call("tools.ClosestValidPenalty", py.Raw("feasible"), py.Raw("closest_valid"), py.Float(c.Alpha), distance)))
+	case "static":
+		return py.Block{
+			penaltyWeights(weights),
+			py.Def("static_penalty(func)",
+				py.Def("wrapper(individual, *args, **kwargs)",
+					py.Assign("fitness", py.Raw("func(individual, *args, **kwargs)")),
+					py.If("feasible(individual)", py.Return(py.Raw("fitness"))),
+					py.Assign("penalty", py.Rawf("%s * distance(individual)", py.Float(c.Coefficient))),
+					py.Return(py.Raw("tuple(f - math.copysign(penalty, w) for f, w in zip(fitness, PENALTY_WEIGHTS))")),
+				),
+				py.Return(py.Raw("wrapper")),
+			),
+			py.Do(py.Call("toolbox.decorate", py.Str("evaluate"), py.Raw("static_penalty"))),
+		}
+	default:
+		return nil
+	}
+}
+
+// decorateMap renders the dynamic penalty. It needs the generation number,
+// so it wraps toolbox.map, which every algorithm calls once per generation
+// to evaluate the offspring.
+func (c *Constraints) decorateMap(weights []float64) py.Stmt {
+	if c.Penalty != "dynamic" {
+		return nil
+	}
+	return py.Block{
+		penaltyWeights(weights),
+		py.Def("dynamic_penalty(func)",
+			py.Assign("generation", py.List(py.Int(0))),
+			py.Def("wrapper(evaluate, individuals)",
+				py.Assign("individuals", py.Raw("list(individuals)")),
+				py.Assign("fitnesses", py.Raw("list(func(evaluate, individuals))")),
+				py.Line("generation[0] += 1"),
+				py.Assign("scale", py.Rawf("(%s * generation[0]) ** %s", py.Float(c.Coefficient), py.Float(c.Alpha))),
+				py.For("i, ind", "enumerate(individuals)",
+					py.If("not feasible(ind)",
+						py.Assign("penalty", py.Raw("scale * distance(ind)")),
+						py.Assign("fitnesses[i]", py.Raw("tuple(f - math.copysign(penalty, w) for f, w in zip(fitnesses[i], PENALTY_WEIGHTS))")),
+					),
+				),
+				py.Return(py.Raw("fitnesses")),
+			),
+			py.Return(py.Raw("wrapper")),
+		),
+		py.Do(py.Call("toolbox.decorate", py.Str("map"), py.Raw("dynamic_penalty"))),
+	}
+}
+
+// decorateOperators renders the bounds repair of offspring produced by mate
+// and mutate. DE operators return a single individual, DEAP's return tuples.
+func (c *Constraints) decorateOperators(low float64, up float64) py.Stmt {
+	if c.Repair == "" {
+		return nil
+	}
+
+	var fix py.Block
+	switch c.Repair {
+	case "clip":
+		fix = py.Block{
+			py.Assign("child[i]", py.Raw("min(max(child[i], LOW), UP)")),
+		}
+	case "reflect":
+		fix = py.Block{
+			py.If("child[i] < LOW", py.Assign("child[i]", py.Raw("LOW + (LOW - child[i])"))).
+				Elif("child[i] > UP", py.Assign("child[i]", py.Raw("UP - (child[i] - UP)"))),
+			py.Comment("Steps longer than the range are clipped."),
+			py.Assign("child[i]", py.Raw("min(max(child[i], LOW), UP)")),
+		}
+	case "reinit":
+		fix = py.Block{
+			py.If("child[i] < LOW or child[i] > UP", py.Assign("child[i]", py.Raw("random.uniform(LOW, UP)"))),
+		}
+	}
+
+	return py.Block{
+		py.Assign("LOW, UP", py.Rawf("%s, %s", py.Float(low), py.Float(up))),
+		py.Def("repair_bounds(func)",
+			py.Def("wrapper(*args, **kwargs)",
+				py.Assign("offspring", py.Raw("func(*args, **kwargs)")),
+				py.For("child", "(offspring if isinstance(offspring, tuple) else (offspring,))",
+					py.For("i", "range(len(child))", fix),
+				),
+				py.Return(py.Raw("offspring")),
+			),
+			py.Return(py.Raw("wrapper")),
+		),
+		py.Do(py.Call("toolbox.decorate", py.Str("mate"), py.Raw("repair_bounds"))),
+		py.Do(py.Call("toolbox.decorate", py.Str("mutate"), py.Raw("repair_bounds"))),
+	}
+}
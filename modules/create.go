@@ -0,0 +1,143 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"evolve/db/connection"
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// NewRun is a validated request with its generated code, ready to be
+// created and queued.
+type NewRun struct {
+	RunMetadata
+	Type      string
+	Command   string
+	Code      py.Module
+	Input     map[string]any    // The request, saved as input.json.
+	Artifacts []Artifact        // Other files uploaded with the run.
+	Snippets  map[string]string // User-supplied Python, for the code policy.
+}
+
+// RunFromJSON validates a request for a run of a registered type and
+// generates its code.
+func RunFromJSON(runType string, data map[string]any) (*NewRun, error) {
+	g, err := NewGenerator(runType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &NewRun{Type: runType, Input: data}
+	if r.Code, err = g.Code(); err != nil {
+		return nil, err
+	}
+	if r.Artifacts, err = g.Artifacts(); err != nil {
+		return nil, err
+	}
+	r.RunMetadata = g.Metadata()
+	r.Command = g.Command()
+	r.Snippets = g.Snippets()
+	return r, nil
+}
+
+// Create inserts the run and gives userID write access to it, records the
+// code check, renders the code with template, which may be nil, uploads the
+// code, input and artifacts to minIO and queues the run. The run records
+// the template version. It returns the ID of the run.
+func (r *NewRun) Create(ctx context.Context, userID string, check *CodeCheck, template *CodeTemplate, logger *util.LoggerService) (string, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("NewRun.Create: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	runID, err := r.insert(ctx, db, userID, check, template, logger)
+	if err != nil {
+		return "", err
+	}
+
+	if err := util.EnqueueRunRequest(ctx, runID, "code", "py"); err != nil {
+		return "", err
+	}
+	return runID, nil
+}
+
+// queueRuns queues runs that were inserted together. The runs that cannot
+// be queued would never start, so they are marked failed, and the summary
+// of their group accounts for every run.
+func queueRuns(ctx context.Context, db connection.Querier, runIDs []string, logger *util.LoggerService) error {
+	for i, runID := range runIDs {
+		if err := util.EnqueueRunRequest(ctx, runID, "code", "py"); err != nil {
+			if _, err := db.Exec(ctx, "UPDATE run SET status = $1 WHERE id = ANY($2)", RunFailed, runIDs[i:]); err != nil {
+				logger.Error(fmt.Sprintf("queueRuns.db.Exec: %s", err.Error()), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// insert is Create up to queueing the run, with the rows inserted on db.
+func (r *NewRun) insert(ctx context.Context, db connection.Querier, userID string, check *CodeCheck, template *CodeTemplate, logger *util.LoggerService) (string, error) {
+	var templateName *string
+	var templateVersion *int
+	if ref := template.Ref(); ref != nil {
+		templateName, templateVersion = &ref.Name, &ref.Version
+	}
+
+	var runID string
+	err := db.QueryRow(ctx, `
+		INSERT INTO run (name, description, type, command, createdBy, seed, templateName, templateVersion)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, r.Name, r.Description, r.Type, r.Command, userID, r.Seed, templateName, templateVersion).Scan(&runID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("NewRun.Create.row.Scan: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	_, err = db.Exec(ctx, "INSERT INTO access (runID, userID, mode) VALUES ($1, $2, $3)", runID, userID, "write")
+	if err != nil {
+		logger.Error(fmt.Sprintf("NewRun.Create.db.Exec: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	if err := check.record(ctx, db, runID, userID, r.Type, logger); err != nil {
+		return "", err
+	}
+
+	// Record the seed, drawn if it was omitted, so the run can be reproduced.
+	input := maps.Clone(r.Input)
+	input["seed"] = r.Seed
+	inputParams, err := json.Marshal(input)
+	if err != nil {
+		logger.Error(fmt.Sprintf("NewRun.Create.json.Marshal: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	files := []Artifact{{Name: "code", Extension: "py", Data: []byte(template.Render(r.Code))}, {Name: "input", Extension: "json", Data: inputParams}}
+	files = append(files, r.Artifacts...)
+
+	// Save each file, upload it to minIO and remove it from local.
+	for _, file := range files {
+		path := fmt.Sprintf("%s/%v.%s", file.Name, runID, file.Extension)
+		os.Mkdir(file.Name, 0755)
+		if err := os.WriteFile(path, file.Data, 0644); err != nil {
+			logger.Error(fmt.Sprintf("NewRun.Create.os.WriteFile: %s", err.Error()), err)
+			return "", fmt.Errorf("something went wrong")
+		}
+		if err := util.UploadFile(ctx, runID, file.Name, file.Extension); err != nil {
+			return "", err
+		}
+		if err := os.Remove(path); err != nil {
+			logger.Error(fmt.Sprintf("NewRun.Create.os.Remove: %s", err.Error()), err)
+			return "", fmt.Errorf("something went wrong")
+		}
+	}
+
+	return runID, nil
+}
@@ -0,0 +1,157 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/csv"
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DatasetFile is the table a GP run with a Dataset fits, uploaded with the
+// run: the feature columns in argument order, then the target column.
+const DatasetFile = "dataset.csv"
+
+const (
+	maxDatasetRows    = 100000
+	maxDatasetColumns = 1000
+)
+
+// Dataset is a table of samples for symbolic regression on real data. The
+// evolved function takes the feature columns as arguments and is fitted to
+// the target column. Rows are shuffled with the seed, and a share of them is
+// held out to validate the best individual.
+type Dataset struct {
+	CSV        string  `json:"csv"`        // A header row of column names, then one row of numbers per sample.
+	Target     string  `json:"target"`     // Column the evolved function predicts.
+	Validation float64 `json:"validation"` // Share of the rows held out for validation, at most 0.5.
+
+	columns []string
+	rows    [][]float64
+}
+
+// validate parses the CSV and checks it against gp. The feature columns are
+// gp.ArgNames, or every column but the target when it is empty, and there
+// must be gp.Arity of them.
+func (d *Dataset) validate(v *util.ValidationError, gp *GP) {
+	if !d.parse(v) {
+		return
+	}
+	if !v.OneOf("dataset.target", d.Target, d.columns) {
+		return
+	}
+
+	if len(gp.ArgNames) == 0 {
+		for _, column := range d.columns {
+			if column == d.Target {
+				continue
+			}
+			v.Relation("dataset.csv", isIdentifier(column), fmt.Sprintf("column %q must be a Python identifier to be an argument; list the feature columns in argNames", column))
+			gp.ArgNames = append(gp.ArgNames, column)
+		}
+	} else {
+		for i, name := range gp.ArgNames {
+			v.Relation(fmt.Sprintf("argNames[%d]", i), name != d.Target && slices.Contains(d.columns, name), "must be a feature column of dataset.csv")
+		}
+	}
+	v.Relation("arity", gp.Arity == len(gp.ArgNames), fmt.Sprintf("must be %d, the number of feature columns", len(gp.ArgNames)))
+
+	if v.FloatRange("dataset.validation", d.Validation, 0, 0.5) && d.Validation > 0 {
+		v.Relation("dataset.validation", d.validationRows() > 0, fmt.Sprintf("holds out no rows of %d", len(d.rows)))
+	}
+}
+
+// parse reads the header into columns and the samples into rows.
+func (d *Dataset) parse(v *util.ValidationError) bool {
+	records, err := csv.NewReader(strings.NewReader(d.CSV)).ReadAll()
+	if err != nil {
+		return v.Relation("dataset.csv", false, err.Error())
+	}
+	if n := len(records) - 1; n < 2 || n > maxDatasetRows {
+		return v.Relation("dataset.csv", false, fmt.Sprintf("must have between 2 and %d rows after the header, got %d", maxDatasetRows, max(n, 0)))
+	}
+
+	d.columns = records[0]
+	if n := len(d.columns); n < 2 || n > maxDatasetColumns {
+		return v.Relation("dataset.csv", false, fmt.Sprintf("must have between 2 and %d columns, got %d", maxDatasetColumns, n))
+	}
+	for i, column := range d.columns {
+		if !v.Relation("dataset.csv", !slices.Contains(d.columns[:i], column), fmt.Sprintf("column %q appears twice", column)) {
+			return false
+		}
+	}
+
+	d.rows = make([][]float64, len(records)-1)
+	for i, record := range records[1:] {
+		d.rows[i] = make([]float64, len(record))
+		for j, cell := range record {
+			value, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+			if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+				return v.Relation("dataset.csv", false, fmt.Sprintf("row %d, column %q: %q is not a finite number", i+2, d.columns[j], cell))
+			}
+			d.rows[i][j] = value
+		}
+	}
+	return true
+}
+
+// validationRows is the number of rows held out for validation.
+func (d *Dataset) validationRows() int {
+	return int(math.Round(d.Validation * float64(len(d.rows))))
+}
+
+// table is the DatasetFile of the validated d for the feature columns
+// features.
+func (d *Dataset) table(features []string) ([]byte, error) {
+	order := make([]int, 0, len(features)+1)
+	for _, name := range append(slices.Clone(features), d.Target) {
+		order = append(order, slices.Index(d.columns, name))
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	record := make([]string, len(order))
+	for i, j := range order {
+		record[i] = d.columns[j]
+	}
+	w.Write(record)
+	for _, row := range d.rows {
+		for i, j := range order {
+			record[i] = strconv.FormatFloat(row[j], 'g', -1, 64)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// load reads DatasetFile into X, the features, and y, the target, and splits
+// the indices of their rows into train and validation.
+func (d *Dataset) load() py.Stmt {
+	n := d.validationRows()
+	return py.Block{
+		py.With(py.Call("open", scriptPath(DatasetFile)).Code()+" as f",
+			py.Assign("data", py.Raw("numpy.loadtxt(f, delimiter=',', skiprows=1, ndmin=2)")),
+		),
+		py.Assign("X", py.Raw("data[:, :-1]")),
+		py.Assign("y", py.Raw("data[:, -1]")),
+		py.Comment("The seed fixes the shuffle, so every worker and rerun gets the same split."),
+		py.Assign("order", py.Raw("numpy.random.permutation(len(y))")),
+		py.Assign("validation", py.Rawf("order[:%d]", n)),
+		py.Assign("train", py.Rawf("order[%d:]", n)),
+	}
+}
+
+// datasetSchema describes dataset, which GP validates against its other
+// fields.
+func datasetSchema(s *Schema) {
+	d := s.at("dataset").describe("Table to fit instead of realFunction. The feature columns are argNames, or every column but target; arity must match their number.")
+	d.at("csv").nonEmpty().describe("CSV with a header row of column names and one row of numbers per sample.")
+	d.at("target").nonEmpty().describe("Column the evolved function predicts.")
+	d.at("validation").between(0, 0.5).describe("Share of the rows held out to validate the best individual.")
+	d.require("csv", "target")
+}
@@ -0,0 +1,237 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"strings"
+)
+
+// deStrategy describes a DE mutation strategy: the Python function
+// rendered by EA.deMutationFunction and the vectors it takes after the
+// target y. "donor" is a random vector of the population, distinct from the
+// agent and the other donors, "best" is the best of the population and
+// "current" is the agent being replaced.
+type deStrategy struct {
+	function string
+	args     []string
+}
+
+var deStrategies = map[string]deStrategy{
+	"DE/rand/1":            {function: "mutDE", args: []string{"donor", "donor", "donor"}},
+	"DE/rand/2":            {function: "mutDE_rand2", args: []string{"donor", "donor", "donor", "donor", "donor"}},
+	"DE/best/1":            {function: "mutDE_best1", args: []string{"best", "donor", "donor"}},
+	"DE/best/2":            {function: "mutDE_best2", args: []string{"best", "donor", "donor", "donor", "donor"}},
+	"DE/current-to-best/1": {function: "mutDE_current_to_best1", args: []string{"current", "best", "donor", "donor"}},
+	"DE/current-to-rand/1": {function: "mutDE_current_to_rand1", args: []string{"current", "donor", "donor", "donor"}},
+	"DE/rand-to-best/1":    {function: "mutDE_rand_to_best1", args: []string{"donor", "best", "donor", "donor"}},
+}
+
+// Self-adaptive control of F and CR. jDE (Brest et al., 2006) lets every
+// agent carry its own F and CR; SHADE (Tanabe and Fukunaga, 2013) samples
+// them around a memory of values that produced successful trials.
+var deAdaptations = []string{"jde", "shade"}
+
+const (
+	defaultSHADEMemorySize = 10
+	jdeTau                 = 0.1 // Probability of resampling F or CR.
+)
+
+func (s deStrategy) donors() int {
+	n := 0
+	for _, arg := range s.args {
+		if arg == "donor" {
+			n++
+		}
+	}
+	return n
+}
+
+// validateDE checks the DE strategy and its parameter control.
+func (ea *EA) validateDE(v *util.ValidationError) {
+	v.OneOf("crossoverFunction", ea.CrossoverFunction, deCrossoverFunctions)
+	if v.OneOf("mutationFunction", ea.MutationFunction, deMutationFunctions) {
+		// Donors are drawn from the population without the agent itself.
+		donors := deStrategies[ea.MutationFunction].donors()
+		v.Relation("populationSize", ea.PopulationSize > donors, fmt.Sprintf("must be greater than %d for %s", donors, ea.MutationFunction))
+	}
+	v.FloatRange("crossOverRate", ea.CrossOverRate, 0, 1)
+	v.FloatRange("scalingFactor", ea.ScalingFactor, 1e-6, 2)
+	v.Relation("individual", strings.ToLower(ea.Individual) != "permutation", "must not be permutation for de")
+
+	if ea.Adaptation == "" {
+		return
+	}
+	if v.OneOf("adaptation", ea.Adaptation, deAdaptations) && ea.Adaptation == "shade" {
+		if ea.MemorySize == 0 {
+			ea.MemorySize = defaultSHADEMemorySize
+		}
+		v.IntRange("memorySize", ea.MemorySize, 1, 1000)
+	}
+}
+
+// deSchema describes the DE fields validateDE checks.
+func deSchema(s *Schema) {
+	s.at("crossOverRate").describe("de: crossover rate CR. The starting value with adaptation.")
+	s.at("scalingFactor").describe("de: scaling factor F. The starting value with adaptation.")
+	s.at("adaptation").describe("de: self-adaptive control of F and CR, none when empty.")
+	s.at("memorySize").describe("de: SHADE history length.")
+	s.when(propertyIn("algorithm", "de"), object(map[string]*Schema{
+		"crossoverFunction": new(Schema).enum(deCrossoverFunctions),
+		"mutationFunction":  new(Schema).enum(deMutationFunctions),
+		"crossOverRate":     new(Schema).between(0, 1),
+		"scalingFactor":     new(Schema).between(1e-6, 2),
+		"adaptation":        new(Schema).enum(orEmpty(deAdaptations)),
+	}, "crossoverFunction", "mutationFunction", "scalingFactor"))
+	s.when(all(propertyIn("algorithm", "de"), propertyIn("adaptation", "shade")), object(map[string]*Schema{
+		"memorySize": new(Schema).between(0, 1000).withDefault(defaultSHADEMemorySize),
+	}))
+}
+
+// differentialEvolution renders the DE generation loop. The strategy decides
+// how many donors are sampled and how they are passed to toolbox.mutate.
+func (ea *EA) differentialEvolution() py.Stmt {
+	strategy := deStrategies[ea.MutationFunction]
+	args := []py.Expr{py.Raw("y")}
+	donor := 0
+	for _, arg := range strategy.args {
+		switch arg {
+		case "best":
+			args = append(args, py.Raw("best"))
+		case "current":
+			args = append(args, py.Raw("agent"))
+		default:
+			args = append(args, py.Rawf("donors[%d]", donor))
+			donor++
+		}
+	}
+
+	var stop, stopUpdate0, stopUpdate py.Stmt
+	if ea.Termination != nil {
+		stop = py.If("stop.reason", py.Line("break"))
+		stopUpdate0 = py.Line("stop.update(0, pop, len(pop))")
+		stopUpdate = py.Line("stop.update(g, pop, len(pop))")
+	}
+
+	var success, memory py.Stmt
+	switch ea.Adaptation {
+	case "jde":
+		success = py.Line("F_i[i], CR_i[i] = f, cr")
+	case "shade":
+		success = py.Block{
+			py.Line("S_F.append(f)"),
+			py.Line("S_CR.append(cr)"),
+			py.Line("S_W.append(abs(sum(z.fitness.wvalues) - sum(pop[i].fitness.wvalues)))"),
+		}
+		memory = py.Block{
+			py.If("S_F",
+				py.Assign("total", py.Raw("sum(S_W)")),
+				py.Assign("w", py.Raw("[s / total for s in S_W] if total > 0 else [1 / len(S_W)] * len(S_W)")),
+				py.Assign("M_CR[k]", py.Raw("sum(wi * c for wi, c in zip(w, S_CR))")),
+				py.Assign("M_F[k]", py.Raw("sum(wi * f * f for wi, f in zip(w, S_F)) / sum(wi * f for wi, f in zip(w, S_F))")),
+				py.Assign("k", py.Raw("(k + 1) % H")),
+			),
+			py.Blank,
+		}
+	}
+
+	var successes py.Stmt
+	if ea.Adaptation == "shade" {
+		successes = py.Line("S_F, S_CR, S_W = [], [], []")
+	}
+
+	return py.Block{
+		py.Assign("logbook", py.Raw("tools.Logbook()")),
+		py.Assign("logbook.header", py.Raw("'gen', 'evals', 'min', 'avg', 'max'")),
+		py.Assign("fitnesses", py.Raw("toolbox.map(toolbox.evaluate, pop)")),
+		py.For("ind, fit", "zip(pop, fitnesses)", py.Assign("ind.fitness.values", py.Raw("fit"))),
+		py.Line("hof.update(pop)"),
+		py.Assign("record", py.Raw("stats.compile(pop)")),
+		py.Line("logbook.record(gen=0, evals=len(pop), **record)"),
+		py.Line("print(logbook.stream)"),
+		py.Line("emit_metrics(0, len(pop), pop, hof[0])"),
+		stopUpdate0,
+		py.Blank,
+		ea.adaptationInit(),
+		py.For("g", "range(1, generations + 1)",
+			stop,
+			py.Assign("best", py.Raw("tools.selBest(pop, 1)[0]")),
+			py.Assign("children", py.List()),
+			successes,
+			py.For("i, agent", "enumerate(pop)",
+				ea.adaptationSample(),
+				py.Assign("others", py.Raw("pop[:i] + pop[i+1:]")),
+				// Distinct donors, so that no difference vector is zero.
+				py.Assign("donors", py.Rawf("[toolbox.clone(ind) for ind in random.sample(others, %d)]", strategy.donors())),
+				py.Assign("x", py.Raw("toolbox.clone(agent)")),
+				py.Assign("y", py.Raw("toolbox.clone(agent)")),
+				py.Assign("y", py.Call("toolbox.mutate", args...).Kw("f", py.Raw("f"))),
+				py.Assign("z", py.Raw("toolbox.mate(x, y, cr=cr)")),
+				py.Line("del z.fitness.values"),
+				py.Line("children.append((z, f, cr))"),
+			),
+			py.Blank,
+			py.Assign("fitnesses", py.Raw("toolbox.map(toolbox.evaluate, [z for z, _, _ in children])")),
+			py.For("i, ((z, f, cr), fit)", "enumerate(zip(children, fitnesses))",
+				py.Assign("z.fitness.values", py.Raw("fit")),
+				py.If("z.fitness > pop[i].fitness",
+					success,
+					py.Assign("pop[i]", py.Raw("z")),
+				),
+			),
+			py.Blank,
+			memory,
+			py.Line("hof.update(pop)"),
+			py.Assign("record", py.Raw("stats.compile(pop)")),
+			py.Line("logbook.record(gen=g, evals=len(pop), **record)"),
+			py.Line("print(logbook.stream)"),
+			py.Line("emit_metrics(g, len(pop), pop, hof[0])"),
+			stopUpdate,
+		),
+	}
+}
+
+// adaptationInit sets up the per-run state of the parameter control.
+func (ea *EA) adaptationInit() py.Stmt {
+	switch ea.Adaptation {
+	case "jde":
+		return py.Block{
+			py.Assign("F_i", py.Raw("[F] * len(pop)")),
+			py.Assign("CR_i", py.Raw("[CR] * len(pop)")),
+			py.Blank,
+		}
+	case "shade":
+		return py.Block{
+			py.Assign("H", py.Int(ea.MemorySize)),
+			py.Assign("M_F", py.Raw("[F] * H")),
+			py.Assign("M_CR", py.Raw("[CR] * H")),
+			py.Assign("k", py.Int(0)),
+			py.Blank,
+		}
+	default:
+		return nil
+	}
+}
+
+// adaptationSample chooses f and cr for one trial vector.
+func (ea *EA) adaptationSample() py.Stmt {
+	switch ea.Adaptation {
+	case "jde":
+		tau := py.Float(jdeTau)
+		return py.Block{
+			py.Assign("f", py.Rawf("0.1 + 0.9 * random.random() if random.random() < %s else F_i[i]", tau)),
+			py.Assign("cr", py.Rawf("random.random() if random.random() < %s else CR_i[i]", tau)),
+		}
+	case "shade":
+		// CR ~ N(M_CR, 0.1) clipped to [0, 1]; F ~ Cauchy(M_F, 0.1) resampled until positive, capped at 1.
+		return py.Block{
+			py.Assign("r", py.Raw("random.randrange(H)")),
+			py.Assign("cr", py.Raw("min(1.0, max(0.0, random.gauss(M_CR[r], 0.1)))")),
+			py.Assign("f", py.Int(0)),
+			py.While("f <= 0", py.Assign("f", py.Raw("M_F[r] + 0.1 * math.tan(math.pi * (random.random() - 0.5))"))),
+			py.Assign("f", py.Raw("min(f, 1.0)")),
+		}
+	default:
+		return py.Line("f, cr = F, CR")
+	}
+}
@@ -0,0 +1,105 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func deConfig(mutation string) map[string]any {
+	return map[string]any{
+		"algorithm":          "de",
+		"individual":         "floatingPoint",
+		"populationFunction": "initRepeat",
+		"evaluationFunction": "sphere",
+		"populationSize":     40,
+		"generations":        50,
+		"weights":            []float64{-1.0},
+		"individualSize":     5,
+		"randomRange":        []float64{-5, 5},
+		"crossoverFunction":  "cxBinomial",
+		"mutationFunction":   mutation,
+		"hofSize":            1,
+		"crossOverRate":      0.9,
+		"scalingFactor":      0.5,
+	}
+}
+
+func TestDifferentialEvolutionStrategies(t *testing.T) {
+	// arity counts the positional arguments of toolbox.mutate, the target
+	// y included; f is passed by keyword.
+	tests := []struct {
+		strategy string
+		donors   int
+		arity    int
+	}{
+		{"DE/rand/1", 3, 4},
+		{"DE/rand/2", 5, 6},
+		{"DE/best/1", 2, 4},
+		{"DE/best/2", 4, 6},
+		{"DE/current-to-best/1", 2, 5},
+		{"DE/current-to-rand/1", 3, 5},
+		{"DE/rand-to-best/1", 3, 5},
+	}
+	if len(tests) != len(deStrategies) {
+		t.Fatalf("%d strategies tested, want all %d of deStrategies", len(tests), len(deStrategies))
+	}
+
+	mutate := regexp.MustCompile(`y = toolbox\.mutate\((.*)\)`)
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			strategy, ok := deStrategies[tt.strategy]
+			if !ok {
+				t.Fatalf("%s is not in deStrategies", tt.strategy)
+			}
+			ea, err := EAFromJSON(deConfig(tt.strategy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			module, err := ea.Code()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := module.String()
+
+			sample := fmt.Sprintf("random.sample(others, %d)", tt.donors)
+			if !strings.Contains(code, sample) {
+				t.Errorf("code does not draw donors with %s", sample)
+			}
+			if strings.Contains(code, "toolbox.select(") {
+				t.Errorf("code selects donors with toolbox.select, which may repeat them")
+			}
+
+			match := mutate.FindStringSubmatch(code)
+			if match == nil {
+				t.Fatalf("code has no toolbox.mutate call")
+			}
+			args := strings.Split(match[1], ", ")
+			if args[len(args)-1] != "f=f" {
+				t.Errorf("toolbox.mutate(%s) does not pass f=f last", match[1])
+			}
+			positional := args[:len(args)-1]
+			if len(positional) != tt.arity {
+				t.Errorf("toolbox.mutate takes %d positional arguments, want %d", len(positional), tt.arity)
+			}
+			for i := range tt.donors {
+				if !strings.Contains(match[1], fmt.Sprintf("donors[%d]", i)) {
+					t.Errorf("toolbox.mutate(%s) does not use donors[%d]", match[1], i)
+				}
+			}
+			if strings.Contains(match[1], fmt.Sprintf("donors[%d]", tt.donors)) {
+				t.Errorf("toolbox.mutate(%s) uses more than %d donors", match[1], tt.donors)
+			}
+
+			// The registered function takes the same vectors, then f.
+			def := regexp.MustCompile(`def ` + strategy.function + `\((.*)\):`).FindStringSubmatch(code)
+			if def == nil {
+				t.Fatalf("code does not define %s", strategy.function)
+			}
+			if params := strings.Split(def[1], ", "); len(params) != tt.arity+1 {
+				t.Errorf("%s takes %d parameters, want %d", strategy.function, len(params), tt.arity+1)
+			}
+		})
+	}
+}
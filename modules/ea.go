@@ -2,6 +2,7 @@ package modules
 
 import (
 	"encoding/json"
+	"evolve/modules/py"
 	"evolve/util"
 	"fmt"
 	"slices"
@@ -9,33 +10,81 @@ import (
 )
 
 type EA struct {
-	Algorithm          string    `json:"algorithm"`
-	Individual         string    `json:"individual"`
-	PopulationFunction string    `json:"populationFunction"`
-	CustomPop          string    `json:"customPop,omitempty"` // NEW
-	EvaluationFunction string    `json:"evaluationFunction"`
-	CustomEval         string    `json:"customEval,omitempty"` // NEW
-	PopulationSize     int       `json:"populationSize"`
-	Generations        int       `json:"generations"`
-	Cxpb               float64   `json:"cxpb"`
-	Mutpb              float64   `json:"mutpb"`
-	Weights            []float64 `json:"weights"`
-	IndividualSize     int       `json:"individualSize"` // Number of Dimensions.
-	Indpb              float64   `json:"indpb"`
-	RandomRange        []float64 `json:"randomRange"`
-	CrossoverFunction  string    `json:"crossoverFunction"`
-	MutationFunction   string    `json:"mutationFunction"`
-	CustomMutation     string    `json:"customMutation,omitempty"` // NEW
-	SelectionFunction  string    `json:"selectionFunction"`
-	CustomSelection    string    `json:"customSelection,omitempty"` // NEW
-	TournamentSize     int       `json:"tournamentSize,omitempty"`
-	Mu                 int       `json:"mu,omitempty"`
-	Lambda             int       `json:"lambda_,omitempty"`
-	HofSize            int       `json:"hofSize,omitempty"`
+	Algorithm          string             `json:"algorithm"`
+	Individual         string             `json:"individual"`
+	PopulationFunction string             `json:"populationFunction"`
+	CustomPop          string             `json:"customPop,omitempty"` // NEW
+	EvaluationFunction string             `json:"evaluationFunction"`
+	CustomEval         string             `json:"customEval,omitempty"` // NEW
+	PopulationSize     int                `json:"populationSize"`
+	Generations        int                `json:"generations"`
+	Cxpb               float64            `json:"cxpb"`
+	Mutpb              float64            `json:"mutpb"`
+	Weights            []float64          `json:"weights"`
+	IndividualSize     int                `json:"individualSize"` // Number of Dimensions.
+	Indpb              float64            `json:"indpb"`
+	RandomRange        []float64          `json:"randomRange"`
+	CrossoverFunction  string             `json:"crossoverFunction"`
+	CrossoverParams    map[string]float64 `json:"crossoverParams,omitempty"` // Keyword arguments, see OperatorCatalog.
+	MutationFunction   string             `json:"mutationFunction"`
+	MutationParams     map[string]float64 `json:"mutationParams,omitempty"` // Keyword arguments, see OperatorCatalog.
+	CustomMutation     string             `json:"customMutation,omitempty"` // NEW
+	SelectionFunction  string             `json:"selectionFunction"`
+	CustomSelection    string             `json:"customSelection,omitempty"` // NEW
+	TournamentSize     int                `json:"tournamentSize,omitempty"`
+	Mu                 int                `json:"mu,omitempty"`
+	Lambda             int                `json:"lambda_,omitempty"`
+	HofSize            int                `json:"hofSize,omitempty"`
 
 	// Differential Evolution Params.
 	CrossOverRate float64 `json:"crossOverRate,omitempty"`
 	ScalingFactor float64 `json:"scalingFactor,omitempty"`
+	Adaptation    string  `json:"adaptation,omitempty"` // "", "jde" or "shade".
+	MemorySize    int     `json:"memorySize,omitempty"` // SHADE history length.
+
+	// Multi-objective mode; Weights holds one weight per objective.
+	MultiObjective *MultiObjective `json:"multiObjective,omitempty"`
+
+	// CMA-ES strategy for eaGenerateUpdate.
+	CMA *CMAES `json:"cma,omitempty"`
+
+	// Built-in problem instance, replaces the evaluation function.
+	Problem *Problem `json:"problem,omitempty"`
+
+	// Penalties for infeasible individuals and bounds repair.
+	Constraints *Constraints `json:"constraints,omitempty"`
+
+	// Seed for random and numpy.random, drawn when omitted.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Save a checkpoint every N generations, 0 disables checkpoints.
+	CheckpointEvery int `json:"checkpointEvery,omitempty"`
+
+	// Island model; PopulationSize is the size of each island.
+	Islands *Islands `json:"islands,omitempty"`
+
+	// Rules that end the run before Generations.
+	Termination *Termination `json:"termination,omitempty"`
+}
+
+func init() {
+	RegisterGenerator("ea", func(data map[string]any) (Generator, error) { return EAFromJSON(data) }, eaSchema())
+	normalizeRequests("ea", normalizeIndividual)
+}
+
+// normalizeIndividual spells the individual of an EA request as the schema
+// does. Validate, like earlier versions, ignores its case.
+func normalizeIndividual(data map[string]any) {
+	individual, ok := data["individual"].(string)
+	if !ok {
+		return
+	}
+	for _, name := range eaIndividualNames {
+		if strings.EqualFold(individual, name) {
+			data["individual"] = name
+			return
+		}
+	}
 }
 
 func EAFromJSON(jsonData map[string]any) (*EA, error) {
@@ -51,10 +100,18 @@ func EAFromJSON(jsonData map[string]any) (*EA, error) {
 	return ea, nil
 }
 
-func (ea *EA) validate() error {
-	if err := util.ValidateAlgorithmName(ea.Algorithm); err != nil {
-		return err
-	}
+var (
+	eaIndividuals         = []string{"binarystring", "floatingpoint", "integer", "permutation"}
+	eaIndividualNames     = []string{"binaryString", "floatingPoint", "integer", "permutation"} // eaIndividuals as spelled in requests.
+	eaEvaluationFunctions = []string{"evalOneMax", "evalProduct", "evalDifference"}
+	deCrossoverFunctions  = []string{"cxBinomial", "cxExponential"}
+	deMutationFunctions   = []string{"DE/rand/1", "DE/rand/2", "DE/best/1", "DE/best/2", "DE/current-to-best/1", "DE/current-to-rand/1", "DE/rand-to-best/1"}
+)
+
+func (ea *EA) Validate() error {
+	v := &util.ValidationError{}
+	ea.Seed = resolveSeed(v, ea.Seed)
+	v.OneOf("algorithm", ea.Algorithm, util.AlgorithmNames)
 
 	// If randomrange not given or invalid, set to default.
 	if len(ea.RandomRange) != 2 {
@@ -63,361 +120,571 @@ func (ea *EA) validate() error {
 		ea.RandomRange = []float64{1, 5}
 	}
 
-	// TODO: Validate remaining fields.
-	return nil
+	v.OneOf("individual", strings.ToLower(ea.Individual), eaIndividuals)
+	if ea.Problem != nil {
+		ea.Problem.validate(v, ea)
+	}
+	v.IntRange("individualSize", ea.IndividualSize, 1, maxIndividualSize)
+	validateRun(v, ea.PopulationSize, ea.Generations, ea.Cxpb, ea.Mutpb)
+	validateWeights(v, ea.Weights, maxObjectives)
+	v.FloatRange("indpb", ea.Indpb, 0, 1)
+
+	// A custom evaluation function must define the name it is registered under.
+	// The Pareto front replaces the hall of fame in multi-objective runs.
+	if ea.MultiObjective != nil {
+		ea.MultiObjective.validate(v, ea)
+	} else {
+		validateHof(v, ea.HofSize, ea.PopulationSize)
+		switch {
+		case ea.Problem != nil:
+			// The problem instance sets evaluationFunction.
+		case ea.CustomEval != "":
+			validateIdentifier(v, "evaluationFunction", ea.EvaluationFunction)
+		default:
+			v.OneOf("evaluationFunction", ea.EvaluationFunction, append(slices.Clone(eaEvaluationFunctions), benchmarkFunctions...))
+		}
+	}
+
+	switch ea.Algorithm {
+	case "de":
+		ea.validateDE(v)
+	case "eaGenerateUpdate":
+		// CMA-ES samples and updates its own population; no operators are used.
+		// By default it starts in the middle of randomRange.
+		if ea.CMA == nil {
+			ea.CMA = &CMAES{}
+		}
+		ea.CMA.applyDefaults((ea.RandomRange[0]+ea.RandomRange[1])/2, (ea.RandomRange[1]-ea.RandomRange[0])/4)
+		ea.CMA.validate(v, ea.IndividualSize)
+		v.Relation("individual", strings.ToLower(ea.Individual) == "floatingpoint", "must be floatingPoint for eaGenerateUpdate")
+	default:
+		ea.validateOperators(v)
+		if ea.MultiObjective == nil {
+			validateSelection(v, ea.SelectionFunction, ea.TournamentSize, ea.PopulationSize, ea.CustomSelection != "")
+		}
+	}
+
+	if ea.Constraints != nil {
+		ea.Constraints.validate(v, ea)
+	}
+
+	validateMuLambda(v, ea.Algorithm, ea.Mu, ea.Lambda, ea.Cxpb, ea.Mutpb)
+	validateCheckpoint(v, ea.CheckpointEvery, ea.Algorithm, ea.Generations)
+	if ea.Islands != nil {
+		ea.Islands.validate(v, ea.Algorithm, ea.PopulationSize, ea.Generations)
+		// The dynamic penalty counts generations by calls to toolbox.map, which runs once per island.
+		v.Relation("constraints.penalty", ea.Constraints == nil || ea.Constraints.Penalty != "dynamic", "dynamic is not supported with islands")
+	}
+	if ea.Termination != nil {
+		ea.Termination.validate(v, ea.Weights, ea.Generations)
+	}
+	return v.Err()
+}
+
+// validateOperators checks the crossover and mutation operators against
+// OperatorCatalog and fills in their default parameters.
+func (ea *EA) validateOperators(v *util.ValidationError) {
+	individual := strings.ToLower(ea.Individual)
+	defaults := map[string]float64{
+		"indpb":          ea.Indpb,
+		"randomRange[0]": ea.RandomRange[0],
+		"randomRange[1]": ea.RandomRange[1],
+	}
+
+	if v.OneOf("crossoverFunction", ea.CrossoverFunction, operatorNames(OperatorCrossover, individual)) {
+		op, _ := findOperator(OperatorCrossover, ea.CrossoverFunction)
+		ea.CrossoverParams = op.resolveParams(v, "crossoverParams", ea.CrossoverParams, defaults)
+	}
+
+	// Custom mutation code may register its own operator instead.
+	if _, ok := findOperator(OperatorMutation, ea.MutationFunction); ok || ea.CustomMutation == "" {
+		if v.OneOf("mutationFunction", ea.MutationFunction, operatorNames(OperatorMutation, individual)) {
+			op, _ := findOperator(OperatorMutation, ea.MutationFunction)
+			ea.MutationParams = op.resolveParams(v, "mutationParams", ea.MutationParams, defaults)
+		}
+	} else {
+		validateIdentifier(v, "mutationFunction", ea.MutationFunction)
+	}
+}
+
+// eaSchema describes the EA config. Checks that compare fields, such as mu
+// against lambda_, are left to Validate.
+func eaSchema() *Schema {
+	s := configSchema[EA]("Evolutionary algorithm", "A DEAP evolutionary algorithm, differential evolution (de) or CMA-ES (eaGenerateUpdate).")
+	s.at("algorithm").enum(util.AlgorithmNames).describe("Algorithm to run.")
+	s.at("individual").enum(eaIndividualNames).describe("Representation of an individual. Other spellings that differ only in case are accepted.")
+	s.at("populationFunction").describe("DEAP population initialiser, initRepeat.")
+	s.at("customPop").describe("Python code placed before the population is created.")
+	s.at("evaluationFunction").describe("Built-in evaluation function, DEAP benchmark, or the name of the function customEval defines.")
+	s.at("customEval").describe("Python code defining the evaluation function.")
+	s.at("individualSize").describe("Number of attributes of an individual, set by problem.")
+	s.at("indpb").between(0, 1).describe("Independent probability for each attribute to be exchanged or mutated.")
+	s.at("randomRange").withDefault([]float64{1, 5}).describe("Range [low, high] of initial attribute values; the default is used when it is not a valid range.")
+	s.at("crossoverFunction").describe("Crossover operator, see the operators API.")
+	s.at("crossoverParams").describe("Keyword arguments of the crossover operator.")
+	s.at("mutationFunction").describe("Mutation operator, see the operators API, or the name customMutation registers.")
+	s.at("mutationParams").describe("Keyword arguments of the mutation operator.")
+	s.at("customMutation").describe("Python code defining a mutation operator.")
+	s.at("customSelection").describe("Python code defining a selection function.")
+	s.require("algorithm", "individual")
+	runSchema(s)
+	weightsSchema(s, maxObjectives)
+
+	noProblem := null("problem")
+	s.when(noProblem, object(map[string]*Schema{"individualSize": new(Schema).between(1, maxIndividualSize)}, "individualSize"))
+	s.when(all(noProblem, null("multiObjective"), unset("customEval")), object(map[string]*Schema{
+		"evaluationFunction": new(Schema).enum(append(slices.Clone(eaEvaluationFunctions), benchmarkFunctions...)),
+	}, "evaluationFunction"))
+	s.when(all(noProblem, given("multiObjective"), unset("customEval")), object(map[string]*Schema{
+		"evaluationFunction": new(Schema).enum(append(slices.Clone(moBenchmarks2), moBenchmarksN...)),
+	}, "evaluationFunction"))
+	s.when(all(noProblem, given("customEval")), object(map[string]*Schema{"evaluationFunction": new(Schema).nonEmpty()}, "evaluationFunction"))
+
+	// The Pareto front replaces the hall of fame and the selection function.
+	s.when(null("multiObjective"), object(map[string]*Schema{"hofSize": new(Schema).atLeast(1)}, "hofSize"))
+	s.at("hofSize").describe("Best individuals kept in the hall of fame, at most populationSize. Not used with multiObjective.")
+	selectionSchema(s, all(propertyIn("algorithm", evolveAlgorithms...), null("multiObjective")), true)
+	operatorSchema(s)
+	muLambdaSchema(s)
+	deSchema(s)
+	s.when(propertyIn("algorithm", "de"), object(map[string]*Schema{"individual": new(Schema).enum(slices.DeleteFunc(slices.Clone(eaIndividualNames), func(name string) bool { return name == "permutation" }))}))
+	cmaSchema(s)
+	s.when(propertyIn("algorithm", "eaGenerateUpdate"), object(map[string]*Schema{"individual": new(Schema).enum([]string{"floatingPoint"})}))
+
+	multiObjectiveSchema(s)
+	problemSchema(s)
+	constraintsSchema(s)
+	checkpointSchema(s)
+	islandsSchema(s)
+	terminationSchema(s)
+	return s
+}
+
+// Artifacts returns instance.json when the run has a problem instance.
+func (ea *EA) Artifacts() ([]Artifact, error) {
+	if ea.Problem == nil {
+		return nil, nil
+	}
+	instance, err := ea.Problem.instance()
+	if err != nil {
+		return nil, err
+	}
+	return []Artifact{{Name: "instance", Extension: "json", Data: instance}}, nil
+}
+
+func (ea *EA) Metadata() RunMetadata {
+	description := "Evolutionary Algorithm (EA)"
+	if ea.Algorithm == "de" {
+		description = "Differential Evolution (DE)"
+	}
+	return RunMetadata{Name: fmt.Sprintf("%d-%d", ea.Generations, ea.PopulationSize), Description: description, Seed: *ea.Seed}
 }
 
-func (ea *EA) imports() string {
-	return strings.Join([]string{
-		"import random, os",
-		"from deap import base, creator, tools, algorithms",
-		"import numpy",
-		"import matplotlib.pyplot as plt",
-		"from functools import reduce",
-		"from scoop import futures",
-		"from deap import benchmarks",
-		"from itertools import chain",
-	}, "\n")
+func (ea *EA) Command() string {
+	return "python -m scoop code.py"
+}
+
+func (ea *EA) imports() py.Stmt {
+	return py.Section(SectionImports,
+		py.Import("random, os, json, math, pickle, time"),
+		py.From("deap", "base, creator, tools, algorithms, cma"),
+		py.Import("numpy"),
+		py.Import("matplotlib.pyplot as plt"),
+		py.From("functools", "reduce, partial"),
+		py.From("scoop", "futures"),
+		py.From("deap", "benchmarks"),
+		py.From("itertools", "chain"),
+	)
 }
 
 // If the function is a built-in function, return the corresponding Python code.
-// Otherwise, return the function string as is.
-func (ea *EA) evalFunction() string {
-	if slices.Contains([]string{"rand", "plane", "sphere", "cigar", "rosenbrock", "h1", "ackley", "bohachevsky", "griewank", "rastrigin", "rastrigin_scaled", "rastrigin_skew", "schaffer", "schwefel", "himmelblau"}, ea.EvaluationFunction) {
+// Otherwise, return the user's code as is.
+func (ea *EA) evalFunction() py.Stmt {
+	if ea.Problem != nil {
+		return ea.Problem.evalFunction()
+	}
+
+	if ea.MultiObjective != nil {
+		if ea.MultiObjective.registerBenchmark(ea) {
+			return nil
+		}
+		return py.Source(ea.CustomEval)
+	}
+
+	if slices.Contains(benchmarkFunctions, ea.EvaluationFunction) {
 		ea.EvaluationFunction = "benchmarks." + ea.EvaluationFunction
-		return ""
+		return nil
 	}
 
 	switch ea.EvaluationFunction {
 	case "evalOneMax":
-		return "def evalOneMax(individual):\n    return sum(individual),"
+		return py.Def("evalOneMax(individual)", py.Return(py.Tuple(py.Raw("sum(individual)"))))
 	case "evalProduct":
-		return "def evalProduct(individual):\n    return reduce(lambda x, y: x*y, individual),"
+		return py.Def("evalProduct(individual)", py.Return(py.Tuple(py.Raw("reduce(lambda x, y: x*y, individual)"))))
 	case "evalDifference":
-		return "def evalDifference(individual):\n    return reduce(lambda x, y: x-y, individual),"
+		return py.Def("evalDifference(individual)", py.Return(py.Tuple(py.Raw("reduce(lambda x, y: x-y, individual)"))))
 	default:
-		return ea.CustomEval
+		return py.Source(ea.CustomEval)
 	}
 }
 
-func (ea *EA) registerIndividual() string {
+func (ea *EA) registerIndividual() py.Stmt {
 	// TODO: Add support for string individual types with initial seed.
 	switch strings.ToLower(ea.Individual) {
+	case "permutation":
+		return py.Do(py.Call("toolbox.register", py.Str("indices"), py.Raw("random.sample"), py.Rawf("range(%d)", ea.IndividualSize), py.Int(ea.IndividualSize)))
 	case "binarystring":
-		return "toolbox.register(\"attr\", random.randint, 0, 1)\n"
+		return py.Do(py.Call("toolbox.register", py.Str("attr"), py.Raw("random.randint"), py.Int(0), py.Int(1)))
 	case "floatingpoint":
-		return fmt.Sprintf("toolbox.register(\"attr\", random.uniform, %f, %f)\n", ea.RandomRange[0], ea.RandomRange[1])
+		return py.Do(py.Call("toolbox.register", py.Str("attr"), py.Raw("random.uniform"), py.Float(ea.RandomRange[0]), py.Float(ea.RandomRange[1])))
 	case "integer":
-		return fmt.Sprintf("toolbox.register(\"attr\", random.randint, %d, %d)\n", int(ea.RandomRange[0]), int(ea.RandomRange[1]))
+		return py.Do(py.Call("toolbox.register", py.Str("attr"), py.Raw("random.randint"), py.Int(int(ea.RandomRange[0])), py.Int(int(ea.RandomRange[1]))))
 	default:
-		return ""
+		return nil
 	}
 }
 
-func (ea *EA) initialGenerator() string {
+func (ea *EA) initialGenerator() py.Stmt {
+	// Permutations are sampled whole rather than attribute by attribute.
+	individual := py.Call("toolbox.register", py.Str("individual"), py.Raw("tools.initRepeat"), py.Raw("creator.Individual"), py.Raw("toolbox.attr"), py.Int(ea.IndividualSize))
+	if strings.ToLower(ea.Individual) == "permutation" {
+		individual = py.Call("toolbox.register", py.Str("individual"), py.Raw("tools.initIterate"), py.Raw("creator.Individual"), py.Raw("toolbox.indices"))
+	}
+
 	// TODO: Add support for other generator functions.
-	switch ea.PopulationFunction {
-	case "initRepeat":
-		return fmt.Sprintf("toolbox.register(\"individual\", tools.%s, creator.Individual, toolbox.attr, %d)\n", ea.PopulationFunction, ea.IndividualSize) + fmt.Sprintf("toolbox.register(\"population\", tools.%s, list, toolbox.individual)\n", ea.PopulationFunction)
-	default:
-		return fmt.Sprintf("toolbox.register(\"individual\", tools.%s, creator.Individual, toolbox.attr, %d)\n", "initRepeat", ea.IndividualSize) + fmt.Sprintf("toolbox.register(\"population\", tools.%s, list, toolbox.individual)\n", "initRepeat")
+	return py.Block{
+		py.Do(individual),
+		py.Do(py.Call("toolbox.register", py.Str("population"), py.Raw("tools.initRepeat"), py.Raw("list"), py.Raw("toolbox.individual"))),
 	}
 }
 
-func (ea *EA) mutationFunction() string {
-	// TODO: Remove this later on.
+func (ea *EA) mutationFunction() py.Stmt {
 	if ea.Algorithm == "de" {
-		return fmt.Sprintf("toolbox.register(\"mutate\", mutDE, f=%f)\n", ea.Indpb)
+		return py.Do(py.Call("toolbox.register", py.Str("mutate"), py.Raw(deStrategies[ea.MutationFunction].function)).Kw("f", py.Raw("F")))
 	}
 
-	// TODO: Add support for more mutation functions.
-	switch ea.MutationFunction {
-	case "mutFlipBit":
-		return fmt.Sprintf("toolbox.register(\"mutate\", tools.%s, indpb=%f)\n", ea.MutationFunction, ea.Indpb)
-	case "mutShuffleIndexes":
-		return fmt.Sprintf("toolbox.register(\"mutate\", tools.%s, indpb=%f)\n", ea.MutationFunction, ea.Indpb)
-	default:
-		return ea.MutationFunction
+	if op, ok := findOperator(OperatorMutation, ea.MutationFunction); ok {
+		return op.register("mutate", ea.MutationParams)
 	}
+	// customMutation defines the operator.
+	return py.Do(py.Call("toolbox.register", py.Str("mutate"), py.Raw(ea.MutationFunction)))
 }
 
-func (ea *EA) selectionFunction() string {
+func (ea *EA) selectionFunction() py.Stmt {
 	// TODO: Add support for more selection functions.
-	switch ea.SelectionFunction {
-	case "selTournament":
-		return fmt.Sprintf("toolbox.register(\"select\", tools.%s, tournsize=%d)\n", ea.SelectionFunction, ea.TournamentSize)
-	default:
-		return fmt.Sprintf("toolbox.register(\"select\", tools.%s)\n", ea.SelectionFunction)
+	c := py.Call("toolbox.register", py.Str("select"), py.Raw("tools."+ea.SelectionFunction))
+	if ea.SelectionFunction == "selTournament" {
+		c.Kw("tournsize", py.Int(ea.TournamentSize))
 	}
+	return py.Do(c)
 }
 
-func (ea *EA) callAlgo() string {
-	switch strings.ToLower(ea.Algorithm) {
-	case "easimple":
-		return "\tpop, logbook = algorithms.eaSimple(pop, toolbox, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
-	case "eamupluslambda":
-		return fmt.Sprintf("\tmu = %d\n", ea.Mu) + fmt.Sprintf("\tlambda_ = %d\n", ea.Lambda) + "\tpop, logbook = algorithms.eaMuPlusLambda(pop, toolbox, mu=mu, lambda_=lambda_, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
-	case "eamucommalambda":
-		return fmt.Sprintf("\tmu = %d\n", ea.Mu) + fmt.Sprintf("\tlambda_ = %d\n", ea.Lambda) + "\tpop, logbook = algorithms.eaMuCommaLambda(pop, toolbox, mu=mu, lambda_=lambda_, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
-	case "eagenerateupdate":
-		return fmt.Sprintf("\tstrategy = cma.Strategy(centroid=[5.0]*%d, sigma=5.0, lambda_=20*{N})\n", ea.IndividualSize) + "\ttoolbox.register(\"generate\", strategy.generate, creator.Individual)\n" + "\ttoolbox.register(\"update\", strategy.update)\n" + "\tpop, logbook = algorithms.eaGenerateUpdate(toolbox, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
-	default:
-		return "\tpop, logbook = algorithms.eaSimple(pop, toolbox, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
+// usesEvolveLoop reports whether the run uses evolve. Unlike DEAP's
+// algorithms it prints the metrics of every generation.
+func (ea *EA) usesEvolveLoop() bool {
+	return slices.Contains(evolveAlgorithms, ea.Algorithm)
+}
+
+func (ea *EA) callAlgo() py.Stmt {
+	if ea.usesEvolveLoop() {
+		return evolveLoop{Algorithm: ea.Algorithm, Mu: ea.Mu, Lambda: ea.Lambda, Cxpb: py.Raw("cxpb"), Mutpb: py.Raw("mutpb"), Ngen: py.Raw("generations"), Stats: "stats", CheckpointEvery: ea.CheckpointEvery, Islands: ea.Islands, Stop: ea.Termination != nil}.call()
 	}
+	return ea.CMA.callAlgo(ea.CMA.centroidExpr("N"), "stats", ea.Termination != nil)
 }
 
-func (ea *EA) plots() string {
-	var plots string
-
-	// Fitness Plot.
-	plots += "\n\n"
-	plots += "\tgen = logbook.select(\"gen\")\n"
-	plots += "\tavg = logbook.select(\"avg\")\n"
-	plots += "\tmin_ = logbook.select(\"min\")\n"
-	plots += "\tmax_ = logbook.select(\"max\")\n\n"
-	plots += "\tplt.plot(gen, avg, label=\"average\")\n"
-	plots += "\tplt.plot(gen, min_, label=\"minimum\")\n"
-	plots += "\tplt.plot(gen, max_, label=\"maximum\")\n"
-	plots += "\tplt.xlabel(\"Generation\")\n"
-	plots += "\tplt.ylabel(\"Fitness\")\n"
-	plots += "\tplt.legend(loc=\"lower right\")\n"
-	plots += "\tplt.savefig(f\"{rootPath}/fitness_plot.png\", dpi=300)\n"
-	plots += "\tplt.close()\n"
-	plots += "\n\n"
-
-	// Mutation and Crossover Effect.
-	plots += "\tavg_fitness = logbook.select(\"avg\")\n"
-	plots += "\tfitness_diff = [avg_fitness[i] - avg_fitness[i-1] for i in range(1, len(avg_fitness))]\n"
-	plots += "\tplt.plot(gen[1:], fitness_diff, label=\"Fitness Change\", color=\"purple\")\n"
-	plots += "\tplt.xlabel(\"Generation\")\n"
-	plots += "\tplt.ylabel(\"Fitness Change\")\n"
-	plots += "\tplt.title(\"Effect of Mutation and Crossover on Fitness\")\n"
-	plots += "\tplt.legend()\n"
-	plots += "\tplt.savefig(f\"{rootPath}/mutation_crossover_effect.png\", dpi=300)\n"
-	plots += "\tplt.close()\n"
-	return plots
+func (ea *EA) plots() py.Stmt {
+	return py.Section(SectionPlots,
+		// Fitness Plot.
+		py.Source(`
+			gen = logbook.select("gen")
+			avg = logbook.select("avg")
+			min_ = logbook.select("min")
+			max_ = logbook.select("max")
+
+			plt.plot(gen, avg, label="average")
+			plt.plot(gen, min_, label="minimum")
+			plt.plot(gen, max_, label="maximum")
+			plt.xlabel("Generation")
+			plt.ylabel("Fitness")
+			plt.legend(loc="lower right")
+			plt.savefig(f"{rootPath}/fitness_plot.png", dpi=300)
+			plt.close()
+		`),
+		py.Blank,
+
+		// Mutation and Crossover Effect.
+		py.Source(`
+			avg_fitness = logbook.select("avg")
+			fitness_diff = [avg_fitness[i] - avg_fitness[i-1] for i in range(1, len(avg_fitness))]
+			plt.plot(gen[1:], fitness_diff, label="Fitness Change", color="purple")
+			plt.xlabel("Generation")
+			plt.ylabel("Fitness Change")
+			plt.title("Effect of Mutation and Crossover on Fitness")
+			plt.legend()
+			plt.savefig(f"{rootPath}/mutation_crossover_effect.png", dpi=300)
+			plt.close()
+		`),
+	)
 }
 
-func (ea *EA) crossoverFunction() string {
-	switch ea.CrossoverFunction {
-	case "cxUniform":
-		return fmt.Sprintf("toolbox.register(\"mate\", tools.%s, indpb=%f)\n", ea.CrossoverFunction, ea.Indpb)
-	case "cxUniformPartialyMatched":
-		return fmt.Sprintf("toolbox.register(\"mate\", tools.%s, indpb=%f)\n", ea.CrossoverFunction, ea.Indpb)
-	default:
-		return fmt.Sprintf("toolbox.register(\"mate\", tools.%s)\n", ea.CrossoverFunction)
-	}
+func (ea *EA) crossoverFunction() py.Stmt {
+	op, _ := findOperator(OperatorCrossover, ea.CrossoverFunction)
+	return op.register("mate", ea.CrossoverParams)
 }
 
-func (ea *EA) deCrossOverFunctions() string {
-	return strings.Join([]string{
-		"def cxBinomial(x, y, cr):",
-		"\tsize = len(x)",
-		"\tindex = random.randrange(size)",
-		"\tfor i in range(size):",
-		"\t\tif i == index or random.random() < cr:",
-		"\t\t\tx[i] = y[i]",
-		"\treturn x",
-		"\n",
-		"def cxExponential(x, y, cr):",
-		"\tsize = len(x)",
-		"\tindex = random.randrange(size)",
-		"\tfor i in chain(range(index, size), range(0, index)):",
-		"\t\tx[i] = y[i]",
-		"\t\tif random.random() < cr:",
-		"\t\t\tbreak",
-		"\treturn x",
-	}, "\n")
+func (ea *EA) deCrossOverFunctions() py.Stmt {
+	return py.Source(`
+		def cxBinomial(x, y, cr):
+			size = len(x)
+			index = random.randrange(size)
+			for i in range(size):
+				if i == index or random.random() < cr:
+					x[i] = y[i]
+			return x
+
+		def cxExponential(x, y, cr):
+			size = len(x)
+			index = random.randrange(size)
+			for i in chain(range(index, size), range(0, index)):
+				x[i] = y[i]
+				if random.random() < cr:
+					break
+			return x
+	`)
 }
 
-func (ea *EA) differentialEvolution() string {
-	return strings.Join([]string{
-		"\n",
-		"logbook = tools.Logbook()",
-		"logbook.header = 'gen', 'evals', 'std', 'min', 'avg', 'max'",
-		"fitnesses = toolbox.map(toolbox.evaluate, pop)",
-		"for ind, fit in zip(pop, fitnesses):",
-		"\tind.fitness.values = fit",
-		"record = stats.compile(pop)",
-		"logbook.record(gen=0, evals=len(pop), **record)",
-		"print(logbook.stream)",
-		"for g in range(1, generations):",
-		"\tchildren = []",
-		"\tfor agent in pop:",
-		"\t\ta, b, c = [toolbox.clone(ind) for ind in toolbox.select(pop, 3)]",
-		"\t\tx = toolbox.clone(agent)",
-		"\t\ty = toolbox.clone(agent)",
-		"\t\ty = toolbox.mutate(y, a, b, c)",
-		"\t\tz = toolbox.mate(x, y)",
-		"\t\tdel z.fitness.values",
-		"\t\tchildren.append(z)",
-		"\n",
-		"\tfitnesses = toolbox.map(toolbox.evaluate, children)",
-		"\tfor (i, ind), fit in zip(enumerate(children), fitnesses):",
-		"\t\tind.fitness.values = fit",
-		"\t\tif ind.fitness > pop[i].fitness:",
-		"\t\t\tpop[i] = ind",
-		"\n",
-		"\thof.update(pop)",
-		"\trecord = stats.compile(pop)",
-		"\tlogbook.record(gen=g, evals=len(pop), **record)",
-		"\tprint(logbook.stream)",
-	}, "\n\t")
+// deMutations are the Python functions of deStrategies, by function name.
+// y is the target vector the mutant is written to.
+var deMutations = map[string]string{
+	"mutDE": `
+		def mutDE(y, a, b, c, f):
+			size = len(y)
+			for i in range(len(y)):
+				y[i] = a[i] + f*(b[i]-c[i])
+			return y
+	`,
+	"mutDE_rand2": `
+		def mutDE_rand2(y, a, b, c, d, e, f):
+			size = len(y)
+			for i in range(size):
+				y[i] = a[i] + f * (b[i] - c[i]) + f * (d[i] - e[i])
+			return y
+	`,
+	"mutDE_best1": `
+		def mutDE_best1(y, best, b, c, f):
+			size = len(y)
+			for i in range(size):
+				y[i] = best[i] + f * (b[i] - c[i])
+			return y
+	`,
+	"mutDE_best2": `
+		def mutDE_best2(y, best, b, c, d, e, f):
+			size = len(y)
+			for i in range(size):
+				y[i] = best[i] + f * (b[i] - c[i]) + f * (d[i] - e[i])
+			return y
+	`,
+	"mutDE_current_to_best1": `
+		def mutDE_current_to_best1(y, x, best, b, c, f):
+			size = len(y)
+			for i in range(size):
+				y[i] = x[i] + f * (best[i] - x[i]) + f * (b[i] - c[i])
+			return y
+	`,
+	"mutDE_current_to_rand1": `
+		def mutDE_current_to_rand1(y, x, a, b, c, f):
+			size = len(y)
+			K = random.uniform(0, 1)  # Random number in [0, 1]
+			for i in range(size):
+				y[i] = x[i] + K * (a[i] - x[i]) + f * (b[i] - c[i])
+			return y
+	`,
+	"mutDE_rand_to_best1": `
+		def mutDE_rand_to_best1(y, a, best, b, c, f):
+			size = len(y)
+			for i in range(size):
+				y[i] = a[i] + f * (best[i] - a[i]) + f * (b[i] - c[i])
+			return y
+	`,
 }
 
-func (ea *EA) deMutationFunction() string {
-	switch ea.MutationFunction {
-	case "DE/rand/1":
-		return strings.Join([]string{
-			"def mutDE(y, a, b, c, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(len(y)):",
-			"\t\ty[i] = a[i] + f*(b[i]-c[i])",
-			"\treturn y",
-		}, "\n")
-	case "DE/rand/2":
-		return strings.Join([]string{
-			"def mutDE_rand2(y, a, b, c, d, e, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(size):",
-			"\t\ty[i] = a[i] + f * (b[i] - c[i]) + f * (d[i] - e[i])",
-			"\treturn y",
-		}, "\n")
-	case "DE/best/1":
-		return strings.Join([]string{
-			"def mutDE_best1(y, best, b, c, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(size):",
-			"\t\ty[i] = best[i] + f * (b[i] - c[i])",
-			"\treturn y",
-		}, "\n")
-	case "DE/best/2":
-		return strings.Join([]string{
-			"def mutDE_best2(y, best, b, c, d, e, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(size):",
-			"\t\ty[i] = best[i] + f * (b[i] - c[i]) + f * (d[i] - e[i])",
-			"\treturn y",
-		}, "\n")
-	case "DE/current-to-best/1":
-		return strings.Join([]string{
-			"def mutDE_current_to_best1(y, x, best, b, c, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(size):",
-			"\t\ty[i] = x[i] + f * (best[i] - x[i]) + f * (b[i] - c[i])",
-			"\treturn y",
-		}, "\n")
-	case "DE/current-to-rand/1":
-		return strings.Join([]string{
-			"def mutDE_current_to_rand1(y, x, a, b, c, f):",
-			"\tsize = len(y)",
-			"\tK = random.uniform(0, 1)  # Random number in [0, 1]",
-			"\tfor i in range(size):",
-			"\t\ty[i] = x[i] + K * (a[i] - x[i]) + f * (b[i] - c[i])",
-			"\treturn y",
-		}, "\n")
-	case "DE/rand-to-best/1":
-		return strings.Join([]string{
-			"def mutDE_rand_to_best1(y, a, best, b, c, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(size):",
-			"\t\ty[i] = a[i] + f * (best[i] - a[i]) + f * (b[i] - c[i])",
-			"\treturn y",
-		}, "\n")
-	default:
-		return strings.Join([]string{
-			"def mutDE(y, a, b, c, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(len(y)):",
-			"\t\ty[i] = a[i] + f*(b[i]-c[i])",
-			"\treturn y",
-		}, "\n")
+func (ea *EA) deMutationFunction() py.Stmt {
+	return py.Source(deMutations[deStrategies[ea.MutationFunction].function])
+}
 
+func (ea *EA) Code() (py.Module, error) {
+	if err := ea.Validate(); err != nil {
+		return nil, err
 	}
-
+	return ea.script(), nil
 }
 
-func (ea *EA) Code() (string, error) {
-	if err := ea.validate(); err != nil {
-		return "", err
+// script generates the code of a validated EA.
+func (ea *EA) script() py.Module {
+	// evalFunction may point EvaluationFunction at a benchmark.
+	eval := ea.evalFunction()
+	code := py.Module{
+		ea.imports(),
+		seedCode(*ea.Seed),
+		eval,
 	}
 
-	var code string
-	code += ea.imports() + "\n\n"
-	code += ea.evalFunction() + "\n\n"
-
 	if ea.Algorithm == "de" {
-		code += strings.Join([]string{
-			"def mutDE(y, a, b, c, f):",
-			"\tsize = len(y)",
-			"\tfor i in range(len(y)):",
-			"\t\ty[i] = a[i] + f*(b[i]-c[i])",
-			"\treturn y",
-		}, "\n") + "\n\n"
-		code += ea.deMutationFunction() + "\n\n"
-		code += ea.deCrossOverFunctions() + "\n\n"
-	}
-
-	code += ea.CustomPop + "\n"
-	code += ea.CustomMutation + "\n"
-	code += ea.CustomSelection + "\n\n"
-
-	code += "toolbox = base.Toolbox()\n\n"
-	weights := strings.ReplaceAll(strings.ReplaceAll(fmt.Sprintf("%f", ea.Weights), "[", "("), "]", ",)")
-	code += fmt.Sprintf("creator.create('FitnessMax', base.Fitness, weights=%s)\n", weights)
-	code += "creator.create(\"Individual\", list, fitness=creator.FitnessMax)\n\n"
-
-	code += ea.registerIndividual() + "\n"
-	code += ea.initialGenerator() + "\n"
-	code += fmt.Sprintf("toolbox.register(\"evaluate\", %s)\n", ea.EvaluationFunction)
-	code += ea.mutationFunction() + "\n"
+		code = append(code, ea.deMutationFunction(), ea.deCrossOverFunctions())
+	}
+	if ea.Algorithm == "eaGenerateUpdate" {
+		code = append(code, ea.CMA.runFunction())
+	}
+	if ea.Termination != nil {
+		code = append(code, terminationClass())
+	}
+	code = append(code, metricsFunction())
+	if ea.usesEvolveLoop() {
+		code = append(code, evolveFunction())
+	}
 
-	if ea.Algorithm == "de" {
-		code += fmt.Sprintf("CR = %f\n", ea.CrossOverRate)
-		code += fmt.Sprintf("F = %f\n", ea.ScalingFactor)
-		code += fmt.Sprintf("toolbox.register(\"mate\", %s, cr=CR)\n", ea.CrossoverFunction)
+	code = append(code, py.Source(ea.CustomPop), py.Source(ea.CustomMutation), py.Source(ea.CustomSelection))
+	if ea.Constraints != nil {
+		code = append(code, ea.Constraints.functions())
+	}
+
+	fitness := "FitnessMax"
+	if ea.MultiObjective != nil {
+		fitness = "FitnessMulti"
+	}
+	code = append(code,
+		py.Blank,
+		py.Assign("toolbox", py.Raw("base.Toolbox()")),
+		py.Blank,
+		py.Do(py.Call("creator.create", py.Str(fitness), py.Raw("base.Fitness")).Kw("weights", py.Tuple(py.Floats(ea.Weights)...))),
+		py.Do(py.Call("creator.create", py.Str("Individual"), py.Raw("list")).Kw("fitness", py.Raw("creator."+fitness))),
+		py.Blank,
+		ea.registerIndividual(),
+		ea.initialGenerator(),
+		py.Do(py.Call("toolbox.register", py.Str("evaluate"), py.Raw(ea.EvaluationFunction))),
+	)
+
+	switch ea.Algorithm {
+	case "de":
+		code = append(code,
+			py.Assign("CR", py.Float(ea.CrossOverRate)),
+			py.Assign("F", py.Float(ea.ScalingFactor)),
+			ea.mutationFunction(),
+			py.Do(py.Call("toolbox.register", py.Str("mate"), py.Raw(ea.CrossoverFunction)).Kw("cr", py.Raw("CR"))),
+		)
+	case "eaGenerateUpdate":
+		// The CMA-ES strategy registers generate and update in main().
+	default:
+		code = append(code, ea.mutationFunction(), ea.crossoverFunction())
+		if ea.MultiObjective != nil {
+			code = append(code, ea.MultiObjective.selectionFunction(len(ea.Weights)))
+		} else {
+			code = append(code, ea.selectionFunction())
+		}
+	}
+	if ea.Constraints != nil {
+		code = append(code,
+			ea.Constraints.decorateEvaluate(ea.Weights),
+			ea.Constraints.decorateOperators(ea.RandomRange[0], ea.RandomRange[1]),
+		)
+	}
+	code = append(code, py.Blank, py.Do(py.Call("toolbox.register", py.Str("map"), py.Raw("futures.map"))))
+	if ea.Constraints != nil {
+		code = append(code, ea.Constraints.decorateMap(ea.Weights))
+	}
+
+	return append(code, py.Def("main()", ea.main()), mainGuard)
+}
+
+// main is the body of main(): it runs the algorithm and writes its outputs.
+func (ea *EA) main() py.Stmt {
+	var stats py.Stmt
+	if ea.MultiObjective != nil {
+		// Statistics are computed per objective.
+		stats = py.Block{
+			py.Assign("hof", py.Raw("tools.ParetoFront()")),
+			py.Blank,
+			py.Assign("stats", py.Raw("tools.Statistics(lambda ind: ind.fitness.values)")),
+			py.Do(py.Call("stats.register", py.Str("avg"), py.Raw("numpy.mean")).Kw("axis", py.Int(0))),
+			py.Do(py.Call("stats.register", py.Str("min"), py.Raw("numpy.min")).Kw("axis", py.Int(0))),
+			py.Do(py.Call("stats.register", py.Str("max"), py.Raw("numpy.max")).Kw("axis", py.Int(0))),
+		}
 	} else {
-		code += ea.crossoverFunction() + "\n"
-	}
-	code += ea.selectionFunction() + "\n"
-	code += "\ntoolbox.register(\"map\", futures.map)\n\n"
-
-	code += "def main():\n"
-	code += fmt.Sprintf("\tpopulationSize = %d\n", ea.PopulationSize)
-	code += fmt.Sprintf("\tgenerations = %d\n", ea.Generations)
-	code += fmt.Sprintf("\tcxpb = %f\n", ea.Cxpb)
-	code += fmt.Sprintf("\tmutpb = %f\n", ea.Mutpb)
-	code += fmt.Sprintf("\tN = %d\n", ea.IndividualSize)
-	code += "\n\tpop = toolbox.population(n=populationSize)\n"
-	code += fmt.Sprintf("\thof = tools.HallOfFame(%d)\n", ea.HofSize)
-	code += "\n\tstats = tools.Statistics(lambda ind: ind.fitness.values)\n"
-	code += "\tstats.register(\"avg\", numpy.mean)\n"
-	code += "\tstats.register(\"min\", numpy.min)\n"
-	code += "\tstats.register(\"max\", numpy.max)\n"
-	code += "\n"
+		stats = py.Block{
+			py.Assign("hof", py.Call("tools.HallOfFame", py.Int(ea.HofSize))),
+			py.Blank,
+			py.Assign("stats", py.Raw("tools.Statistics(lambda ind: ind.fitness.values)")),
+			py.Do(py.Call("stats.register", py.Str("avg"), py.Raw("numpy.mean"))),
+			py.Do(py.Call("stats.register", py.Str("min"), py.Raw("numpy.min"))),
+			py.Do(py.Call("stats.register", py.Str("max"), py.Raw("numpy.max"))),
+		}
+	}
 
+	var stop py.Stmt
+	if ea.Termination != nil {
+		stop = ea.Termination.instance(py.Raw("generations"), ea.Weights)
+	}
+
+	var run py.Stmt
 	if ea.Algorithm == "de" {
-		code += ea.differentialEvolution()
+		run = ea.differentialEvolution()
+	} else {
+		run = ea.callAlgo()
+	}
+
+	best := "hof[0]"
+	var outputs py.Stmt
+	if ea.MultiObjective != nil {
+		best = "None"
+		outputs = ea.MultiObjective.paretoOutputs(len(ea.Weights))
 	} else {
-		code += ea.callAlgo() + "\n"
-	}
-
-	code += "\n\trootPath = os.path.dirname(os.path.abspath(__file__))\n"
-	code += "\twith open(f\"{rootPath}/logbook.txt\", \"w\") as f:\n"
-	code += "\t\tf.write(str(logbook))\n"
-	code += "\n"
-
-	// Write best individual to file.
-	code += "\tout_file = open(f\"{rootPath}/best.txt\", \"w\")\n"
-	code += "\tout_file.write(f\"Best individual fitness: {hof[0].fitness.values}\\n\")\n"
-	code += "\n"
-	code += "\tout_file.write(f\"Best individual: {hof[0]}\\n\")\n"
-	code += "\tout_file.close()\n"
-	code += "\n\n"
-	code += ea.plots()
-	code += "\n\n"
-	code += "if __name__ == '__main__':\n"
-	code += "\tmain()"
-
-	return code, nil
+		// Write best individual to file.
+		outputs = py.Block{
+			py.Source(`
+				out_file = open(f"{rootPath}/best.txt", "w")
+				out_file.write(f"Best individual fitness: {hof[0].fitness.values}\n")
+				out_file.write(f"Best individual: {hof[0]}\n")
+				out_file.close()
+			`),
+			py.Blank,
+			ea.plots(),
+		}
+	}
+
+	return py.Block{
+		py.Assign("populationSize", py.Int(ea.PopulationSize)),
+		py.Assign("generations", py.Int(ea.Generations)),
+		py.Assign("cxpb", py.Float(ea.Cxpb)),
+		py.Assign("mutpb", py.Float(ea.Mutpb)),
+		py.Assign("N", py.Int(ea.IndividualSize)),
+		py.Blank,
+		py.Assign("pop", py.Raw("toolbox.population(n=populationSize)")),
+		stats,
+		py.Blank,
+		stop,
+		run,
+		saveResults(best, ea.Termination != nil),
+		py.Blank,
+		py.Assign("rootPath", py.Raw("os.path.dirname(os.path.abspath(__file__))")),
+		py.With(`open(f"{rootPath}/logbook.txt", "w") as f`, py.Line("f.write(str(logbook))")),
+		py.Blank,
+		outputs,
+	}
+}
+
+// Snippets returns the user-supplied Python in ea, keyed by request field,
+// for the code policy.
+func (ea *EA) Snippets() map[string]string {
+	snippets := map[string]string{
+		"customPop":       ea.CustomPop,
+		"customEval":      ea.CustomEval,
+		"customMutation":  ea.CustomMutation,
+		"customSelection": ea.CustomSelection,
+	}
+	if ea.Constraints != nil {
+		snippets["constraints.feasibility"] = ea.Constraints.Feasibility
+		snippets["constraints.distance"] = ea.Constraints.Distance
+		snippets["constraints.closestValid"] = ea.Constraints.ClosestValid
+	}
+	return snippets
 }
@@ -0,0 +1,168 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// maxEphemerals is the most ephemeral constants a primitive set has.
+const maxEphemerals = 10
+
+// maxEphemeralValue bounds the parameters of the distributions.
+const maxEphemeralValue = 1e12
+
+// Distributions ephemeral constants are drawn from.
+var gpDistributions = []string{"uniform", "randint", "normal"}
+
+// Constants that can be added to the primitive set as terminals by name.
+var gpConstants = map[string]string{
+	"pi": "math.pi",
+	"e":  "math.e",
+}
+
+// deapGPNames are the globals of deap.gp. DEAP registers an ephemeral as a
+// class of that module under its name, so these would replace, or be taken
+// for, DEAP's own. Names starting with an underscore are reserved too.
+var deapGPNames = []string{
+	"PrimitiveTree", "Primitive", "Terminal", "MetaEphemeral", "Ephemeral", "PrimitiveSetTyped", "PrimitiveSet",
+	"compile", "compileADF", "generate", "genFull", "genGrow", "genHalfAndHalf", "genRamped",
+	"cxOnePoint", "cxOnePointLeafBiased", "cxSemantic", "mutUniform", "mutNodeReplacement", "mutEphemeral",
+	"mutInsert", "mutShrink", "mutSemantic", "staticLimit", "harm", "graph",
+	"copy", "math", "copyreg", "random", "re", "sys", "types", "warnings", "isclass", "defaultdict", "deque",
+	"partial", "wraps", "eq", "lt", "tools",
+}
+
+// GPEphemeral is a terminal whose value is drawn from a distribution when a
+// tree is generated, and kept by the tree afterwards. Ephemerals are how
+// trees get the real-valued coefficients a regression fits. They are floats
+// in typed sets.
+type GPEphemeral struct {
+	Name         string  `json:"name"`
+	Distribution string  `json:"distribution"`   // uniform, randint or normal.
+	Low          float64 `json:"low,omitempty"`  // uniform and randint: the lowest value.
+	High         float64 `json:"high,omitempty"` // uniform and randint: the highest value.
+	Mean         float64 `json:"mean,omitempty"` // normal: the mean.
+	Std          float64 `json:"std,omitempty"`  // normal: the standard deviation.
+}
+
+// defaultEphemerals are the ephemerals of a GP that does not list any: the
+// integers -1, 0 and 1.
+var defaultEphemerals = []GPEphemeral{{Name: "rand101", Distribution: "randint", Low: -1, High: 1}}
+
+// validateTerminalSet checks the constants and ephemerals of gp, and sets
+// the default ephemerals if gp has none. unique checks that a name is free
+// and takes it.
+func (gp *GP) validateTerminalSet(v *util.ValidationError, unique func(field string, name string)) {
+	constants := slices.Sorted(maps.Keys(gpConstants))
+	if v.Length("constants", len(gp.Constants), 0, len(constants)) {
+		for i, c := range gp.Constants {
+			field := fmt.Sprintf("constants[%d]", i)
+			if v.OneOf(field, c, constants) {
+				unique(field, c)
+			}
+		}
+	}
+
+	// An empty list, unlike a missing one, leaves the set without ephemerals.
+	if gp.Ephemerals == nil {
+		gp.Ephemerals = slices.Clone(defaultEphemerals)
+	}
+	v.Length("ephemerals", len(gp.Ephemerals), 0, maxEphemerals)
+	for i, e := range gp.Ephemerals {
+		field := fmt.Sprintf("ephemerals[%d]", i)
+		unique(field+".name", e.Name)
+		v.Relation(field+".name", !slices.Contains(deapGPNames, e.Name) && !strings.HasPrefix(e.Name, "_"), fmt.Sprintf("%q is a name deap.gp uses", e.Name))
+		if !v.OneOf(field+".distribution", e.Distribution, gpDistributions) {
+			continue
+		}
+		switch e.Distribution {
+		case "normal":
+			v.FloatRange(field+".mean", e.Mean, -maxEphemeralValue, maxEphemeralValue)
+			v.Relation(field+".std", e.Std > 0 && e.Std <= maxEphemeralValue, fmt.Sprintf("must be above 0 and at most %g", maxEphemeralValue))
+		default:
+			if v.FloatRange(field+".low", e.Low, -maxEphemeralValue, maxEphemeralValue) {
+				v.FloatRange(field+".high", e.High, e.Low, maxEphemeralValue)
+			}
+			if e.Distribution == "randint" {
+				v.Relation(field+".low", e.Low == math.Trunc(e.Low), "must be an integer for randint")
+				v.Relation(field+".high", e.High == math.Trunc(e.High), "must be an integer for randint")
+			}
+		}
+	}
+
+	if gp.MutationFunction == "mutEphemeral" {
+		v.Relation("ephemerals", len(gp.Ephemerals) > 0, "must have an entry for mutEphemeral")
+	}
+}
+
+// sample is the Python function that draws a value of e.
+func (e GPEphemeral) sample() py.Expr {
+	switch e.Distribution {
+	case "normal":
+		return py.Call("partial", py.Raw("random.gauss"), py.Float(e.Mean), py.Float(e.Std))
+	case "randint":
+		return py.Call("partial", py.Raw("random.randint"), py.Int(int64(e.Low)), py.Int(int64(e.High)))
+	default:
+		return py.Call("partial", py.Raw("random.uniform"), py.Float(e.Low), py.Float(e.High))
+	}
+}
+
+// terminalSet adds the constants and ephemerals of gp to pset.
+func (gp *GP) terminalSet() py.Stmt {
+	var constants py.Block
+	for _, c := range gp.Constants {
+		if gp.Typed {
+			constants = append(constants, py.Do(py.Call("pset.addTerminal", py.Raw(gpConstants[c]), pyType("float")).Kw("name", py.Str(c))))
+		} else {
+			constants = append(constants, py.Do(py.Call("pset.addTerminal", py.Raw(gpConstants[c])).Kw("name", py.Str(c))))
+		}
+	}
+	if len(gp.Ephemerals) == 0 {
+		return constants
+	}
+
+	ephemerals := py.Block{
+		constants,
+		py.Source(`
+			def add_ephemeral(name, func, *ret_type):
+				# DEAP keeps the class of an ephemeral in deap.gp by name, and
+				# rejects the name for another function, as when scoop imports
+				# this module again in the same process: drop the stale class.
+				stale = getattr(gp, name, None)
+				if isinstance(stale, type) and issubclass(stale, gp.Ephemeral):
+					delattr(gp, name)
+				pset.addEphemeralConstant(name, func, *ret_type)
+		`),
+	}
+	for _, e := range gp.Ephemerals {
+		if gp.Typed {
+			ephemerals = append(ephemerals, py.Do(py.Call("add_ephemeral", py.Str(e.Name), e.sample(), pyType("float"))))
+		} else {
+			ephemerals = append(ephemerals, py.Do(py.Call("add_ephemeral", py.Str(e.Name), e.sample())))
+		}
+	}
+	return ephemerals
+}
+
+// terminalSetSchema describes the constants and ephemerals, which GP
+// validates against the rest of the primitive set.
+func terminalSetSchema(s *Schema) {
+	s.at("constants").count(0, len(gpConstants)).describe("Constants of the catalogue to add as terminals.")
+	s.at("constants").Items.enum(slices.Sorted(maps.Keys(gpConstants)))
+
+	e := s.at("ephemerals").count(0, maxEphemerals).describe("Terminals drawn from a distribution when a tree is generated. When omitted, rand101 draws the integers -1 to 1; an empty list adds none.").Items
+	e.at("name").length(1, maxIdentifierLength).pattern(`^[A-Za-z][A-Za-z0-9_]*$`).describe("Name of the ephemeral, unique among the primitives and terminals and not a name of deap.gp.")
+	e.at("distribution").enum(gpDistributions).describe("uniform draws floats in [low, high], randint integers in [low, high], normal floats around mean.")
+	e.at("low").between(-maxEphemeralValue, maxEphemeralValue).describe("uniform and randint: the lowest value.")
+	e.at("high").between(-maxEphemeralValue, maxEphemeralValue).describe("uniform and randint: the highest value, at least low.")
+	e.at("mean").between(-maxEphemeralValue, maxEphemeralValue).describe("normal: the mean.")
+	e.at("std").between(0, maxEphemeralValue).describe("normal: the standard deviation, above 0.")
+	e.require("name", "distribution")
+	e.when(propertyIn("distribution", "uniform", "randint"), object(map[string]*Schema{}, "low", "high"))
+	e.when(propertyIn("distribution", "normal"), object(map[string]*Schema{}, "mean", "std"))
+}
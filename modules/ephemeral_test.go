@@ -0,0 +1,44 @@
+package modules
+
+import (
+	"errors"
+	"evolve/util"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEphemeralNames(t *testing.T) {
+	request := readGoldenRequest(t, filepath.Join("testdata", "golden", "gp.json"))
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"rand101", true},
+		{"coefficient", true},
+		{"Ephemeral", false},
+		{"MetaEphemeral", false},
+		{"compile", false},
+		{"Terminal", false},
+		{"PrimitiveTree", false},
+		{"genFull", false},
+		{"_private", false},
+		{"__doc__", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := maps.Clone(request.Config)
+			config["ephemerals"] = []map[string]any{{"name": tt.name, "distribution": "randint", "low": -1, "high": 1}}
+			g, err := NewGenerator("gp", config)
+			if err == nil {
+				err = g.Validate()
+			}
+			var verr *util.ValidationError
+			rejected := errors.As(err, &verr) && slices.ContainsFunc(verr.Fields, func(f util.FieldError) bool { return f.Field == "ephemerals[0].name" })
+			if rejected == tt.ok || (tt.ok && err != nil) {
+				t.Errorf("ephemeral %q: error %v, want ok %v", tt.name, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CheckpointFile is written next to the generated script every
+// checkpointEvery generations, and restored when the script starts. The
+// runner uploads it with the other outputs of the run.
+const CheckpointFile = "checkpoint.pkl"
+
+// Algorithms the evolve loop implements.
+var evolveAlgorithms = []string{"eaSimple", "eaMuPlusLambda", "eaMuCommaLambda"}
+
+// validateCheckpoint checks checkpointEvery, 0 disables checkpoints.
+func validateCheckpoint(v *util.ValidationError, every int, algorithm string, generations int) {
+	if every == 0 {
+		return
+	}
+	v.IntRange("checkpointEvery", every, 1, max(generations, 1))
+	v.Relation("algorithm", slices.Contains(evolveAlgorithms, algorithm), fmt.Sprintf("must be one of %s to use checkpoints", strings.Join(evolveAlgorithms, ", ")))
+}
+
+// checkpointSchema describes checkpointEvery, which validateCheckpoint
+// checks against generations.
+func checkpointSchema(s *Schema) {
+	s.at("checkpointEvery").atLeast(0).describe("Save a checkpoint every N generations, at most generations. 0 disables checkpoints. Only for eaSimple, eaMuPlusLambda and eaMuCommaLambda.")
+}
+
+// evolveLoop renders a call to evolve, or to evolve_islands when Islands is
+// set.
+type evolveLoop struct {
+	Algorithm       string
+	Mu              int
+	Lambda          int
+	Cxpb            py.Expr
+	Mutpb           py.Expr
+	Ngen            py.Expr
+	Stats           string // Name of the Statistics object.
+	CheckpointEvery int
+	Islands         *Islands
+	Stop            bool // Pass the Termination object stop.
+}
+
+func (l evolveLoop) call() py.Stmt {
+	loop := func(population string) *py.CallExpr {
+		fn := "evolve"
+		if l.Islands != nil {
+			fn = "evolve_islands"
+		}
+		c := py.Call(fn, py.Raw(population), py.Raw("toolbox"), py.Str(l.Algorithm)).
+			Kw("cxpb", l.Cxpb).
+			Kw("mutpb", l.Mutpb).
+			Kw("ngen", l.Ngen).
+			Kw("stats", py.Raw(l.Stats)).
+			Kw("halloffame", py.Raw("hof")).
+			Kw("mu", py.Int(l.Mu)).
+			Kw("lambda_", py.Int(l.Lambda)).
+			Kw("checkpoint_every", py.Int(l.CheckpointEvery))
+		if l.Stop {
+			c.Kw("stop", py.Raw("stop"))
+		}
+		return c
+	}
+	if l.Islands == nil {
+		return py.Assign("pop, logbook", loop("pop"))
+	}
+
+	// pop is the first island; the rest are drawn the same way.
+	return py.Block{
+		py.Assign("islands", py.Rawf("[pop] + [toolbox.population(n=len(pop)) for _ in range(%d)]", l.Islands.Count-1)),
+		py.Assign("islands, logbook", l.Islands.args(loop("islands"))),
+		py.Assign("pop", py.Raw("[ind for island in islands for ind in island]")),
+	}
+}
+
+// evolveFunction is eaSimple, eaMuPlusLambda and eaMuCommaLambda in one
+// loop that saves a checkpoint every checkpoint_every generations. If a
+// checkpoint exists when it starts, the run continues from it. A
+// Termination passed as stop can end the run early.
+// evolve_islands runs the same generation on each island and migrates
+// between them.
+func evolveFunction() py.Stmt {
+	checkpoint := py.Assign("checkpoint", scriptPath(CheckpointFile))
+	return py.Block{
+		py.Source(`
+			def save_checkpoint(path, population, generation, halloffame, logbook, stop=None):
+				state = {
+					'population': population,
+					'generation': generation,
+					'halloffame': list(halloffame) if halloffame is not None else None,
+					'logbook': logbook,
+					'random': random.getstate(),
+					'numpy': numpy.random.get_state(),
+					'termination': stop.state() if stop else None,
+					'metric_history': metric_history,
+				}
+				# Written to a temporary file first so a crash never leaves a partial checkpoint.
+				with open(path + '.tmp', 'wb') as f:
+					pickle.dump(state, f)
+				os.replace(path + '.tmp', path)
+
+			def load_checkpoint(path, population, halloffame, stop=None):
+				with open(path, 'rb') as f:
+					state = pickle.load(f)
+				population[:] = state['population']
+				if halloffame is not None:
+					halloffame.clear()
+					halloffame.update(state['halloffame'])
+				random.setstate(state['random'])
+				numpy.random.set_state(state['numpy'])
+				if stop and state.get('termination'):
+					stop.restore(state['termination'])
+				# results.json covers the generations before the checkpoint too.
+				metric_history[:] = state.get('metric_history', [])
+				print(f'Resuming from checkpoint at generation {state["generation"]}')
+				return state['logbook'], state['generation'] + 1
+
+			def evaluate(population, toolbox, halloffame):
+				invalid = [ind for ind in population if not ind.fitness.valid]
+				for ind, fit in zip(invalid, toolbox.map(toolbox.evaluate, invalid)):
+					ind.fitness.values = fit
+				if halloffame is not None:
+					halloffame.update(population)
+				return len(invalid)
+
+			def generation(population, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_):
+				if algorithm == 'eaSimple':
+					offspring = algorithms.varAnd(toolbox.select(population, len(population)), toolbox, cxpb, mutpb)
+				else:
+					offspring = algorithms.varOr(population, toolbox, lambda_, cxpb, mutpb)
+				nevals = evaluate(offspring, toolbox, halloffame)
+				if algorithm == 'eaSimple':
+					population[:] = offspring
+				elif algorithm == 'eaMuPlusLambda':
+					population[:] = toolbox.select(population + offspring, mu)
+				else:
+					population[:] = toolbox.select(offspring, mu)
+				return nevals
+		`),
+		py.Def("evolve(population, toolbox, algorithm, cxpb, mutpb, ngen, stats, halloffame, mu=0, lambda_=0, checkpoint_every=0, stop=None)",
+			checkpoint,
+			py.Source(`
+				if os.path.exists(checkpoint):
+					logbook, start = load_checkpoint(checkpoint, population, halloffame, stop)
+				else:
+					logbook = tools.Logbook()
+					logbook.header = ['gen', 'nevals'] + (stats.fields if stats else [])
+					nevals = evaluate(population, toolbox, halloffame)
+					logbook.record(gen=0, nevals=nevals, **(stats.compile(population) if stats else {}))
+					print(logbook.stream)
+					emit_metrics(0, nevals, population, halloffame[0] if halloffame else None)
+					if stop:
+						stop.update(0, population, nevals)
+					start = 1
+
+				for gen in range(start, ngen + 1):
+					if stop and stop.reason:
+						break
+					nevals = generation(population, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_)
+					logbook.record(gen=gen, nevals=nevals, **(stats.compile(population) if stats else {}))
+					print(logbook.stream)
+					emit_metrics(gen, nevals, population, halloffame[0] if halloffame else None)
+					if stop:
+						stop.update(gen, population, nevals)
+					if checkpoint_every and gen % checkpoint_every == 0:
+						save_checkpoint(checkpoint, population, gen, halloffame, logbook, stop)
+				return population, logbook
+			`),
+		),
+		py.Source(`
+			def record_islands(logbook, gen, islands, nevals, stats, halloffame):
+				# The top level holds statistics over all islands, each island has its own chapter.
+				population = [ind for island in islands for ind in island]
+				chapters = {f'island{i}': dict(nevals=n, **(stats.compile(island) if stats else {})) for i, (island, n) in enumerate(zip(islands, nevals))}
+				logbook.record(gen=gen, nevals=sum(nevals), **(stats.compile(population) if stats else {}), **chapters)
+				print(logbook.stream)
+				emit_metrics(gen, sum(nevals), population, halloffame[0] if halloffame else None)
+		`),
+		py.Def("evolve_islands(islands, toolbox, algorithm, cxpb, mutpb, ngen, stats, halloffame, mu=0, lambda_=0, checkpoint_every=0, stop=None, migration_interval=1, migrants=1, emigrants=tools.selBest, replacement=None, migarray=None)",
+			checkpoint,
+			py.Source(`
+				if os.path.exists(checkpoint):
+					logbook, start = load_checkpoint(checkpoint, islands, halloffame, stop)
+				else:
+					logbook = tools.Logbook()
+					logbook.header = ['gen', 'nevals'] + (stats.fields if stats else []) + [f'island{i}' for i in range(len(islands))]
+					nevals = [evaluate(island, toolbox, halloffame) for island in islands]
+					record_islands(logbook, 0, islands, nevals, stats, halloffame)
+					if stop:
+						stop.update(0, [ind for island in islands for ind in island], sum(nevals))
+					start = 1
+
+				for gen in range(start, ngen + 1):
+					if stop and stop.reason:
+						break
+					nevals = [generation(island, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_) for island in islands]
+					if gen % migration_interval == 0:
+						tools.migRing(islands, migrants, emigrants, replacement=replacement, migarray=migarray)
+					record_islands(logbook, gen, islands, nevals, stats, halloffame)
+					if stop:
+						stop.update(gen, [ind for island in islands for ind in island], sum(nevals))
+					if checkpoint_every and gen % checkpoint_every == 0:
+						save_checkpoint(checkpoint, islands, gen, halloffame, logbook, stop)
+				return islands, logbook
+			`),
+		),
+	}
+}
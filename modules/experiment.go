@@ -0,0 +1,453 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evolve/db/connection"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Run statuses set by the runner once a run has ended.
+const (
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// Most child runs an experiment can have.
+const maxExperimentRuns = 100
+
+var sweepMethods = []string{"grid", "random", "latinHypercube"}
+
+// sweepParams are the parameters a sweep can vary, by run type. Integer
+// parameters are rounded.
+var sweepParams = map[string]map[string]bool{
+	"ea":  {"cxpb": false, "mutpb": false, "indpb": false, "populationSize": true, "generations": true},
+	"gp":  {"cxpb": false, "mutpb": false, "populationSize": true, "generations": true},
+	"ml":  {"cxpb": false, "mutpb": false, "indpb": false, "populationSize": true, "generations": true},
+	"pso": {"phi1": false, "phi2": false, "populationSize": true, "generations": true},
+}
+
+type (
+	// ExperimentReq runs Config once per point of Sweep. Every point is a
+	// child run created like a run of Type.
+	ExperimentReq struct {
+		Name   string         `json:"name"`
+		Type   string         `json:"type"`   // "ea", "gp", "ml" or "pso".
+		Config map[string]any `json:"config"` // Base config; the sweep overrides its parameters.
+		Sweep  Sweep          `json:"sweep"`
+
+		points []map[string]float64
+	}
+
+	// Sweep picks the parameter points of an experiment: every combination
+	// of the values of each parameter for grid, or Budget points between
+	// the bounds of each parameter for random and latinHypercube.
+	Sweep struct {
+		Method string                `json:"method"`
+		Params map[string]SweepParam `json:"params"`
+		Budget int                   `json:"budget,omitempty"`
+		Seed   *int64                `json:"seed,omitempty"` // Seed of the sampler, drawn when omitted.
+	}
+
+	SweepParam struct {
+		Values []float64 `json:"values,omitempty"` // Grid values.
+		Min    float64   `json:"min,omitempty"`    // Sampling bounds.
+		Max    float64   `json:"max,omitempty"`
+	}
+
+	ExperimentDataReq struct {
+		ExperimentID string `json:"experimentID"`
+	}
+
+	// ExperimentSummary is the progress of an experiment and the best
+	// fitness of every finished child run.
+	ExperimentSummary struct {
+		ID        string          `json:"id"`
+		Name      string          `json:"name"`
+		Type      string          `json:"type"`
+		Total     int             `json:"total"`
+		Finished  int             `json:"finished"`
+		Statuses  map[string]int  `json:"statuses"`
+		Runs      []ExperimentRun `json:"runs"`
+		BestRunID string          `json:"bestRunID,omitempty"` // Single objective only.
+		CreatedAt string          `json:"createdAt"`
+	}
+
+	ExperimentRun struct {
+		RunID  string             `json:"runID"`
+		Point  map[string]float64 `json:"point"`
+		Status string             `json:"status"`
+		Best   []float64          `json:"best,omitempty"` // Best fitness, once the run has completed.
+	}
+)
+
+func ExperimentReqFromJSON(jsonData map[string]any) (*ExperimentReq, error) {
+	e := &ExperimentReq{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func ExperimentDataReqFromJSON(jsonData map[string]any) (*ExperimentDataReq, error) {
+	e := &ExperimentDataReq{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *ExperimentReq) validate() error {
+	v := &util.ValidationError{}
+	v.Length("name", len(e.Name), 0, 200)
+	if !v.OneOf("type", e.Type, GeneratorTypes()) {
+		return v.Err()
+	}
+	v.Relation("config", e.Config != nil, "is required")
+	e.Sweep.validate(v, sweepParams[e.Type])
+	return v.Err()
+}
+
+func (s *Sweep) validate(v *util.ValidationError, params map[string]bool) {
+	if s.Seed == nil {
+		seed := rand.Int64N(maxSeed + 1)
+		s.Seed = &seed
+	} else {
+		v.IntRange("sweep.seed", int(*s.Seed), 0, maxSeed)
+	}
+
+	v.OneOf("sweep.method", s.Method, sweepMethods)
+	names := slices.Sorted(maps.Keys(params))
+	if !v.Length("sweep.params", len(s.Params), 1, len(names)) {
+		return
+	}
+
+	points := 1
+	for _, name := range slices.Sorted(maps.Keys(s.Params)) {
+		field := fmt.Sprintf("sweep.params.%s", name)
+		if !v.OneOf(field, name, names) {
+			continue
+		}
+		p := s.Params[name]
+		if s.Method == "grid" {
+			if v.Length(field+".values", len(p.Values), 1, maxExperimentRuns) {
+				points *= len(p.Values)
+			}
+		} else {
+			v.Relation(field+".max", p.Min < p.Max, "must be greater than min")
+		}
+	}
+
+	if s.Method == "grid" {
+		v.Relation("sweep.params", points <= maxExperimentRuns, fmt.Sprintf("must have at most %d points, got %d", maxExperimentRuns, points))
+	} else {
+		v.IntRange("sweep.budget", s.Budget, 1, maxExperimentRuns)
+	}
+}
+
+// points returns the parameter points of a validated sweep.
+func (s *Sweep) points(params map[string]bool) []map[string]float64 {
+	names := slices.Sorted(maps.Keys(s.Params))
+	rng := rand.New(rand.NewPCG(uint64(*s.Seed), 0))
+
+	var points []map[string]float64
+	switch s.Method {
+	case "grid":
+		points = []map[string]float64{{}}
+		for _, name := range names {
+			var next []map[string]float64
+			for _, point := range points {
+				for _, value := range s.Params[name].Values {
+					p := maps.Clone(point)
+					p[name] = value
+					next = append(next, p)
+				}
+			}
+			points = next
+		}
+
+	case "random":
+		for range s.Budget {
+			point := map[string]float64{}
+			for _, name := range names {
+				p := s.Params[name]
+				point[name] = p.Min + rng.Float64()*(p.Max-p.Min)
+			}
+			points = append(points, point)
+		}
+
+	case "latinHypercube":
+		// Each parameter's range is cut into Budget strata, and every
+		// stratum is sampled exactly once.
+		points = make([]map[string]float64, s.Budget)
+		for i := range points {
+			points[i] = map[string]float64{}
+		}
+		for _, name := range names {
+			p := s.Params[name]
+			width := (p.Max - p.Min) / float64(s.Budget)
+			for i, stratum := range rng.Perm(s.Budget) {
+				points[i][name] = p.Min + (float64(stratum)+rng.Float64())*width
+			}
+		}
+	}
+
+	for _, point := range points {
+		for name, value := range point {
+			if params[name] {
+				point[name] = math.Round(value)
+			}
+		}
+	}
+	return points
+}
+
+// Runs validates the experiment and returns one validated run per point.
+// Errors of a run are reported under sweep.points[i].
+func (e *ExperimentReq) Runs() ([]*NewRun, error) {
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+
+	e.points = e.Sweep.points(sweepParams[e.Type])
+	runs := make([]*NewRun, len(e.points))
+	v := &util.ValidationError{}
+	for i, point := range e.points {
+		config := maps.Clone(e.Config)
+		for name, value := range point {
+			if sweepParams[e.Type][name] {
+				config[name] = int(value)
+			} else {
+				config[name] = value
+			}
+		}
+
+		run, err := RunFromJSON(e.Type, config)
+		var verr *util.ValidationError
+		switch {
+		case errors.As(err, &verr):
+			for _, f := range verr.Fields {
+				f.Field = fmt.Sprintf("sweep.points[%d].%s", i, f.Field)
+				v.Add(f)
+			}
+		case err != nil:
+			return nil, err
+		}
+		runs[i] = run
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Create inserts the experiment and creates its runs, which Runs returned.
+// The experiment and its runs are inserted in one transaction, and the runs
+// are only queued once it is committed. It returns the ID of the experiment
+// and of every run.
+func (e *ExperimentReq) Create(ctx context.Context, runs []*NewRun, userID string, check *CodeCheck, template *CodeTemplate, logger *util.LoggerService) (string, []string, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateExperiment: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	config, err := json.Marshal(e.Config)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateExperiment.json.Marshal: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+	sweep, err := json.Marshal(e.Sweep)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateExperiment.json.Marshal: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateExperiment.db.Begin: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+	defer tx.Rollback(ctx)
+
+	var experimentID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO experiment (name, type, config, sweep, createdBy)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, e.Name, e.Type, config, sweep, userID).Scan(&experimentID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateExperiment.row.Scan: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	runIDs := make([]string, len(runs))
+	for i, run := range runs {
+		run.Description = fmt.Sprintf("%s, experiment %s", run.Description, experimentID)
+		runID, err := run.insert(ctx, tx, userID, check, template, logger)
+		if err != nil {
+			return "", nil, err
+		}
+		runIDs[i] = runID
+
+		point, err := json.Marshal(e.points[i])
+		if err != nil {
+			logger.Error(fmt.Sprintf("CreateExperiment.json.Marshal: %s", err.Error()), err)
+			return "", nil, fmt.Errorf("something went wrong")
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO experiment_run (experimentID, runID, position, point)
+			VALUES ($1, $2, $3, $4)
+		`, experimentID, runID, i, point)
+		if err != nil {
+			logger.Error(fmt.Sprintf("CreateExperiment.tx.Exec: %s", err.Error()), err)
+			return "", nil, fmt.Errorf("something went wrong")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Error(fmt.Sprintf("CreateExperiment.tx.Commit: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	if err := queueRuns(ctx, db, runIDs, logger); err != nil {
+		return "", nil, err
+	}
+	return experimentID, runIDs, nil
+}
+
+// Summary returns the progress of the experiment and the best fitness of
+// its completed runs, read from their ResultsFile.
+func (r *ExperimentDataReq) Summary(ctx context.Context, userID string, logger *util.LoggerService) (*ExperimentSummary, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ExperimentSummary: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	s := &ExperimentSummary{ID: r.ExperimentID, Statuses: map[string]int{}, Runs: []ExperimentRun{}}
+	var configJSON []byte
+	var createdAt time.Time
+	err = db.QueryRow(ctx, "SELECT name, type, config, createdAt FROM experiment WHERE id = $1 AND createdBy = $2", r.ExperimentID, userID).Scan(&s.Name, &s.Type, &configJSON, &createdAt)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ExperimentSummary.db.QueryRow: %s", err.Error()), err)
+		return nil, fmt.Errorf("experiment does not exist")
+	}
+	s.CreatedAt = createdAt.Local().String()
+
+	rows, err := db.Query(ctx, `
+		SELECT er.runID, er.point, r.status
+		FROM experiment_run er JOIN run r ON r.id = er.runID
+		WHERE er.experimentID = $1
+		ORDER BY er.position
+	`, r.ExperimentID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ExperimentSummary.db.Query: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+	for rows.Next() {
+		var run ExperimentRun
+		var point []byte
+		if err := rows.Scan(&run.RunID, &point, &run.Status); err != nil {
+			logger.Error(fmt.Sprintf("ExperimentSummary.rows.Scan: %s", err.Error()), err)
+			return nil, fmt.Errorf("something went wrong")
+		}
+		if err := json.Unmarshal(point, &run.Point); err != nil {
+			logger.Error(fmt.Sprintf("ExperimentSummary.json.Unmarshal: %s", err.Error()), err)
+			return nil, fmt.Errorf("something went wrong")
+		}
+		s.Runs = append(s.Runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(fmt.Sprintf("ExperimentSummary.rows.Err: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	for i := range s.Runs {
+		run := &s.Runs[i]
+		s.Total++
+		s.Statuses[run.Status]++
+		if run.Status == RunCompleted || run.Status == RunFailed {
+			s.Finished++
+		}
+		if run.Status == RunCompleted {
+			results, err := ReadResults(ctx, run.RunID, logger)
+			if err != nil {
+				return nil, err
+			}
+			if results != nil {
+				run.Best = results.Best
+			}
+		}
+	}
+
+	var config struct {
+		Weights []float64 `json:"weights"`
+	}
+	if err := json.Unmarshal(configJSON, &config); err == nil && len(config.Weights) == 1 {
+		s.BestRunID = bestRun(s.Runs, config.Weights[0])
+	}
+	return s, nil
+}
+
+// Results is the content of ResultsFile.
+type Results struct {
+	Best        []float64        `json:"best"`
+	Generations int              `json:"generations"`
+	Evaluations int              `json:"evaluations"`
+	Metrics     []map[string]any `json:"metrics"`
+	StopReason  string           `json:"stopReason,omitempty"`
+}
+
+// ReadResults returns the ResultsFile of a run, or nil if the run wrote
+// none, such as runs created before it was written for every run.
+func ReadResults(ctx context.Context, runID string, logger *util.LoggerService) (*Results, error) {
+	data, found, err := util.ReadFile(ctx, runID, ResultsFile)
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong")
+	}
+	if !found {
+		return nil, nil
+	}
+
+	results := &Results{}
+	if err := json.Unmarshal(data, results); err != nil {
+		logger.Error(fmt.Sprintf("ReadResults.json.Unmarshal: %s", err.Error()), err)
+		return nil, nil
+	}
+	return results, nil
+}
+
+// bestRun returns the run with the best single-objective fitness, given
+// the sign of the fitness weight, or "" if no run has a result.
+func bestRun(runs []ExperimentRun, weight float64) string {
+	best := ""
+	var bestValue float64
+	for _, run := range runs {
+		if len(run.Best) != 1 {
+			continue
+		}
+		value := run.Best[0] * weight
+		if best == "" || value > bestValue {
+			best, bestValue = run.RunID, value
+		}
+	}
+	return best
+}
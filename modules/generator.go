@@ -0,0 +1,95 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Generator is a request for a run of one algorithm family. Decoding is
+// registered with RegisterGenerator; the other methods are called in
+// order: Validate checks the request and applies its defaults, and Code,
+// Metadata, Command, Artifacts and Snippets describe the validated run.
+type Generator interface {
+	Validate() error
+	Code() (py.Module, error) // Validates the request and generates its code.
+	Metadata() RunMetadata
+	Command() string                // Runner command, run next to code.py.
+	Artifacts() ([]Artifact, error) // Files uploaded with the run besides code.py and input.json.
+	Snippets() map[string]string    // User-supplied Python, for the code policy.
+	Preview() (*Preview, error)
+}
+
+// RunMetadata is the run row of a validated request.
+type RunMetadata struct {
+	Name        string
+	Description string
+	Seed        int64
+}
+
+// Artifact is a file uploaded with a run as <Name>.<Extension>.
+type Artifact struct {
+	Name      string
+	Extension string
+	Data      []byte
+}
+
+// Decoder reads the request of a Generator.
+type Decoder func(data map[string]any) (Generator, error)
+
+type generator struct {
+	decode    Decoder
+	schema    *Schema
+	normalize func(data map[string]any)
+}
+
+var generators = map[string]generator{}
+
+// RegisterGenerator makes the algorithm family runType available to every
+// run creation path. Requests are checked against schema before they are
+// decoded. It panics if runType is registered twice.
+func RegisterGenerator(runType string, decode Decoder, schema *Schema) {
+	if _, ok := generators[runType]; ok {
+		panic(fmt.Sprintf("generator %q registered twice", runType))
+	}
+	generators[runType] = generator{decode: decode, schema: schema}
+}
+
+// normalizeRequests registers normalize to rewrite the requests of runType
+// before they are checked against its schema, for values the schema spells
+// one way and clients may spell another. normalize gets a copy of the
+// request.
+func normalizeRequests(runType string, normalize func(data map[string]any)) {
+	g := generators[runType]
+	g.normalize = normalize
+	generators[runType] = g
+}
+
+// GeneratorTypes returns the registered run types, sorted.
+func GeneratorTypes() []string {
+	return slices.Sorted(maps.Keys(generators))
+}
+
+// GeneratorSchema returns the JSON Schema of the requests of runType.
+func GeneratorSchema(runType string) (*Schema, bool) {
+	g, ok := generators[runType]
+	return g.schema, ok
+}
+
+// NewGenerator checks a request for a run of the given type against its
+// schema and decodes it.
+func NewGenerator(runType string, data map[string]any) (Generator, error) {
+	g, ok := generators[runType]
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm type %q", runType)
+	}
+	if g.normalize != nil {
+		data = maps.Clone(data)
+		g.normalize(data)
+	}
+	if err := g.schema.Validate(data); err != nil {
+		return nil, err
+	}
+	return g.decode(data)
+}
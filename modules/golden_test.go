@@ -0,0 +1,141 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"evolve/modules/py"
+	"flag"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden scripts in testdata/golden")
+
+// TestGoldenScripts generates the script of every request in testdata/golden
+// and compares it with the .py file next to it. Run with -update to rewrite
+// them after a deliberate change to the generated code.
+func TestGoldenScripts(t *testing.T) {
+	requests, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) == 0 {
+		t.Fatal("no requests in testdata/golden")
+	}
+	python, _ := exec.LookPath("python3")
+
+	for _, path := range requests {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			request := readGoldenRequest(t, path)
+			g, err := NewGenerator(request.Type, request.Config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			module, err := g.Code()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := module.String()
+
+			golden := strings.TrimSuffix(path, ".json") + ".py"
+			if *update {
+				if err := os.WriteFile(golden, []byte(code), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != string(want) {
+				t.Errorf("generated code differs from %s; run go test -update after checking the change", golden)
+			}
+
+			if _, err := py.Tokenize(code); err != nil {
+				t.Errorf("generated code does not tokenize: %v", err)
+			}
+			if python == "" {
+				t.Log("python3 not found, only tokenized")
+				return
+			}
+			cmd := exec.Command(python, "-c", "import ast, sys; ast.parse(sys.stdin.read())")
+			cmd.Stdin = strings.NewReader(code)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				t.Errorf("generated code does not parse: %v\n%s", err, stderr.String())
+			}
+		})
+	}
+}
+
+type goldenRequest struct {
+	Type   string         `json:"type"`
+	Config map[string]any `json:"config"`
+}
+
+func readGoldenRequest(t *testing.T, path string) goldenRequest {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request goldenRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+// TestGoldenRequestsCasing checks that the schema accepts the golden
+// requests whenever Validate does, with the individual spelled in any case.
+func TestGoldenRequestsCasing(t *testing.T) {
+	requests, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range requests {
+		request := readGoldenRequest(t, path)
+		individual, ok := request.Config["individual"].(string)
+		if !ok {
+			continue
+		}
+		for _, spelling := range []string{individual, strings.ToLower(individual), strings.ToUpper(individual)} {
+			name := strings.TrimSuffix(filepath.Base(path), ".json") + "/" + spelling
+			t.Run(name, func(t *testing.T) {
+				config := maps.Clone(request.Config)
+				config["individual"] = spelling
+
+				decoded, err := generators[request.Type].decode(maps.Clone(config))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := decoded.Validate(); err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				g, err := NewGenerator(request.Type, config)
+				if err != nil {
+					t.Fatalf("NewGenerator: %v", err)
+				}
+				if err := g.Validate(); err != nil {
+					t.Fatalf("Validate after NewGenerator: %v", err)
+				}
+			})
+		}
+
+		// A name that is not an individual in any case fails both.
+		config := maps.Clone(request.Config)
+		config["individual"] = "binary_string"
+		if _, err := NewGenerator(request.Type, config); err == nil {
+			t.Errorf("%s: NewGenerator accepted individual binary_string", path)
+		}
+		if decoded, err := generators[request.Type].decode(config); err == nil && decoded.Validate() == nil {
+			t.Errorf("%s: Validate accepted individual binary_string", path)
+		}
+	}
+}
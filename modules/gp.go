@@ -2,9 +2,10 @@ package modules
 
 import (
 	"encoding/json"
+	"evolve/modules/py"
 	"evolve/util"
 	"fmt"
-	"strings"
+	"slices"
 )
 
 type GP struct {
@@ -39,6 +40,44 @@ type GP struct {
 	HofSize            int       `json:"hofSize"`
 	ExprMutMin         int       `json:"expr_mut_min"`
 	ExprMutMax         int       `json:"expr_mut_max"`
+
+	// Seed for random and numpy.random, drawn when omitted.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Save a checkpoint every N generations, 0 disables checkpoints.
+	CheckpointEvery int `json:"checkpointEvery,omitempty"`
+
+	// Island model; PopulationSize is the size of each island.
+	Islands *Islands `json:"islands,omitempty"`
+
+	// Rules that end the run before Generations.
+	Termination *Termination `json:"termination,omitempty"`
+
+	// Table to fit instead of RealFunction.
+	Dataset *Dataset `json:"dataset,omitempty"`
+
+	// Strongly typed primitive set: the types of the inputs and of the
+	// evolved function, float when empty.
+	Typed      bool     `json:"typed,omitempty"`
+	ArgTypes   []string `json:"argTypes,omitempty"`
+	ReturnType string   `json:"returnType,omitempty"`
+
+	// Primitives defined in Python and named constants, added to the
+	// primitive set after Operators.
+	Primitives []GPPrimitive `json:"primitives,omitempty"`
+	Terminals  []GPTerminal  `json:"terminals,omitempty"`
+
+	// Catalogue constants, such as pi, and ephemeral constants added as
+	// terminals; rand101 when Ephemerals is null.
+	Constants  []string      `json:"constants,omitempty"`
+	Ephemerals []GPEphemeral `json:"ephemerals"`
+
+	// Pressure towards small trees.
+	Parsimony *Parsimony `json:"parsimony,omitempty"`
+}
+
+func init() {
+	RegisterGenerator("gp", func(data map[string]any) (Generator, error) { return GPFromJSON(data) }, gpSchema())
 }
 
 func GPFromJSON(jsonData map[string]any) (*GP, error) {
@@ -54,255 +93,450 @@ func GPFromJSON(jsonData map[string]any) (*GP, error) {
 	return gp, nil
 }
 
-func (gp *GP) validate() error {
-	if err := util.ValidateAlgorithmName(gp.Algorithm); err != nil {
-		return err
+var (
+	gpAlgorithms         = []string{"eaSimple", "eaMuPlusLambda", "eaMuCommaLambda"}
+	gpGenerators         = []string{"genFull", "genGrow", "genHalfAndHalf"}
+	gpCrossoverFunctions = []string{"cxOnePoint", "cxOnePointLeafBiased", "cxSemantic"}
+	gpMutationFunctions  = []string{"mutUniform", "mutShrink", "mutNodeReplacement", "mutInsert", "mutEphemeral", "mutSemantic"}
+)
+
+func (gp *GP) Validate() error {
+	v := &util.ValidationError{}
+	gp.Seed = resolveSeed(v, gp.Seed)
+	v.OneOf("algorithm", gp.Algorithm, gpAlgorithms)
+	v.IntRange("arity", gp.Arity, 1, maxIndividualSize)
+
+	v.Length("argNames", len(gp.ArgNames), 0, max(gp.Arity, 0))
+	for i, name := range gp.ArgNames {
+		field := fmt.Sprintf("argNames[%d]", i)
+		if validateIdentifier(v, field, name) {
+			v.Relation(field, !slices.Contains(gp.ArgNames[:i], name), "must be unique")
+		}
+	}
+	if gp.Dataset != nil {
+		v.Relation("realFunction", gp.RealFunction == "", "must not be given together with dataset")
+		gp.Dataset.validate(v, gp)
+		if len(gp.Weights) == 1 {
+			v.Relation("weights[0]", gp.Weights[0] < 0, "must be negative to minimise the mean squared error")
+		}
+	} else if v.Required("realFunction", gp.RealFunction) {
+		v.Relation("arity", gp.Arity == 1, "must be 1 without a dataset: realFunction is a function of x")
 	}
-	// TODO: Validate remaining fields.
-	return nil
+
+	gp.validatePrimitiveSet(v)
+
+	v.OneOf("expr", gp.Expr, gpGenerators)
+	if v.IntRange("min_", gp.Min, 0, maxTreeHeight) {
+		v.IntRange("max_", gp.Max, gp.Min, maxTreeHeight)
+	}
+	v.OneOf("individualFunction", gp.IndividualFunction, []string{"initIterate"})
+	v.OneOf("populationFunction", gp.PopulationFunction, []string{"initRepeat"})
+
+	v.OneOf("expr_mut", gp.ExprMut, gpGenerators)
+	if v.IntRange("expr_mut_min", gp.ExprMutMin, 0, maxTreeHeight) {
+		v.IntRange("expr_mut_max", gp.ExprMutMax, gp.ExprMutMin, maxTreeHeight)
+	}
+
+	if v.OneOf("crossoverFunction", gp.CrossoverFunction, gpCrossoverFunctions) && gp.CrossoverFunction == "cxOnePointLeafBiased" {
+		v.FloatRange("terminalProb", gp.TerminalProb, 0, 1)
+	}
+	if v.OneOf("mutationFunction", gp.MutationFunction, gpMutationFunctions) && gp.MutationFunction == "mutEphemeral" {
+		v.OneOf("mutationMode", gp.MutationMode, []string{"one", "all"})
+	}
+	// The semantic operators build their trees from these primitives.
+	if gp.CrossoverFunction == "cxSemantic" || gp.MutationFunction == "mutSemantic" {
+		for _, op := range []string{"lf", "mul", "add", "sub"} {
+			v.Relation("operators", slices.Contains(gp.Operators, op), fmt.Sprintf("must include %s for cxSemantic and mutSemantic", op))
+		}
+	}
+	v.IntRange("mateHeight", gp.MateHeight, 1, maxTreeHeight)
+	v.IntRange("mutHeight", gp.MutHeight, 1, maxTreeHeight)
+
+	// evalSymbReg returns a single error value.
+	validateRun(v, gp.PopulationSize, gp.Generations, gp.Cxpb, gp.Mutpb)
+	validateWeights(v, gp.Weights, 1)
+	validateHof(v, gp.HofSize, gp.PopulationSize)
+	validateSelection(v, gp.SelectionFunction, gp.TournamentSize, gp.PopulationSize, false)
+	if gp.Parsimony != nil {
+		gp.Parsimony.validate(v, gp.Algorithm, gp.SelectionFunction)
+	}
+	validateMuLambda(v, gp.Algorithm, gp.Mu, gp.Lambda, gp.Cxpb, gp.Mutpb)
+	validateCheckpoint(v, gp.CheckpointEvery, gp.Algorithm, gp.Generations)
+	if gp.Islands != nil {
+		gp.Islands.validate(v, gp.Algorithm, gp.PopulationSize, gp.Generations)
+	}
+	if gp.Termination != nil {
+		gp.Termination.validate(v, gp.fitnessWeights(), gp.Generations)
+	}
+	return v.Err()
 }
 
-func (gp *GP) imports() string {
-	return strings.Join([]string{
-		"import operator",
-		"import math",
-		"import random",
-		"import numpy",
-		"import os",
-		"import matplotlib.pyplot as plt",
-		"import networkx as nx",
-		"from functools import partial",
-		"from deap import algorithms, base, creator, tools, gp, cma",
-		"from scoop import futures",
-	}, "\n")
+// gpSchema describes the GP config. Checks that compare fields, such as
+// max_ against min_, are left to Validate.
+func gpSchema() *Schema {
+	s := configSchema[GP]("Genetic programming", "Symbolic regression with DEAP genetic programming.")
+	s.at("algorithm").enum(gpAlgorithms).describe("Algorithm to run.")
+	s.at("arity").between(1, maxIndividualSize).describe("Number of inputs of the evolved function: 1 for realFunction, the number of feature columns for dataset.")
+	s.at("argNames").describe("Names of the inputs, at most arity; the rest keep DEAP's ARG names.")
+	s.at("argNames").Items.length(1, maxIdentifierLength).pattern(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	s.at("realFunction").describe("Python expression of the target function, in terms of x. Required without dataset.")
+	s.at("expr").enum(gpGenerators).describe("Generator of the initial trees.")
+	s.at("min_").between(0, maxTreeHeight).describe("Minimum height of the initial trees.")
+	s.at("max_").between(0, maxTreeHeight).describe("Maximum height of the initial trees, at least min_.")
+	s.at("individualFunction").enum([]string{"initIterate"}).describe("DEAP individual initialiser.")
+	s.at("populationFunction").enum([]string{"initRepeat"}).describe("DEAP population initialiser.")
+	s.at("expr_mut").enum(gpGenerators).describe("Generator of the subtrees inserted by mutation.")
+	s.at("expr_mut_min").between(0, maxTreeHeight).describe("Minimum height of the subtrees inserted by mutation.")
+	s.at("expr_mut_max").between(0, maxTreeHeight).describe("Maximum height of the subtrees inserted by mutation, at least expr_mut_min.")
+	s.at("crossoverFunction").enum(gpCrossoverFunctions).describe("Crossover operator.")
+	s.at("terminalProb").describe("cxOnePointLeafBiased: probability of choosing a terminal as crossover point.")
+	s.at("mutationFunction").enum(gpMutationFunctions).describe("Mutation operator.")
+	s.at("mutationMode").describe("mutEphemeral: mutate one or all ephemeral constants.")
+	s.at("mateHeight").between(1, maxTreeHeight).describe("Height limit of the trees crossover produces.")
+	s.at("mutHeight").between(1, maxTreeHeight).describe("Height limit of the trees mutation produces.")
+	s.require("algorithm", "arity", "operators", "expr", "individualFunction", "populationFunction",
+		"expr_mut", "crossoverFunction", "mutationFunction", "mateHeight", "mutHeight")
+	runSchema(s)
+	weightsSchema(s, 1)
+	hofSchema(s)
+	selectionSchema(s, &Schema{}, false)
+	muLambdaSchema(s)
+
+	s.when(null("dataset"), object(map[string]*Schema{"realFunction": new(Schema).nonEmpty()}, "realFunction"))
+	s.when(propertyIn("crossoverFunction", "cxOnePointLeafBiased"), object(map[string]*Schema{"terminalProb": new(Schema).between(0, 1)}))
+	s.when(propertyIn("mutationFunction", "mutEphemeral"), object(map[string]*Schema{"mutationMode": new(Schema).enum([]string{"one", "all"})}, "mutationMode"))
+
+	checkpointSchema(s)
+	islandsSchema(s)
+	terminationSchema(s)
+	datasetSchema(s)
+	primitivesSchema(s)
+	terminalSetSchema(s)
+	parsimonySchema(s)
+	return s
 }
 
-func (gp *GP) evalFunction() string {
-	var evalFunc string
-	evalFunc += "def evalSymbReg(individual, points, realFunction):\n"
-	evalFunc += "\t# Transform the tree expression in a callable function\n"
-	evalFunc += "\tfunc = toolbox.compile(expr=individual)\n"
-	evalFunc += "\t# Evaluate the mean squared error between the expression\n"
-	evalFunc += "\t# and the real function : x**4 + x**3 + x**2 + x\n"
-	evalFunc += "\tsqerrors= ((func(x) - eval(realFunction))**2 for x in points)\n"
-	evalFunc += "\treturn (math.fsum(sqerrors) / len(points),)\n\n"
-	return evalFunc
+func (gp *GP) imports() py.Stmt {
+	return py.Section(SectionImports,
+		py.Import("operator"),
+		py.Import("math"),
+		py.Import("random"),
+		py.Import("numpy"),
+		py.Import("os"),
+		py.Import("pickle"),
+		py.Import("json"),
+		py.Import("time"),
+		py.Import("matplotlib.pyplot as plt"),
+		py.Import("networkx as nx"),
+		py.From("functools", "partial"),
+		py.From("deap", "algorithms, base, creator, tools, gp, cma"),
+		py.From("scoop", "futures"),
+	)
 }
 
-func (gp *GP) addPrimitivesToPSET() string {
-	primitiveSource := map[string]map[string]any{
-		"add": {"arity": 2, "code": "operator.add"},
-		"sub": {"arity": 2, "code": "operator.sub"},
-		"mul": {"arity": 2, "code": "operator.mul"},
-		"div": {"arity": 2, "code": "protectedDiv"},
-		"neg": {"arity": 1, "code": "operator.neg"},
-		"cos": {"arity": 1, "code": "math.cos"},
-		"sin": {"arity": 1, "code": "math.sin"},
-		"lf":  {"arity": 1, "code": "lf"},
+// data sets X, the inputs of the evolved function, and y, its target, and
+// splits the indices of their rows into train and validation. Without a
+// dataset, the target is realFunction at 20 points in [-1, 1), all of them
+// used for training.
+func (gp *GP) data() py.Stmt {
+	if gp.Dataset != nil {
+		return gp.Dataset.load()
 	}
-
-	var primitives string
-	for _, operator := range gp.Operators {
-		primitive := primitiveSource[operator]
-		primitives += fmt.Sprintf("pset.addPrimitive(%s, %d)\n", primitive["code"], primitive["arity"])
+	return py.Block{
+		py.Assign("points", py.Raw("[x / 10.0 for x in range(-10, 10)]")),
+		py.Assign("X", py.Raw("numpy.array([[x] for x in points])")),
+		py.Assign("y", py.Rawf("numpy.array([eval(%s, globals(), {'x': x}) for x in points], dtype=float)", py.Str(gp.RealFunction))),
+		py.Assign("train", py.Raw("numpy.arange(len(y))")),
+		py.Assign("validation", py.Raw("numpy.arange(0)")),
 	}
-	return primitives
 }
 
-func (gp *GP) renameArgs() string {
-	argDict := make(map[string]string)
-	for i, name := range gp.ArgNames {
-		argDict[fmt.Sprintf("ARG%d", i)] = name
+// evalFunction defines evalSymbReg, the mean squared error of an individual
+// on the rows of X and y it is given, and its size in pareto runs, and
+// regression_metrics, which also computes R² and the mean absolute error.
+// Errors that are not finite, or raised by a primitive, make the error
+// infinite.
+func (gp *GP) evalFunction() py.Stmt {
+	fitness := []py.Expr{py.Raw("mse if mse is not None else math.inf")}
+	if gp.Parsimony.pareto() {
+		fitness = append(fitness, py.Raw("len(individual)"))
 	}
+	return py.Block{
+		gp.data(),
+		py.Source(`
+			def regression_metrics(func, X, y):
+				with numpy.errstate(all='ignore'):
+					try:
+						error = numpy.array([func(*row) for row in X.tolist()], dtype=float) - y
+					except (ArithmeticError, ValueError, TypeError):
+						error = numpy.full(len(y), math.inf)
+					sse = float(numpy.sum(error ** 2))
+					sst = float(numpy.sum((y - numpy.mean(y)) ** 2))
+					metrics = {
+						'mse': sse / len(y),
+						'r2': 1 - sse / sst if sst > 0 else math.nan,
+						'mae': float(numpy.mean(numpy.abs(error))),
+					}
+				# NaN and infinities have no JSON form.
+				return {name: value if math.isfinite(value) else None for name, value in metrics.items()}
+		`),
+		py.Def("evalSymbReg(individual, X, y)",
+			py.Comment("Transform the tree expression in a callable function"),
+			py.Assign("func", py.Raw("toolbox.compile(expr=individual)")),
+			py.Assign("mse", py.Raw("regression_metrics(func, X, y)['mse']")),
+			py.Return(py.Tuple(fitness...)),
+		),
+	}
+}
 
-	var code string
-
-	var argString string
-	for k, v := range argDict {
-		argString += fmt.Sprintf("'%s': '%s', ", k, v)
+func (gp *GP) renameArgs() py.Stmt {
+	args := make([]py.Entry, len(gp.ArgNames))
+	for i, name := range gp.ArgNames {
+		args[i] = py.Entry{Key: py.Str(fmt.Sprintf("ARG%d", i)), Value: py.Str(name)}
 	}
-	// Remove trailing comma and space
-	if len(argString) > 2 {
-		argString = argString[:len(argString)-2]
+	return py.Block{
+		py.Assign("arg_dict", py.Dict(args...)),
+		py.Line("pset.renameArguments(**arg_dict)"),
 	}
-
-	code += fmt.Sprintf("arg_dict = {%s}\n", argString)
-	code += "pset.renameArguments(**arg_dict)\n\n"
-	return code
 }
 
-func (gp *GP) selectionFunction() string {
+func (gp *GP) selectionFunction() py.Stmt {
+	if gp.Parsimony != nil {
+		return gp.Parsimony.selectionFunction(gp.TournamentSize)
+	}
 	// TODO: Add support for other selection functions.
-	switch gp.SelectionFunction {
-	case "selTournament":
-		return fmt.Sprintf("toolbox.register('select', tools.%s, tournsize=%d)\n", gp.SelectionFunction, gp.TournamentSize)
-	default:
-		return fmt.Sprintf("toolbox.register('select', tools.%s)\n", gp.SelectionFunction)
+	c := py.Call("toolbox.register", py.Str("select"), py.Raw("tools."+gp.SelectionFunction))
+	if gp.SelectionFunction == "selTournament" {
+		c.Kw("tournsize", py.Int(gp.TournamentSize))
 	}
+	return py.Do(c)
 }
 
-func (gp *GP) crossoverFunction() string {
+func (gp *GP) crossoverFunction() py.Stmt {
+	register := func(fn string) *py.CallExpr {
+		return py.Call("toolbox.register", py.Str("mate"), py.Raw("gp."+fn))
+	}
 	switch gp.CrossoverFunction {
-	case "cxOnePoint":
-		return "toolbox.register('mate', gp.cxOnePoint)\n"
 	case "cxOnePointLeafBiased":
-		return fmt.Sprintf("toolbox.register('mate', gp.cxOnePointLeafBiased, termpb=%v)\n", gp.TerminalProb)
+		return py.Do(register("cxOnePointLeafBiased").Kw("termpb", py.Float(gp.TerminalProb)))
 	case "cxSemantic":
-		return "toolbox.register('mate', gp.cxSemantic, gen_func=gp.genFull, pset=pset)\n"
+		return py.Do(register("cxSemantic").Kw("gen_func", py.Raw("gp.genFull")).Kw("pset", py.Raw("pset")))
 	default:
-		return "toolbox.register('mate', gp.cxOnePoint)\n"
+		return py.Do(register("cxOnePoint"))
 	}
 }
 
-func (gp *GP) mutationFunction() string {
+func (gp *GP) mutationFunction() py.Stmt {
+	register := func(fn string) *py.CallExpr {
+		return py.Call("toolbox.register", py.Str("mutate"), py.Raw("gp."+fn))
+	}
+	pset := py.Raw("pset")
 	switch gp.MutationFunction {
-	case "mutUniform":
-		return "toolbox.register('mutate', gp.mutUniform, expr=toolbox.expr_mut, pset=pset)\n"
 	case "mutShrink":
-		return "toolbox.register('mutate', gp.mutShrink)\n"
+		return py.Do(register("mutShrink"))
 	case "mutNodeReplacement":
-		return "toolbox.register('mutate', gp.mutNodeReplacement, pset=pset)\n"
+		return py.Do(register("mutNodeReplacement").Kw("pset", pset))
 	case "mutInsert":
-		return "toolbox.register('mutate', gp.mutInsert, pset=pset)\n"
+		return py.Do(register("mutInsert").Kw("pset", pset))
 	case "mutEphemeral":
-		return fmt.Sprintf("toolbox.register('mutate', gp.mutEphemeral, mode='%s')\n", gp.MutationMode)
+		return py.Do(register("mutEphemeral").Kw("mode", py.Str(gp.MutationMode)))
 	case "mutSemantic":
-		return "toolbox.register('mutate', gp.mutSemantic, gen_func=gp.genFull, pset=pset)\n"
+		return py.Do(register("mutSemantic").Kw("gen_func", py.Raw("gp.genFull")).Kw("pset", pset))
 	default:
-		return "toolbox.register('mutate', gp.mutUniform, expr=toolbox.expr_mut, pset=pset)\n"
+		return py.Do(register("mutUniform").Kw("expr", py.Raw("toolbox.expr_mut")).Kw("pset", pset))
 	}
 }
 
-func (gp *GP) bloatControl() string {
-	var code string
-	code += fmt.Sprintf("toolbox.decorate('mate', gp.staticLimit(key=operator.attrgetter('height'), max_value=%d))\n", gp.MateHeight)
-	code += fmt.Sprintf("toolbox.decorate('mutate', gp.staticLimit(key=operator.attrgetter('height'), max_value=%d))\n", gp.MutHeight)
-	return code
+func (gp *GP) bloatControl() py.Stmt {
+	limit := func(operator string, height int) py.Stmt {
+		return py.Do(py.Call("toolbox.decorate", py.Str(operator), py.Call("gp.staticLimit").Kw("key", py.Raw("operator.attrgetter('height')")).Kw("max_value", py.Int(height))))
+	}
+	return py.Block{limit("mate", gp.MateHeight), limit("mutate", gp.MutHeight)}
 }
 
-func (gp *GP) setupStats() string {
-	var code string
-	code += "\tstats_fit = tools.Statistics(lambda ind: ind.fitness.values)\n"
-	code += "\tstats_size = tools.Statistics(len)\n"
-	code += "\tmstats = tools.MultiStatistics(fitness=stats_fit, size=stats_size)\n"
-	code += "\tmstats.register('avg', numpy.mean)\n"
-	code += "\tmstats.register('std', numpy.std)\n"
-	code += "\tmstats.register('min', numpy.min)\n"
-	code += "\tmstats.register('max', numpy.max)\n"
-	return code
+// setupStats tracks the error and the size of the trees. In pareto runs the
+// size, the second objective, is left out of the fitness statistics.
+func (gp *GP) setupStats() py.Stmt {
+	fitness := "ind.fitness.values"
+	if gp.Parsimony.pareto() {
+		fitness = "ind.fitness.values[:1]"
+	}
+	return py.Block{
+		py.Assign("stats_fit", py.Rawf("tools.Statistics(lambda ind: %s)", py.Raw(fitness))),
+		py.Source(`
+			stats_size = tools.Statistics(len)
+			mstats = tools.MultiStatistics(fitness=stats_fit, size=stats_size)
+			mstats.register('avg', numpy.mean)
+			mstats.register('std', numpy.std)
+			mstats.register('min', numpy.min)
+			mstats.register('max', numpy.max)
+		`),
+	}
+}
 
+// callAlgo runs evolve, which unlike DEAP's algorithms prints the metrics
+// of every generation.
+func (gp *GP) callAlgo() py.Stmt {
+	return evolveLoop{Algorithm: gp.Algorithm, Mu: gp.Mu, Lambda: gp.Lambda, Cxpb: py.Float(gp.Cxpb), Mutpb: py.Float(gp.Mutpb), Ngen: py.Int(gp.Generations), Stats: "mstats", CheckpointEvery: gp.CheckpointEvery, Islands: gp.Islands, Stop: gp.Termination != nil}.call()
 }
 
-func (gp *GP) callAlgo() string {
-	var code string
-	switch gp.Algorithm {
-	case "eaSimple":
-		code += fmt.Sprintf("\tpop, logbook = algorithms.%s(pop, toolbox, cxpb=%v, mutpb=%v, ngen=%d, stats=mstats, halloffame=hof, verbose=True)\n", gp.Algorithm, gp.Cxpb, gp.Mutpb, gp.Generations)
-	case "eaMuPlusLambda":
-		code += fmt.Sprintf("\tpop, logbook = algorithms.%s(pop, toolbox, mu=%d, lambda_=%d, cxpb=%v, mutpb=%v, ngen=%d, stats=mstats, halloffame=hof, verbose=True)\n", gp.Algorithm, gp.Mu, gp.Lambda, gp.Cxpb, gp.Mutpb, gp.Generations)
-	case "eaMuCommaLambda":
-		code += fmt.Sprintf("\tpop, logbook = algorithms.%s(pop, toolbox, mu=%d, lambda_=%d, cxpb=%v, mutpb=%v, ngen=%d, stats=mstats, halloffame=hof, verbose=True)\n", gp.Algorithm, gp.Mu, gp.Lambda, gp.Cxpb, gp.Mutpb, gp.Generations)
-	case "eaGenerateUpdate":
-		code += "\tnumpy.random.seed(128)\n"
-		code += fmt.Sprintf("\tstrategy = cma.Strategy(centroid=[5.0] * %d, sigma=5.0, lambda_=20 * %d)\n", gp.IndividualSize, gp.IndividualSize)
-		code += "\ttoolbox.register('generate', strategy.generate, creator.Individual)\n"
-		code += "\ttoolbox.register('update', strategy.update)\n"
-		code += fmt.Sprintf("\tpop, logbook = algorithms.%s(toolbox, ngen=%d, stats=mstats, halloffame=hof, verbose=True)\n", gp.Algorithm, gp.Generations)
-	default:
-		code += fmt.Sprintf("\tpop, logbook = algorithms.%s(pop, toolbox, cxpb=%v, mutpb=%v, ngen=%d, stats=mstats, halloffame=hof, verbose=True)\n", gp.Algorithm, gp.Cxpb, gp.Mutpb, gp.Generations)
+func (gp *GP) setupLogs() py.Stmt {
+	return py.Block{
+		py.With(`open(f"{rootPath}/logbook.txt", "w") as f`, py.Line("f.write(str(logbook))")),
+		py.Blank,
+
+		// Write the error of the best individual on the train and validation rows.
+		py.Source(`
+			func = toolbox.compile(expr=hof[0])
+			regression = {
+				'train': regression_metrics(func, X[train], y[train]),
+				'validation': regression_metrics(func, X[validation], y[validation]) if len(validation) else None,
+			}
+			with open(f"{rootPath}/regression.json", "w") as f:
+				json.dump(regression, f, indent=2)
+		`),
+		py.Blank,
+
+		// Write best individual to file.
+		py.Source(`
+			out_file = open(f"{rootPath}/best.txt", "w")
+			out_file.write(f"Best individual fitness: {hof[0].fitness.values}\n")
+			out_file.write(f"Best individual: {hof[0]}\n")
+			for rows, metrics in regression.items():
+				if metrics is not None:
+					out_file.write(f"{rows.capitalize()} MSE: {metrics['mse']}, R2: {metrics['r2']}, MAE: {metrics['mae']}\n")
+			out_file.close()
+		`),
 	}
+}
 
-	return code
+func (gp *GP) createPlots() py.Stmt {
+	return py.Section(SectionPlots, py.Source(`
+		expr = hof[0]
+		nodes, edges, labels = gp.graph(expr)
+		g = nx.Graph()
+		g.add_nodes_from(nodes)
+		g.add_edges_from(edges)
+		pos = nx.nx_agraph.graphviz_layout(g, prog='dot')
+
+		plt.figure(figsize=(7,7))
+		nx.draw_networkx_nodes(g, pos, node_size=900, node_color='skyblue')
+		nx.draw_networkx_edges(g, pos, edge_color='gray')
+		nx.draw_networkx_labels(g, pos, labels, font_color='black')
+		plt.axis('off')
+		plt.savefig(f'{rootPath}/graph.png', dpi=300)
+		plt.close()
+	`))
 }
 
-func (gp *GP) setupLogs() string {
-	var code string
-	code += "\twith open(f\"{rootPath}/logbook.txt\", \"w\") as f:\n"
-	code += "\t\tf.write(str(logbook))\n"
-	code += "\n"
+func (gp *GP) Code() (py.Module, error) {
+	if err := gp.Validate(); err != nil {
+		return nil, err
+	}
+	return gp.script(), nil
+}
 
-	// Write best individual to file.
-	code += "\tout_file = open(f\"{rootPath}/best.txt\", \"w\")\n"
-	code += "\tout_file.write(f\"Best individual fitness: {hof[0].fitness.values}\\n\")\n"
-	code += "\tout_file.close()\n"
+// script generates the code of a validated GP.
+func (gp *GP) script() py.Module {
+	var stop py.Stmt
+	if gp.Termination != nil {
+		stop = terminationClass()
+	}
+
+	code := py.Module{
+		gp.imports(),
+		seedCode(*gp.Seed),
+		gp.evalFunction(),
+
+		py.Assign("toolbox", py.Raw("base.Toolbox()")),
+		gp.primitiveSet(),
+		py.Blank,
+
+		py.Do(py.Call("creator.create", py.Str("Fitness"), py.Raw("base.Fitness")).Kw("weights", py.Tuple(py.Floats(gp.fitnessWeights())...))),
+		py.Do(py.Call("creator.create", py.Str("Individual"), py.Raw("gp.PrimitiveTree")).Kw("fitness", py.Raw("creator.Fitness"))),
+		py.Blank,
+
+		py.Do(py.Call("toolbox.register", py.Str("expr"), py.Raw("gp."+gp.Expr)).Kw("pset", py.Raw("pset")).Kw("min_", py.Int(gp.Min)).Kw("max_", py.Int(gp.Max))),
+		py.Do(py.Call("toolbox.register", py.Str("individual"), py.Raw("tools."+gp.IndividualFunction), py.Raw("creator.Individual"), py.Raw("toolbox.expr"))),
+		py.Do(py.Call("toolbox.register", py.Str("population"), py.Raw("tools."+gp.PopulationFunction), py.Raw("list"), py.Raw("toolbox.individual"))),
+		py.Do(py.Call("toolbox.register", py.Str("compile"), py.Raw("gp.compile")).Kw("pset", py.Raw("pset"))),
+		py.Blank,
+
+		py.Do(py.Call("toolbox.register", py.Str("evaluate"), py.Raw("evalSymbReg")).Kw("X", py.Raw("X[train]")).Kw("y", py.Raw("y[train]"))),
+		py.Blank,
+
+		gp.selectionFunction(),
+		gp.crossoverFunction(),
+		py.Do(py.Call("toolbox.register", py.Str("expr_mut"), py.Raw("gp."+gp.ExprMut)).Kw("min_", py.Int(gp.ExprMutMin)).Kw("max_", py.Int(gp.ExprMutMax))),
+		gp.mutationFunction(),
+		gp.bloatControl(),
+		py.Do(py.Call("toolbox.register", py.Str("map"), py.Raw("futures.map"))),
+		stop,
+		metricsFunction(),
+		evolveFunction(),
+		py.Def("main()", gp.main()),
+		mainGuard,
+	}
 	return code
 }
 
-func (gp *GP) createPlots() string {
-	var code string
-	code += "\n\texpr = hof[0]\n"
-	code += "\tnodes, edges, labels = gp.graph(expr)\n"
-	code += "\tg = nx.Graph()\n"
-	code += "\tg.add_nodes_from(nodes)\n"
-	code += "\tg.add_edges_from(edges)\n"
-	code += "\tpos = nx.nx_agraph.graphviz_layout(g, prog='dot')\n"
-	code += "\n\tplt.figure(figsize=(7,7))\n"
-	code += "\tnx.draw_networkx_nodes(g, pos, node_size=900, node_color='skyblue')\n"
-	code += "\tnx.draw_networkx_edges(g, pos, edge_color='gray')\n"
-	code += "\tnx.draw_networkx_labels(g, pos, labels, font_color='black')\n"
-	code += "\tplt.axis('off')\n"
-	code += "\tplt.savefig(f'{rootPath}/graph.png', dpi=300)\n"
-	code += "\tplt.close()\n"
-	return code
+// main is the body of main(): it runs the algorithm and writes its outputs.
+func (gp *GP) main() py.Stmt {
+	var stop py.Stmt
+	if gp.Termination != nil {
+		stop = gp.Termination.instance(py.Int(gp.Generations), gp.fitnessWeights())
+	}
+	// The Pareto front keeps every expression no other beats on both error
+	// and size; its first one has the lowest error.
+	hof := py.Call("tools.HallOfFame", py.Int(gp.HofSize))
+	var pareto py.Stmt
+	if gp.Parsimony.pareto() {
+		hof = py.Call("tools.ParetoFront")
+		pareto = py.Block{py.Blank, paretoOutputs()}
+	}
+	return py.Block{
+		py.Assign("rootPath", py.Raw("os.path.dirname(os.path.abspath(__file__))")),
+		py.Assign("pop", py.Rawf("toolbox.population(n=%d)", gp.PopulationSize)),
+		py.Assign("hof", hof),
+		gp.setupStats(),
+		py.Blank,
+		py.Assign("N", py.Int(gp.IndividualSize)),
+		stop,
+		gp.callAlgo(),
+		saveResults("hof[0]", gp.Termination != nil),
+		gp.setupLogs(),
+		pareto,
+		py.Blank,
+		gp.createPlots(),
+	}
+}
+
+// Snippets returns the user-supplied Python in gp, keyed by request field,
+// for the code policy. realFunction is evaluated as an expression.
+func (gp *GP) Snippets() map[string]string {
+	snippets := map[string]string{"realFunction": gp.RealFunction}
+	for i, p := range gp.Primitives {
+		snippets[fmt.Sprintf("primitives[%d].code", i)] = p.Code
+	}
+	return snippets
 }
 
-func (gp *GP) Code() (string, error) {
-	if err := gp.validate(); err != nil {
-		return "", err
-	}
-
-	var code string
-	code += gp.imports() + "\n\n"
-	code += gp.evalFunction() + "\n\n"
-
-	code += "toolbox = base.Toolbox()\n"
-	code += "pset = gp.PrimitiveSet('MAIN', 1)\n\n"
-
-	code += "def protectedDiv(left, right):\n"
-	code += "\ttry:\n"
-	code += "\t\treturn left / right\n"
-	code += "\texcept ZeroDivisionError:\n"
-	code += "\t\treturn 1\n\n"
-
-	code += "def lf(x):\n"
-	code += "\treturn 1 / (1 + numpy.exp(-x))\n\n"
-
-	code += gp.addPrimitivesToPSET() + "\n\n"
-	code += "pset.addEphemeralConstant('rand101', partial(random.randint, -1, 1))\n"
-	code += gp.renameArgs() + "\n"
-
-	weights := strings.ReplaceAll(strings.ReplaceAll(fmt.Sprintf("%f", gp.Weights), "[", "("), "]", ",)")
-	code += fmt.Sprintf("creator.create('Fitness', base.Fitness, weights=%s)\n", weights)
-	code += "creator.create('Individual', gp.PrimitiveTree, fitness=creator.Fitness)\n\n"
-
-	code += fmt.Sprintf("toolbox.register('expr', gp.%s, pset=pset, min_=%d, max_=%d)\n", gp.Expr, gp.Min, gp.Max)
-	code += fmt.Sprintf("toolbox.register('individual', tools.%s, creator.Individual, toolbox.expr)\n", gp.IndividualFunction)
-	code += fmt.Sprintf("toolbox.register('population', tools.%s, list, toolbox.individual)\n", gp.PopulationFunction)
-	code += "toolbox.register('compile', gp.compile, pset=pset)\n\n"
-
-	code += fmt.Sprintf("toolbox.register('evaluate', evalSymbReg, points=[x / 10.0 for x in range(-10, 10)], realFunction=\"%v\")\n\n", gp.RealFunction)
-
-	code += gp.selectionFunction() + "\n"
-	code += gp.crossoverFunction() + "\n"
-	code += fmt.Sprintf("toolbox.register('expr_mut', gp.%s, min_=%d, max_=%d)\n", gp.ExprMut, gp.ExprMutMin, gp.ExprMutMax)
-	code += gp.mutationFunction() + "\n"
-	code += gp.bloatControl() + "\n"
-	code += "toolbox.register('map', futures.map)\n"
-
-	code += "def main():\n"
-	code += "\trootPath = os.path.dirname(os.path.abspath(__file__))\n"
-	code += "\trandom.seed(318)\n"
-	code += fmt.Sprintf("\tpop = toolbox.population(n=%d)\n", gp.PopulationSize)
-	code += fmt.Sprintf("\thof = tools.HallOfFame(%d)\n", gp.HofSize)
-	code += gp.setupStats() + "\n"
-	code += "\tN = " + fmt.Sprintf("%d", gp.IndividualSize) + "\n"
-	code += gp.callAlgo() + "\n"
-	code += gp.setupLogs() + "\n"
-	code += gp.createPlots() + "\n"
-
-	code += "\n\n"
-	code += "if __name__ == '__main__':\n"
-	code += "\tmain()\n"
-
-	return code, nil
+func (gp *GP) Metadata() RunMetadata {
+	return RunMetadata{Name: fmt.Sprintf("%d-%d", gp.Generations, gp.PopulationSize), Description: "Genetic Programming (GP)", Seed: *gp.Seed}
+}
+
+func (gp *GP) Command() string {
+	return "python -m scoop code.py"
+}
+
+// Artifacts returns DatasetFile when the run fits a dataset.
+func (gp *GP) Artifacts() ([]Artifact, error) {
+	if gp.Dataset == nil {
+		return nil, nil
+	}
+	table, err := gp.Dataset.table(gp.ArgNames)
+	if err != nil {
+		return nil, err
+	}
+	return []Artifact{{Name: "dataset", Extension: "csv", Data: table}}, nil
 }
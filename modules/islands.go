@@ -0,0 +1,103 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Islands splits the run into Count subpopulations of PopulationSize that
+// evolve independently and exchange Migrants individuals every Interval
+// generations. The ring topology sends island i's emigrants to island i+1;
+// a custom topology sends them to MigArray[i].
+type Islands struct {
+	Count       int    `json:"count"`
+	Topology    string `json:"topology,omitempty"`    // "ring" (default) or "custom".
+	MigArray    []int  `json:"migArray,omitempty"`    // custom: destination island of each island.
+	Interval    int    `json:"interval"`              // Generations between migrations.
+	Migrants    int    `json:"migrants"`              // Individuals sent by each island.
+	Selection   string `json:"selection,omitempty"`   // Chooses the emigrants, "selBest" (default) or "selRandom".
+	Replacement string `json:"replacement,omitempty"` // Chooses who they replace, "selWorst", "selRandom" or "" for the emigrants themselves.
+}
+
+var (
+	islandTopologies   = []string{"ring", "custom"}
+	islandSelections   = []string{"selBest", "selRandom"}
+	islandReplacements = []string{"selWorst", "selRandom"}
+)
+
+const maxIslands = 100
+
+func (i *Islands) validate(v *util.ValidationError, algorithm string, populationSize int, generations int) {
+	if i.Topology == "" {
+		i.Topology = "ring"
+	}
+	if i.Selection == "" {
+		i.Selection = "selBest"
+	}
+
+	v.Relation("algorithm", slices.Contains(evolveAlgorithms, algorithm), fmt.Sprintf("must be one of %s to use islands", strings.Join(evolveAlgorithms, ", ")))
+	v.IntRange("islands.count", i.Count, 2, maxIslands)
+	v.IntRange("islands.interval", i.Interval, 1, max(generations, 1))
+	v.IntRange("islands.migrants", i.Migrants, 1, max(populationSize, 1))
+	v.OneOf("islands.selection", i.Selection, islandSelections)
+	if i.Replacement != "" {
+		v.OneOf("islands.replacement", i.Replacement, islandReplacements)
+	}
+
+	if v.OneOf("islands.topology", i.Topology, islandTopologies) && i.Topology == "custom" {
+		// Every island must receive migrants from exactly one other island.
+		v.Relation("islands.migArray", isPermutation(i.MigArray, i.Count), fmt.Sprintf("must be a permutation of 0..%d", i.Count-1))
+	}
+}
+
+// islandsSchema describes the island model validate checks.
+func islandsSchema(s *Schema) {
+	i := s.at("islands").describe("Island model; populationSize is the size of each island. Only for eaSimple, eaMuPlusLambda and eaMuCommaLambda.")
+	i.at("count").between(2, maxIslands).describe("Number of islands.")
+	i.at("topology").enum(orEmpty(islandTopologies)).withDefault("ring").describe("ring sends the emigrants of island i to island i+1, custom to migArray[i].")
+	i.at("migArray").describe("custom: destination island of each island, a permutation of 0..count-1.")
+	i.at("interval").atLeast(1).describe("Generations between migrations, at most generations.")
+	i.at("migrants").atLeast(1).describe("Individuals sent by each island, at most populationSize.")
+	i.at("selection").enum(orEmpty(islandSelections)).withDefault("selBest").describe("Chooses the emigrants.")
+	i.at("replacement").enum(orEmpty(islandReplacements)).describe("Chooses who the immigrants replace, the emigrants themselves when empty.")
+	i.require("count", "interval", "migrants")
+}
+
+// isPermutation reports whether values holds each of 0..n-1 exactly once.
+func isPermutation(values []int, n int) bool {
+	if len(values) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, value := range values {
+		if value < 0 || value >= n || seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// args adds the migration keyword arguments of evolve_islands to c.
+func (i *Islands) args(c *py.CallExpr) *py.CallExpr {
+	replacement := py.None
+	if i.Replacement != "" {
+		replacement = py.Raw("tools." + i.Replacement)
+	}
+	migarray := py.None
+	if i.Topology == "custom" {
+		values := make([]py.Expr, len(i.MigArray))
+		for j, value := range i.MigArray {
+			values[j] = py.Int(value)
+		}
+		migarray = py.List(values...)
+	}
+	return c.Kw("migration_interval", py.Int(i.Interval)).
+		Kw("migrants", py.Int(i.Migrants)).
+		Kw("emigrants", py.Raw("tools."+i.Selection)).
+		Kw("replacement", replacement).
+		Kw("migarray", migarray)
+}
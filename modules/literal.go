@@ -0,0 +1,74 @@
+package modules
+
+import (
+	"evolve/util"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+)
+
+// Python keywords, which cannot be used as identifiers.
+var pythonKeywords = []string{
+	"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue",
+	"def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in",
+	"is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield",
+}
+
+// Python builtins, the names of dir(builtins), which generated code expects
+// to find unshadowed.
+var pythonBuiltins = []string{
+	"ArithmeticError", "AssertionError", "AttributeError", "BaseException", "BaseExceptionGroup",
+	"BlockingIOError", "BrokenPipeError", "BufferError", "BytesWarning", "ChildProcessError",
+	"ConnectionAbortedError", "ConnectionError", "ConnectionRefusedError", "ConnectionResetError",
+	"DeprecationWarning", "EOFError", "Ellipsis", "EncodingWarning", "EnvironmentError", "Exception",
+	"ExceptionGroup", "False", "FileExistsError", "FileNotFoundError", "FloatingPointError",
+	"FutureWarning", "GeneratorExit", "IOError", "ImportError", "ImportWarning", "IndentationError",
+	"IndexError", "InterruptedError", "IsADirectoryError", "KeyError", "KeyboardInterrupt",
+	"LookupError", "MemoryError", "ModuleNotFoundError", "NameError", "None", "NotADirectoryError",
+	"NotImplemented", "NotImplementedError", "OSError", "OverflowError", "PendingDeprecationWarning",
+	"PermissionError", "ProcessLookupError", "RecursionError", "ReferenceError", "ResourceWarning",
+	"RuntimeError", "RuntimeWarning", "StopAsyncIteration", "StopIteration", "SyntaxError",
+	"SyntaxWarning", "SystemError", "SystemExit", "TabError", "TimeoutError", "True", "TypeError",
+	"UnboundLocalError", "UnicodeDecodeError", "UnicodeEncodeError", "UnicodeError",
+	"UnicodeTranslateError", "UnicodeWarning", "UserWarning", "ValueError", "Warning",
+	"ZeroDivisionError", "__build_class__", "__debug__", "__doc__", "__import__", "__loader__",
+	"__name__", "__package__", "__spec__", "abs", "aiter", "all", "anext", "any", "ascii", "bin",
+	"bool", "breakpoint", "bytearray", "bytes", "callable", "chr", "classmethod", "compile",
+	"complex", "copyright", "credits", "delattr", "dict", "dir", "divmod", "enumerate", "eval",
+	"exec", "exit", "filter", "float", "format", "frozenset", "getattr", "globals", "hasattr", "hash",
+	"help", "hex", "id", "input", "int", "isinstance", "issubclass", "iter", "len", "license", "list",
+	"locals", "map", "max", "memoryview", "min", "next", "object", "oct", "open", "ord", "pow",
+	"print", "property", "quit", "range", "repr", "reversed", "round", "set", "setattr", "slice",
+	"sorted", "staticmethod", "str", "sum", "super", "tuple", "type", "vars", "zip",
+}
+
+// Longest identifier accepted for names taken from a request.
+const maxIdentifierLength = 64
+
+// isIdentifier reports whether name is an ASCII Python identifier that is
+// not a keyword.
+func isIdentifier(name string) bool {
+	if name == "" || len(name) > maxIdentifierLength || !utf8.ValidString(name) || slices.Contains(pythonKeywords, name) {
+		return false
+	}
+	for i, r := range name {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateIdentifier checks a name that becomes a Python identifier.
+func validateIdentifier(v *util.ValidationError, field string, name string) bool {
+	if isIdentifier(name) {
+		return true
+	}
+	v.Add(util.FieldError{
+		Field:   field,
+		Rule:    util.RuleIdentifier,
+		Message: fmt.Sprintf("must be a Python identifier of at most %d characters: letters, digits and underscores, not starting with a digit, and not a keyword", maxIdentifierLength),
+	})
+	return false
+}
@@ -0,0 +1,28 @@
+package modules
+
+import (
+	"evolve/util"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func FuzzIsIdentifier(f *testing.F) {
+	for _, name := range []string{"", "x", "_", "mutate2", "2fast", "for", "None", "none", "a-b", "é", "a b", "ab\x00", "\xff", "x_1_y"} {
+		f.Add(name)
+	}
+	f.Add(string(make([]byte, maxIdentifierLength+1)))
+
+	identifier := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	f.Fuzz(func(t *testing.T, name string) {
+		want := identifier.MatchString(name) && len(name) <= maxIdentifierLength && !slices.Contains(pythonKeywords, name)
+		if got := isIdentifier(name); got != want {
+			t.Fatalf("isIdentifier(%q) = %v, want %v", name, got, want)
+		}
+
+		v := &util.ValidationError{}
+		if got := validateIdentifier(v, "name", name); got != want || (len(v.Fields) == 0) != want {
+			t.Fatalf("validateIdentifier(%q) = %v with errors %v, want %v", name, got, v.Fields, want)
+		}
+	})
+}
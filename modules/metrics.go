@@ -0,0 +1,75 @@
+package modules
+
+import "evolve/modules/py"
+
+// MetricPrefix starts the JSON metrics line the generated code prints once
+// per generation. The SSE handler sends these lines as metric events.
+const MetricPrefix = "@@METRIC "
+
+// ResultsFile holds the outcome of a run: the best fitness, the metrics of
+// every generation and, with a Termination, the stop reason.
+const ResultsFile = "results.json"
+
+// metricsFunction renders emit_metrics, which prints the metrics of a
+// generation: gen, evals, avg, min, max and std of the fitness (one value
+// per objective in multi-objective runs), diversity and, with a single
+// objective, the fitness of the best individual so far. Diversity is the
+// mean distance to the centroid, or the share of distinct trees in GP. The
+// metrics are kept for save_results, which writes ResultsFile.
+func metricsFunction() py.Stmt {
+	return py.Block{
+		py.Source(`
+			def diversity(population):
+				try:
+					points = numpy.array([list(ind) for ind in population], dtype=float)
+				except (TypeError, ValueError):
+					return len({str(ind) for ind in population}) / len(population)
+				return float(numpy.mean(numpy.linalg.norm(points - points.mean(axis=0), axis=1)))
+		`),
+		py.Assign("metric_history", py.List()),
+		py.Def("emit_metrics(gen, evals, population, best=None)",
+			py.Source(`
+				fitnesses = numpy.array([ind.fitness.values for ind in population], dtype=float)
+				def summary(values):
+					values = values.tolist()
+					return values[0] if len(values) == 1 else values
+				record = {
+					'gen': gen,
+					'evals': evals,
+					'avg': summary(fitnesses.mean(axis=0)),
+					'min': summary(fitnesses.min(axis=0)),
+					'max': summary(fitnesses.max(axis=0)),
+					'std': summary(fitnesses.std(axis=0)),
+					'diversity': diversity(population),
+					'best': best.fitness.values[0] if best is not None and fitnesses.shape[1] == 1 else None,
+				}
+				metric_history.append(record)
+			`),
+			py.Do(py.Call("print", py.Rawf("%s + json.dumps(record)", py.Str(MetricPrefix))).Kw("flush", py.Raw("True"))),
+		),
+		py.Source(`
+			def save_results(path, best, stop=None):
+				results = {
+					'best': list(best.fitness.values) if best is not None else None,
+					'generations': metric_history[-1]['gen'] if metric_history else 0,
+					'evaluations': sum(record['evals'] for record in metric_history),
+					'metrics': metric_history,
+				}
+				if stop is not None:
+					results.update(stop.finish())
+				with open(path, 'w') as f:
+					json.dump(results, f, indent=2)
+		`),
+	}
+}
+
+// saveResults renders the call that writes ResultsFile, in main. best is
+// the Python expression of the best individual, or None. With stop set the
+// stop reason of the Termination object stop is included.
+func saveResults(best string, stop bool) py.Stmt {
+	termination := py.None
+	if stop {
+		termination = py.Raw("stop")
+	}
+	return py.Do(py.Call("save_results", scriptPath(ResultsFile), py.Raw(best)).Kw("stop", termination))
+}
@@ -2,8 +2,10 @@ package modules
 
 import (
 	"encoding/json"
+	"evolve/modules/py"
 	"evolve/util"
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -27,6 +29,22 @@ type EAML struct {
 	Mu                       int       `json:"mu,omitempty"`
 	Lambda                   int       `json:"lambda_,omitempty"`
 	HofSize                  int       `json:"hofSize,omitempty"`
+
+	// CMA-ES strategy for eaGenerateUpdate.
+	CMA *CMAES `json:"cma,omitempty"`
+
+	// Seed for random and numpy.random, drawn when omitted.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Save a checkpoint every N generations, 0 disables checkpoints.
+	CheckpointEvery int `json:"checkpointEvery,omitempty"`
+
+	// Rules that end the run before Generations.
+	Termination *Termination `json:"termination,omitempty"`
+}
+
+func init() {
+	RegisterGenerator("ml", func(data map[string]any) (Generator, error) { return MLFromJSON(data) }, mlSchema())
 }
 
 func MLFromJSON(jsonData map[string]any) (*EAML, error) {
@@ -42,156 +60,268 @@ func MLFromJSON(jsonData map[string]any) (*EAML, error) {
 	return ml, nil
 }
 
-func (ml *EAML) validate() error {
-	if err := util.ValidateAlgorithmName(ml.Algorithm); err != nil {
-		return err
+var (
+	mlAlgorithms         = []string{"eaSimple", "eaMuPlusLambda", "eaMuCommaLambda", "eaGenerateUpdate"}
+	mlCrossoverFunctions = []string{"cxOnePoint", "cxTwoPoint"}
+	mlMutationFunctions  = []string{"mutFlipBit", "mutShuffleIndexes"}
+)
+
+func (ml *EAML) Validate() error {
+	v := &util.ValidationError{}
+	ml.Seed = resolveSeed(v, ml.Seed)
+	v.OneOf("algorithm", ml.Algorithm, mlAlgorithms)
+
+	v.Required("mlEvalFunctionCodeString", ml.MlEvalFunctionCodeString)
+	if v.Required("googleDriveUrl", ml.GoogleDriveUrl) {
+		// The download helper takes the file ID from the second to last path segment.
+		v.Relation("googleDriveUrl", strings.HasPrefix(ml.GoogleDriveUrl, "https://drive.google.com/") && strings.Count(ml.GoogleDriveUrl, "/") >= 4, "must be a Google Drive share link")
 	}
-	// TODO: Validate remaining fields.
-	return nil
-}
+	v.Required("sep", ml.Sep)
+	validateIdentifier(v, "targetColumnName", ml.TargetColumnName)
 
-func (ml *EAML) imports() string {
-	return strings.Join([]string{
-		"# DEAP imports",
-		"import random, os",
-		"from deap import base, creator, tools, algorithms",
-		"import numpy",
-		"import matplotlib.pyplot as plt",
-		"from functools import reduce",
-		"from scoop import futures",
-		"import pandas as pd",
-		"import warnings",
-		"warnings.filterwarnings(\"ignore\")",
-		"# ML imports",
-		ml.MlImportCodeString,
-	}, "\n")
+	validateRun(v, ml.PopulationSize, ml.Generations, ml.Cxpb, ml.Mutpb)
+	validateWeights(v, ml.Weights, maxObjectives)
+	v.FloatRange("indpb", ml.Indpb, 0, 1)
+	v.OneOf("crossoverFunction", ml.CrossoverFunction, mlCrossoverFunctions)
+	v.OneOf("mutationFunction", ml.MutationFunction, mlMutationFunctions)
+	validateHof(v, ml.HofSize, ml.PopulationSize)
+	validateSelection(v, ml.SelectionFunction, ml.TournamentSize, ml.PopulationSize, false)
+	validateMuLambda(v, ml.Algorithm, ml.Mu, ml.Lambda, ml.Cxpb, ml.Mutpb)
+	validateCheckpoint(v, ml.CheckpointEvery, ml.Algorithm, ml.Generations)
+	if ml.Algorithm == "eaGenerateUpdate" {
+		// The number of columns is only known once the dataset is loaded.
+		if ml.CMA == nil {
+			ml.CMA = &CMAES{}
+		}
+		ml.CMA.applyDefaults(5.0, 5.0)
+		ml.CMA.validate(v, 0)
+	}
+	if ml.Termination != nil {
+		ml.Termination.validate(v, ml.Weights, ml.Generations)
+	}
+	return v.Err()
 }
 
-func (ml *EAML) googleDriveDownloadFunc() string {
-	return strings.Join([]string{
-		"def download_csv_from_google_drive_share_link(url):",
-		"\tfile_id = url.split(\"/\")[-2]",
-		"\tdwn_url = \"https://drive.google.com/uc?export=download&id=\" + file_id",
-		"\treturn pd.read_csv(dwn_url, sep=\"" + ml.Sep + "\")\n",
-	}, "\n")
+// mlSchema describes the EAML config.
+func mlSchema() *Schema {
+	s := configSchema[EAML]("Optimize ML with EA", "A DEAP evolutionary algorithm that evolves a machine learning model on a dataset.")
+	s.at("algorithm").enum(mlAlgorithms).describe("Algorithm to run.")
+	s.at("mlEvalFunctionCodeString").nonEmpty().describe("Python code defining the evaluation of an individual on the dataset.")
+	s.at("googleDriveUrl").pattern(`^https://drive\.google\.com/`).describe("Google Drive share link of the dataset.")
+	s.at("sep").nonEmpty().describe("Column separator of the dataset.")
+	s.at("mlImportCodeString").describe("Python imports of the evaluation code.")
+	s.at("targetColumnName").length(1, maxIdentifierLength).pattern(`^[A-Za-z_][A-Za-z0-9_]*$`).describe("Column to predict.")
+	s.at("indpb").between(0, 1).describe("Independent probability for each attribute to be mutated.")
+	s.at("crossoverFunction").enum(mlCrossoverFunctions).describe("Crossover operator.")
+	s.at("mutationFunction").enum(mlMutationFunctions).describe("Mutation operator.")
+	s.require("algorithm", "mlEvalFunctionCodeString", "googleDriveUrl", "sep", "targetColumnName",
+		"crossoverFunction", "mutationFunction")
+	runSchema(s)
+	weightsSchema(s, maxObjectives)
+	hofSchema(s)
+	selectionSchema(s, &Schema{}, false)
+	muLambdaSchema(s)
+	cmaSchema(s)
+	checkpointSchema(s)
+	terminationSchema(s)
+	return s
 }
 
-func (ml *EAML) selectionFunction() string {
-	// TODO: Add support for other selection functions.
-	switch ml.SelectionFunction {
-	case "selTournament":
-		return fmt.Sprintf("toolbox.register('select', tools.%s, tournsize=%d)\n", ml.SelectionFunction, ml.TournamentSize)
-	default:
-		return fmt.Sprintf("toolbox.register('select', tools.%s)\n", ml.SelectionFunction)
+func (ml *EAML) imports() py.Stmt {
+	return py.Block{
+		py.Section(SectionImports,
+			py.Comment("DEAP imports"),
+			py.Import("random, os, math, pickle, json, time"),
+			py.From("deap", "base, creator, tools, algorithms, cma"),
+			py.Import("numpy"),
+			py.Import("matplotlib.pyplot as plt"),
+			py.From("functools", "reduce"),
+			py.From("scoop", "futures"),
+			py.Import("pandas as pd"),
+			py.Import("warnings"),
+			py.Do(py.Call("warnings.filterwarnings", py.Str("ignore"))),
+		),
+		py.Comment("ML imports"),
+		py.Source(ml.MlImportCodeString),
 	}
 }
 
-func (ml *EAML) callAlgo() string {
-	switch ml.Algorithm {
-	case "eaSimple":
-		return "\tpop, logbook = algorithms.eaSimple(pop, toolbox, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
+func (ml *EAML) googleDriveDownloadFunc() py.Stmt {
+	return py.Def("download_csv_from_google_drive_share_link(url)",
+		py.Assign("file_id", py.Raw(`url.split("/")[-2]`)),
+		py.Assign("dwn_url", py.Rawf("%s + file_id", py.Str("https://drive.google.com/uc?export=download&id="))),
+		py.Return(py.Call("pd.read_csv", py.Raw("dwn_url")).Kw("sep", py.Str(ml.Sep))),
+	)
+}
 
-	case "eaMuPlusLambda":
-		return fmt.Sprintf("\tmu = %d\n", ml.Mu) + fmt.Sprintf("\tlambda_ = %d\n", ml.Lambda) + "\tpop, logbook = algorithms.eaMuPlusLambda(pop, toolbox, mu=mu, lambda_=lambda_, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
+func (ml *EAML) selectionFunction() py.Stmt {
+	// TODO: Add support for other selection functions.
+	c := py.Call("toolbox.register", py.Str("select"), py.Raw("tools."+ml.SelectionFunction))
+	if ml.SelectionFunction == "selTournament" {
+		c.Kw("tournsize", py.Int(ml.TournamentSize))
+	}
+	return py.Do(c)
+}
 
-	case "eaMuCommaLambda":
-		return fmt.Sprintf("\tmu = %d\n", ml.Mu) + fmt.Sprintf("\tlambda_ = %d\n", ml.Lambda) + "\tpop, logbook = algorithms.eaMuCommaLambda(pop, toolbox, mu=mu, lambda_=lambda_, cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
+// usesEvolveLoop reports whether the run uses evolve. Unlike DEAP's
+// algorithms it prints the metrics of every generation.
+func (ml *EAML) usesEvolveLoop() bool {
+	return slices.Contains(evolveAlgorithms, ml.Algorithm)
+}
 
-	case "eaGenerateUpdate":
-		return "\tnumpy.random.seed(128)\n" + fmt.Sprintf("\tstrategy = cma.Strategy(centroid=[5.0]*len(X.columns), sigma=5.0, lambda_=%d*len(X.columns))\n", ml.Lambda) + "\ttoolbox.register(\"generate\", strategy.generate, creator.Individual)\n" + "\ttoolbox.register(\"update\", strategy.update)\n" + "\tpop, logbook = algorithms.eaGenerateUpdate(toolbox, ngen=generations, stats=stats, halloffame=hof, verbose=True)\n"
+func (ml *EAML) callAlgo() py.Stmt {
+	if ml.usesEvolveLoop() {
+		return evolveLoop{Algorithm: ml.Algorithm, Mu: ml.Mu, Lambda: ml.Lambda, Cxpb: py.Raw("cxpb"), Mutpb: py.Raw("mutpb"), Ngen: py.Raw("generations"), Stats: "stats", CheckpointEvery: ml.CheckpointEvery, Stop: ml.Termination != nil}.call()
+	}
 
-	default:
-		return ""
+	return py.Block{
+		py.Assign("centroid", ml.CMA.centroidExpr("len(X.columns)")),
+		py.If("len(centroid) != len(X.columns)",
+			py.Line(`raise ValueError(f"cma.centroid has {len(centroid)} values but the dataset has {len(X.columns)} feature columns")`),
+		),
+		ml.CMA.callAlgo(py.Raw("centroid"), "stats", ml.Termination != nil),
 	}
 }
 
-func (ml *EAML) createPlots() string {
-	return strings.Join([]string{
-		"\n\n",
-		"\tgen = logbook.select(\"gen\")",
-		"\tavg = logbook.select(\"avg\")",
-		"\tmin_ = logbook.select(\"min\")",
-		"\tmax_ = logbook.select(\"max\")\n",
+func (ml *EAML) createPlots() py.Stmt {
+	return py.Block{
+		py.Source(`
+			gen = logbook.select("gen")
+			avg = logbook.select("avg")
+			min_ = logbook.select("min")
+			max_ = logbook.select("max")
+		`),
+		py.Blank,
 
 		// Save LogBook as .log.
-		"\twith open(f\"{rootPath}/logbook.txt\", \"w\") as f:",
-		"\t\tf.write(str(logbook))",
-		"\n",
+		py.With(`open(f"{rootPath}/logbook.txt", "w") as f`, py.Line("f.write(str(logbook))")),
+		py.Blank,
 
 		// Save fitness plot.
-		"\tplt.plot(gen, avg, label=\"average\")",
-		"\tplt.plot(gen, min_, label=\"minimum\")",
-		"\tplt.plot(gen, max_, label=\"maximum\")",
-		"\tplt.xlabel(\"Generation\")",
-		"\tplt.ylabel(\"Fitness\")",
-		"\tplt.legend(loc=\"lower right\")",
-		"\tplt.savefig(f\"{rootPath}/fitness_plot.png\", dpi=300)",
-		"\tplt.close()",
-	}, "\n")
-}
-
-func (ml *EAML) Code() (string, error) {
-	if err := ml.validate(); err != nil {
-		return "", err
-	}
-
-	var code string
-	code += ml.imports() + "\n"
-	code += ml.googleDriveDownloadFunc() + "\n"
-	code += ml.MlEvalFunctionCodeString + "\n"
-
-	code += "toolbox = base.Toolbox()\n\n"
-	code += "toolbox.register(\"mate\", tools." + ml.CrossoverFunction + ")\n"
-	code += fmt.Sprintf("toolbox.register(\"mutate\", tools.%v, indpb=%v)\n", ml.MutationFunction, ml.Indpb)
-	code += ml.selectionFunction() + "\n"
-	code += "\ntoolbox.register(\"map\", futures.map)\n\n"
-
-	weights := strings.ReplaceAll(strings.ReplaceAll(fmt.Sprintf("%f", ml.Weights), "[", "("), "]", ",)")
-	code += strings.Join([]string{
-		"def main():",
-		"\trootPath = os.path.dirname(os.path.abspath(__file__))",
-		fmt.Sprintf("\turl = \"%s\"", ml.GoogleDriveUrl),
-		"\tdf = download_csv_from_google_drive_share_link(url)",
-		fmt.Sprintf("\ttarget = \"%s\"", ml.TargetColumnName),
-		"\tX = df.drop(target, axis=1)",
-		"\ty = df[target]",
-		"\taccuracy = mlEvalFunction([1 for _ in range(len(X.columns))], X, y)",
-		fmt.Sprintf("\tcreator.create(\"FitnessMax\", base.Fitness, weights=%v)", weights),
-		"\tcreator.create(\"Individual\", list, fitness=creator.FitnessMax)",
-		"\ttoolbox.register(\"attr\", random.randint, 0, 1)",
-	}, "\n") + "\n"
-
-	code += "\ttoolbox.register(\"individual\", tools.initRepeat, creator.Individual, toolbox.attr, n=len(X.columns))\n"
-	code += "\ttoolbox.register(\"population\", tools.initRepeat, list, toolbox.individual)\n"
-
-	code += "\ttoolbox.register(\"evaluate\", mlEvalFunction, X=X, y=y)\n"
-
-	code += fmt.Sprintf("\tpopulationSize = %d\n", ml.PopulationSize)
-	code += fmt.Sprintf("\tgenerations = %d\n", ml.Generations)
-	code += fmt.Sprintf("\tcxpb = %v\n", ml.Cxpb)
-	code += fmt.Sprintf("\tmutpb = %v\n", ml.Mutpb)
-	code += "\tN = len(X.columns)\n"
-	code += fmt.Sprintf("\thofSize = %d\n", ml.HofSize)
-	code += "\n\tpop = toolbox.population(n=populationSize)\n"
-	code += "\thof = tools.HallOfFame(hofSize)\n"
-	code += "\n\tstats = tools.Statistics(lambda ind: ind.fitness.values)\n"
-	code += "\tstats.register(\"avg\", numpy.mean)\n"
-	code += "\tstats.register(\"min\", numpy.min)\n"
-	code += "\tstats.register(\"max\", numpy.max)\n"
-
-	code += ml.callAlgo()
-	code += "\tout_file = open(f\"{rootPath}/best.txt\", \"w\")\n"
-	code += "\tout_file.write(f\"Before applying EA: {accuracy}\\n\")\n"
-	code += "\tout_file.write(f\"Best individual is:\\n{hof[0]}\\nwith fitness: {hof[0].fitness}\\n\")\n"
-	code += "\tbest_columns = [i for i in range(len(hof[0])) if hof[0][i] == 1]\n"
-	code += "\tbest_column_names = X.columns[best_columns]\n"
-	code += "\tout_file.write(f\"\\nBest individual columns:\\n{best_column_names.values}\")\n"
-	code += "\tout_file.close()\n"
-
-	code += ml.createPlots()
-	code += "\n\n"
-	code += "if __name__ == '__main__':\n"
-	code += "\tmain()\n"
-
-	return code, nil
+		py.Section(SectionPlots, py.Source(`
+			plt.plot(gen, avg, label="average")
+			plt.plot(gen, min_, label="minimum")
+			plt.plot(gen, max_, label="maximum")
+			plt.xlabel("Generation")
+			plt.ylabel("Fitness")
+			plt.legend(loc="lower right")
+			plt.savefig(f"{rootPath}/fitness_plot.png", dpi=300)
+			plt.close()
+		`)),
+	}
+}
+
+func (ml *EAML) Code() (py.Module, error) {
+	if err := ml.Validate(); err != nil {
+		return nil, err
+	}
+	return ml.script(), nil
+}
+
+// script generates the code of a validated EAML.
+func (ml *EAML) script() py.Module {
+	code := py.Module{
+		ml.imports(),
+		seedCode(*ml.Seed),
+		ml.googleDriveDownloadFunc(),
+		py.Source(ml.MlEvalFunctionCodeString),
+	}
+	if ml.Algorithm == "eaGenerateUpdate" {
+		code = append(code, ml.CMA.runFunction())
+	}
+	if ml.Termination != nil {
+		code = append(code, terminationClass())
+	}
+	code = append(code, metricsFunction())
+	if ml.usesEvolveLoop() {
+		code = append(code, evolveFunction())
+	}
+
+	code = append(code,
+		py.Assign("toolbox", py.Raw("base.Toolbox()")),
+		py.Blank,
+		py.Do(py.Call("toolbox.register", py.Str("mate"), py.Raw("tools."+ml.CrossoverFunction))),
+		py.Do(py.Call("toolbox.register", py.Str("mutate"), py.Raw("tools."+ml.MutationFunction)).Kw("indpb", py.Float(ml.Indpb))),
+		ml.selectionFunction(),
+		py.Blank,
+		py.Do(py.Call("toolbox.register", py.Str("map"), py.Raw("futures.map"))),
+		py.Def("main()", ml.main()),
+		mainGuard,
+	)
+	return code
+}
+
+// main is the body of main(): it loads the dataset, runs the algorithm and
+// writes its outputs.
+func (ml *EAML) main() py.Stmt {
+	var stop py.Stmt
+	if ml.Termination != nil {
+		stop = ml.Termination.instance(py.Raw("generations"), ml.Weights)
+	}
+	return py.Block{
+		py.Assign("rootPath", py.Raw("os.path.dirname(os.path.abspath(__file__))")),
+		py.Assign("url", py.Str(ml.GoogleDriveUrl)),
+		py.Assign("df", py.Raw("download_csv_from_google_drive_share_link(url)")),
+		py.Assign("target", py.Str(ml.TargetColumnName)),
+		py.Assign("X", py.Raw("df.drop(target, axis=1)")),
+		py.Assign("y", py.Raw("df[target]")),
+		py.Assign("accuracy", py.Raw("mlEvalFunction([1 for _ in range(len(X.columns))], X, y)")),
+		py.Do(py.Call("creator.create", py.Str("FitnessMax"), py.Raw("base.Fitness")).Kw("weights", py.Tuple(py.Floats(ml.Weights)...))),
+		py.Do(py.Call("creator.create", py.Str("Individual"), py.Raw("list")).Kw("fitness", py.Raw("creator.FitnessMax"))),
+		py.Do(py.Call("toolbox.register", py.Str("attr"), py.Raw("random.randint"), py.Int(0), py.Int(1))),
+		py.Do(py.Call("toolbox.register", py.Str("individual"), py.Raw("tools.initRepeat"), py.Raw("creator.Individual"), py.Raw("toolbox.attr")).Kw("n", py.Raw("len(X.columns)"))),
+		py.Do(py.Call("toolbox.register", py.Str("population"), py.Raw("tools.initRepeat"), py.Raw("list"), py.Raw("toolbox.individual"))),
+		py.Do(py.Call("toolbox.register", py.Str("evaluate"), py.Raw("mlEvalFunction")).Kw("X", py.Raw("X")).Kw("y", py.Raw("y"))),
+
+		py.Assign("populationSize", py.Int(ml.PopulationSize)),
+		py.Assign("generations", py.Int(ml.Generations)),
+		py.Assign("cxpb", py.Float(ml.Cxpb)),
+		py.Assign("mutpb", py.Float(ml.Mutpb)),
+		py.Assign("N", py.Raw("len(X.columns)")),
+		py.Assign("hofSize", py.Int(ml.HofSize)),
+		py.Blank,
+		py.Assign("pop", py.Raw("toolbox.population(n=populationSize)")),
+		py.Assign("hof", py.Raw("tools.HallOfFame(hofSize)")),
+		py.Blank,
+		py.Assign("stats", py.Raw("tools.Statistics(lambda ind: ind.fitness.values)")),
+		py.Do(py.Call("stats.register", py.Str("avg"), py.Raw("numpy.mean"))),
+		py.Do(py.Call("stats.register", py.Str("min"), py.Raw("numpy.min"))),
+		py.Do(py.Call("stats.register", py.Str("max"), py.Raw("numpy.max"))),
+
+		stop,
+		ml.callAlgo(),
+		saveResults("hof[0]", ml.Termination != nil),
+		py.Source(`
+			out_file = open(f"{rootPath}/best.txt", "w")
+			out_file.write(f"Before applying EA: {accuracy}\n")
+			out_file.write(f"Best individual is:\n{hof[0]}\nwith fitness: {hof[0].fitness}\n")
+			best_columns = [i for i in range(len(hof[0])) if hof[0][i] == 1]
+			best_column_names = X.columns[best_columns]
+			out_file.write(f"\nBest individual columns:\n{best_column_names.values}")
+			out_file.close()
+		`),
+		py.Blank,
+		ml.createPlots(),
+	}
+}
+
+// Snippets returns the user-supplied Python in ml, keyed by request field,
+// for the code policy.
+func (ml *EAML) Snippets() map[string]string {
+	return map[string]string{
+		"mlEvalFunctionCodeString": ml.MlEvalFunctionCodeString,
+		"mlImportCodeString":       ml.MlImportCodeString,
+	}
+}
+
+func (ml *EAML) Metadata() RunMetadata {
+	return RunMetadata{Name: fmt.Sprintf("%d-%d", ml.Generations, ml.PopulationSize), Description: "Optimize ML with EA", Seed: *ml.Seed}
+}
+
+func (ml *EAML) Command() string {
+	return "python -m scoop code.py"
+}
+
+func (ml *EAML) Artifacts() ([]Artifact, error) {
+	return nil, nil
 }
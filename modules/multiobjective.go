@@ -0,0 +1,149 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MultiObjective enables Pareto-based selection for EA runs with more than
+// one objective. The number of objectives is len(EA.Weights).
+type MultiObjective struct {
+	Selection               string      `json:"selection"`                         // selNSGA2, selNSGA3 or selSPEA2.
+	ReferencePointDivisions int         `json:"referencePointDivisions,omitempty"` // NSGA-III: divisions of each objective axis.
+	ReferencePoints         [][]float64 `json:"referencePoints,omitempty"`         // NSGA-III: explicit points, overrides divisions.
+}
+
+const defaultReferencePointDivisions = 12
+
+var (
+	moSelectionFunctions = []string{"selNSGA2", "selNSGA3", "selSPEA2"}
+
+	// Pareto selection of len(population) individuals keeps them all, so it
+	// only selects when it picks mu of the parents and offspring.
+	moAlgorithms = []string{"eaMuPlusLambda", "eaMuCommaLambda"}
+
+	// Bi-objective benchmarks from deap.benchmarks.
+	moBenchmarks2 = []string{"zdt1", "zdt2", "zdt3", "zdt4", "zdt6", "kursawe", "fonseca", "poloni", "schaffer_mo"}
+	// Benchmarks that take the number of objectives as a parameter.
+	moBenchmarksN = []string{"dtlz1", "dtlz2", "dtlz3", "dtlz4"}
+)
+
+func (mo *MultiObjective) validate(v *util.ValidationError, ea *EA) {
+	nobj := len(ea.Weights)
+	v.Relation("weights", nobj != 1, "must have one entry per objective, at least 2 for multi-objective runs")
+	if slices.Contains(util.AlgorithmNames, ea.Algorithm) {
+		v.Relation("algorithm", slices.Contains(moAlgorithms, ea.Algorithm), fmt.Sprintf("must be one of %s for multi-objective runs", strings.Join(moAlgorithms, ", ")))
+	}
+
+	if v.OneOf("multiObjective.selection", mo.Selection, moSelectionFunctions) && mo.Selection == "selNSGA3" {
+		if len(mo.ReferencePoints) == 0 {
+			if mo.ReferencePointDivisions == 0 {
+				mo.ReferencePointDivisions = defaultReferencePointDivisions
+			}
+			v.IntRange("multiObjective.referencePointDivisions", mo.ReferencePointDivisions, 1, 100)
+		}
+		for i, point := range mo.ReferencePoints {
+			v.Length(fmt.Sprintf("multiObjective.referencePoints[%d]", i), len(point), nobj, nobj)
+		}
+	}
+
+	// A custom evaluation function must return one value per weight.
+	if ea.CustomEval != "" {
+		validateIdentifier(v, "evaluationFunction", ea.EvaluationFunction)
+		return
+	}
+	if slices.Contains(moBenchmarks2, ea.EvaluationFunction) {
+		v.Relation("weights", nobj == 2, fmt.Sprintf("%s has exactly 2 objectives", ea.EvaluationFunction))
+		return
+	}
+	v.OneOf("evaluationFunction", ea.EvaluationFunction, append(slices.Clone(moBenchmarks2), moBenchmarksN...))
+}
+
+// multiObjectiveSchema describes the Pareto selection validate checks.
+func multiObjectiveSchema(s *Schema) {
+	mo := s.at("multiObjective").describe("Pareto-based selection for more than one objective, one per weight. Only for eaMuPlusLambda and eaMuCommaLambda.")
+	mo.at("selection").enum(moSelectionFunctions).describe("Pareto selection function.")
+	mo.at("referencePointDivisions").between(0, 100).withDefault(defaultReferencePointDivisions).describe("selNSGA3: divisions of each objective axis.")
+	mo.at("referencePoints").describe("selNSGA3: explicit reference points with one value per objective, overrides referencePointDivisions.")
+	mo.require("selection")
+}
+
+// registerBenchmark points EA.EvaluationFunction at a multi-objective
+// benchmark. It reports false for custom evaluation functions.
+func (mo *MultiObjective) registerBenchmark(ea *EA) bool {
+	switch {
+	case slices.Contains(moBenchmarks2, ea.EvaluationFunction):
+		ea.EvaluationFunction = "benchmarks." + ea.EvaluationFunction
+		return true
+	case slices.Contains(moBenchmarksN, ea.EvaluationFunction):
+		ea.EvaluationFunction = fmt.Sprintf("partial(benchmarks.%s, obj=%d)", ea.EvaluationFunction, len(ea.Weights))
+		return true
+	default:
+		return false
+	}
+}
+
+func (mo *MultiObjective) selectionFunction(nobj int) py.Stmt {
+	if mo.Selection != "selNSGA3" {
+		return py.Do(py.Call("toolbox.register", py.Str("select"), py.Raw("tools."+mo.Selection)))
+	}
+
+	var points py.Expr
+	if len(mo.ReferencePoints) > 0 {
+		rows := make([]py.Expr, len(mo.ReferencePoints))
+		for i, point := range mo.ReferencePoints {
+			rows[i] = py.List(py.Floats(point)...)
+		}
+		points = py.Call("numpy.array", py.List(rows...))
+	} else {
+		points = py.Call("tools.uniform_reference_points", py.Int(nobj), py.Int(mo.ReferencePointDivisions))
+	}
+	return py.Block{
+		py.Assign("ref_points", points),
+		py.Do(py.Call("toolbox.register", py.Str("select"), py.Raw("tools.selNSGA3")).Kw("ref_points", py.Raw("ref_points"))),
+	}
+}
+
+// paretoOutputs writes the non-dominated front to pareto.json and plots it.
+// Fronts with more than three objectives are drawn as parallel coordinates.
+func (mo *MultiObjective) paretoOutputs(nobj int) py.Stmt {
+	var plot py.Stmt
+	switch nobj {
+	case 2:
+		plot = py.Source(`
+			plt.scatter(fitnesses[:, 0], fitnesses[:, 1], color="red")
+			plt.xlabel("Objective 1")
+			plt.ylabel("Objective 2")
+		`)
+	case 3:
+		plot = py.Source(`
+			ax = plt.figure().add_subplot(projection="3d")
+			ax.scatter(fitnesses[:, 0], fitnesses[:, 1], fitnesses[:, 2], color="red")
+			ax.set_xlabel("Objective 1")
+			ax.set_ylabel("Objective 2")
+			ax.set_zlabel("Objective 3")
+		`)
+	default:
+		plot = py.Block{
+			py.For("values", "fitnesses", py.Line(`plt.plot(range(1, len(values) + 1), values, color="red", alpha=0.4)`)),
+			py.Line(`plt.xlabel("Objective")`),
+			py.Line(`plt.ylabel("Fitness")`),
+		}
+	}
+
+	return py.Block{
+		py.Assign("front", py.Raw(`[{"fitness": list(ind.fitness.values), "individual": list(ind)} for ind in hof]`)),
+		py.With(`open(f"{rootPath}/pareto.json", "w") as f`, py.Line("json.dump(front, f, indent=2)")),
+		py.Blank,
+		py.Section(SectionPlots,
+			py.Assign("fitnesses", py.Raw("numpy.array([ind.fitness.values for ind in hof])")),
+			plot,
+			py.Line(`plt.title("Pareto Front")`),
+			py.Line(`plt.savefig(f"{rootPath}/pareto_front.png", dpi=300)`),
+			py.Line("plt.close()"),
+		),
+	}
+}
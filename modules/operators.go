@@ -0,0 +1,222 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// OperatorParam describes a keyword argument of a DEAP operator.
+type OperatorParam struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // "float" or "int".
+	Min         float64  `json:"min"`
+	Max         float64  `json:"max"`
+	Default     *float64 `json:"default,omitempty"`
+	DefaultFrom string   `json:"defaultFrom,omitempty"` // EA field used when the value is omitted.
+	Description string   `json:"description"`
+}
+
+// Operator is a DEAP crossover or mutation operator and the individual
+// types it can be applied to.
+type Operator struct {
+	Name        string          `json:"name"`
+	Kind        string          `json:"kind"` // "crossover" or "mutation".
+	Individuals []string        `json:"individuals"`
+	Params      []OperatorParam `json:"params"`
+	Description string          `json:"description"`
+}
+
+const (
+	OperatorCrossover = "crossover"
+	OperatorMutation  = "mutation"
+)
+
+var (
+	allIndividuals     = []string{"binarystring", "floatingpoint", "integer"}
+	permutationOnly    = []string{"permutation"}
+	floatingPointOnly  = []string{"floatingpoint"}
+	defaultBlendAlpha  = 0.5
+	defaultGaussianMu  = 0.0
+	defaultGaussianStd = 1.0
+	defaultEta         = 20.0
+)
+
+func indpbParam() OperatorParam {
+	return OperatorParam{Name: "indpb", Type: "float", Min: 0, Max: 1, DefaultFrom: "indpb", Description: "Independent probability for each attribute to be exchanged or mutated."}
+}
+
+func etaParam() OperatorParam {
+	return OperatorParam{Name: "eta", Type: "float", Min: 1e-6, Max: 1000, Default: &defaultEta, Description: "Crowding degree; high values keep offspring close to their parents."}
+}
+
+func boundParams(kind string) []OperatorParam {
+	return []OperatorParam{
+		{Name: "low", Type: kind, Min: -1e12, Max: 1e12, DefaultFrom: "randomRange[0]", Description: "Lower bound of the search space."},
+		{Name: "up", Type: kind, Min: -1e12, Max: 1e12, DefaultFrom: "randomRange[1]", Description: "Upper bound of the search space."},
+	}
+}
+
+// OperatorCatalog lists every crossover and mutation operator the EA
+// generator can render, with the keyword arguments it passes to DEAP.
+var OperatorCatalog = []Operator{
+	{Name: "cxOnePoint", Kind: OperatorCrossover, Individuals: allIndividuals, Description: "One point crossover."},
+	{Name: "cxTwoPoint", Kind: OperatorCrossover, Individuals: allIndividuals, Description: "Two point crossover."},
+	{Name: "cxUniform", Kind: OperatorCrossover, Individuals: allIndividuals, Params: []OperatorParam{indpbParam()}, Description: "Uniform crossover swapping each attribute with probability indpb."},
+	{Name: "cxMessyOnePoint", Kind: OperatorCrossover, Individuals: allIndividuals, Description: "One point crossover that may change the individuals' length."},
+	{Name: "cxPartialyMatched", Kind: OperatorCrossover, Individuals: permutationOnly, Description: "Partially matched crossover (PMX) for permutations."},
+	{Name: "cxUniformPartialyMatched", Kind: OperatorCrossover, Individuals: permutationOnly, Params: []OperatorParam{indpbParam()}, Description: "Uniform partially matched crossover for permutations."},
+	{Name: "cxOrdered", Kind: OperatorCrossover, Individuals: permutationOnly, Description: "Ordered crossover (OX) for permutations."},
+	{Name: "cxBlend", Kind: OperatorCrossover, Individuals: floatingPointOnly, Params: []OperatorParam{
+		{Name: "alpha", Type: "float", Min: 0, Max: 1, Default: &defaultBlendAlpha, Description: "Extent of the interval in which new values are drawn."},
+	}, Description: "Blend crossover (BLX-alpha)."},
+	{Name: "cxSimulatedBinary", Kind: OperatorCrossover, Individuals: floatingPointOnly, Params: []OperatorParam{etaParam()}, Description: "Simulated binary crossover (SBX)."},
+	{Name: "cxSimulatedBinaryBounded", Kind: OperatorCrossover, Individuals: floatingPointOnly, Params: append([]OperatorParam{etaParam()}, boundParams("float")...), Description: "Simulated binary crossover within bounds, as in NSGA-II."},
+
+	{Name: "mutFlipBit", Kind: OperatorMutation, Individuals: []string{"binarystring"}, Params: []OperatorParam{indpbParam()}, Description: "Flips each bit with probability indpb."},
+	{Name: "mutShuffleIndexes", Kind: OperatorMutation, Individuals: append(slices.Clone(allIndividuals), "permutation"), Params: []OperatorParam{indpbParam()}, Description: "Swaps attributes with probability indpb."},
+	{Name: "mutGaussian", Kind: OperatorMutation, Individuals: floatingPointOnly, Params: []OperatorParam{
+		{Name: "mu", Type: "float", Min: -1e12, Max: 1e12, Default: &defaultGaussianMu, Description: "Mean of the Gaussian noise."},
+		{Name: "sigma", Type: "float", Min: 0, Max: 1e12, Default: &defaultGaussianStd, Description: "Standard deviation of the Gaussian noise."},
+		indpbParam(),
+	}, Description: "Adds Gaussian noise to each attribute with probability indpb."},
+	{Name: "mutPolynomialBounded", Kind: OperatorMutation, Individuals: floatingPointOnly, Params: append(append([]OperatorParam{etaParam()}, boundParams("float")...), indpbParam()), Description: "Polynomial mutation within bounds, as in NSGA-II."},
+	{Name: "mutUniformInt", Kind: OperatorMutation, Individuals: []string{"integer"}, Params: append(boundParams("int"), indpbParam()), Description: "Replaces each attribute with a random integer in [low, up] with probability indpb."},
+}
+
+// findOperator returns the catalog entry with the given kind and name.
+func findOperator(kind string, name string) (Operator, bool) {
+	for _, op := range OperatorCatalog {
+		if op.Kind == kind && op.Name == name {
+			return op, true
+		}
+	}
+	return Operator{}, false
+}
+
+// operatorNames lists the operators of kind that apply to individual.
+func operatorNames(kind string, individual string) []string {
+	var names []string
+	for _, op := range OperatorCatalog {
+		if op.Kind == kind && slices.Contains(op.Individuals, individual) {
+			names = append(names, op.Name)
+		}
+	}
+	return names
+}
+
+// resolveParams validates the given parameters against op, fills in
+// defaults and returns the complete set. defaults maps DefaultFrom names to
+// values taken from the rest of the config.
+func (op Operator) resolveParams(v *util.ValidationError, field string, given map[string]float64, defaults map[string]float64) map[string]float64 {
+	resolved := make(map[string]float64, len(op.Params))
+	for name := range given {
+		if !slices.ContainsFunc(op.Params, func(p OperatorParam) bool { return p.Name == name }) {
+			v.Add(util.FieldError{Field: fmt.Sprintf("%s.%s", field, name), Rule: util.RuleOneOf, Message: fmt.Sprintf("is not a parameter of %s", op.Name), Options: op.paramNames()})
+		}
+	}
+
+	for _, p := range op.Params {
+		path := fmt.Sprintf("%s.%s", field, p.Name)
+		value, ok := given[p.Name]
+		if !ok && p.DefaultFrom != "" {
+			value, ok = defaults[p.DefaultFrom]
+		}
+		if !ok && p.Default != nil {
+			value, ok = *p.Default, true
+		}
+		if !ok {
+			v.Add(util.FieldError{Field: path, Rule: util.RuleRequired, Message: fmt.Sprintf("is required by %s", op.Name)})
+			continue
+		}
+		if p.Type == "int" && value != math.Trunc(value) {
+			v.Add(util.FieldError{Field: path, Rule: util.RuleRange, Message: "must be an integer"})
+			continue
+		}
+		if v.FloatRange(path, value, p.Min, p.Max) {
+			resolved[p.Name] = value
+		}
+	}
+
+	// Bounded operators need a non-empty interval.
+	if low, ok := resolved["low"]; ok {
+		if up, ok := resolved["up"]; ok {
+			v.Relation(field+".up", low < up, fmt.Sprintf("must be greater than low (%v)", low))
+		}
+	}
+	return resolved
+}
+
+func (op Operator) paramNames() []string {
+	names := make([]string, len(op.Params))
+	for i, p := range op.Params {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// operatorSchema restricts the crossover and mutation operators of the
+// evolve algorithms to those of OperatorCatalog for the individual type,
+// and their parameters to the ones each operator takes.
+func operatorSchema(s *Schema) {
+	evolve := propertyIn("algorithm", evolveAlgorithms...)
+	for _, individual := range eaIndividualNames {
+		is := propertyIn("individual", individual)
+		crossovers := operatorNames(OperatorCrossover, strings.ToLower(individual))
+		mutations := operatorNames(OperatorMutation, strings.ToLower(individual))
+		s.when(all(evolve, is), object(map[string]*Schema{"crossoverFunction": new(Schema).enum(crossovers)}, "crossoverFunction"))
+		// Custom mutation code may register its own operator instead.
+		s.when(all(evolve, is, unset("customMutation")), object(map[string]*Schema{"mutationFunction": new(Schema).enum(mutations)}, "mutationFunction"))
+	}
+
+	for _, op := range OperatorCatalog {
+		function, params := "crossoverFunction", "crossoverParams"
+		if op.Kind == OperatorMutation {
+			function, params = "mutationFunction", "mutationParams"
+		}
+		s.when(all(evolve, propertyIn(function, op.Name)), object(map[string]*Schema{params: op.schema()}))
+	}
+}
+
+// schema describes the keyword arguments of op.
+func (op Operator) schema() *Schema {
+	s := &Schema{Properties: map[string]*Schema{}}
+	if len(op.Params) == 0 {
+		none := 0
+		s.MaxProperties = &none
+		return s
+	}
+	s.PropertyNames = new(Schema).enum(op.paramNames())
+	for _, p := range op.Params {
+		param := &Schema{Type: schemaTypes{"number"}}
+		if p.Type == "int" {
+			param.Type = schemaTypes{"integer"}
+		}
+		param.between(p.Min, p.Max).describe(p.Description)
+		if p.Default != nil {
+			param.Default = *p.Default
+		}
+		if p.DefaultFrom != "" {
+			param.Description += fmt.Sprintf(" Defaults to %s.", p.DefaultFrom)
+		}
+		s.Properties[p.Name] = param
+	}
+	return s
+}
+
+// register renders toolbox.register(alias, tools.<op>, <params>).
+func (op Operator) register(alias string, params map[string]float64) py.Stmt {
+	c := py.Call("toolbox.register", py.Str(alias), py.Raw("tools."+op.Name))
+	for _, p := range op.Params {
+		value := params[p.Name]
+		if p.Type == "int" {
+			c.Kw(p.Name, py.Int(int(value)))
+		} else {
+			c.Kw(p.Name, py.Float(value))
+		}
+	}
+	return py.Do(c)
+}
@@ -0,0 +1,127 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Parsimony adds pressure towards small trees to a GP run, on top of the
+// height limits mateHeight and mutHeight.
+type Parsimony struct {
+	Strategy     string  `json:"strategy"`               // doubleTournament, lexicographic or pareto.
+	Size         float64 `json:"size,omitempty"`         // doubleTournament: size of the parsimony tournament, in [1, 2].
+	FitnessFirst bool    `json:"fitnessFirst,omitempty"` // doubleTournament: hold the fitness tournament first.
+	Selection    string  `json:"selection,omitempty"`    // pareto: selNSGA2 or selSPEA2, selNSGA2 when empty.
+}
+
+var (
+	parsimonyStrategies = []string{"doubleTournament", "lexicographic", "pareto"}
+	paretoSelections    = []string{"selNSGA2", "selSPEA2"}
+)
+
+func (p *Parsimony) validate(v *util.ValidationError, algorithm string, selection string) {
+	if !v.OneOf("parsimony.strategy", p.Strategy, parsimonyStrategies) {
+		return
+	}
+	switch p.Strategy {
+	case "pareto":
+		if p.Selection == "" {
+			p.Selection = "selNSGA2"
+		}
+		v.OneOf("parsimony.selection", p.Selection, paretoSelections)
+		// As in multi-objective EA runs, the front is only selected from the
+		// parents and offspring together.
+		if slices.Contains(gpAlgorithms, algorithm) {
+			v.Relation("algorithm", slices.Contains(moAlgorithms, algorithm), fmt.Sprintf("must be one of %s for pareto parsimony", strings.Join(moAlgorithms, ", ")))
+		}
+	default:
+		// The fitness tournament is selTournament's.
+		v.Relation("selectionFunction", selection == "selTournament", "must be selTournament for "+p.Strategy+" parsimony")
+		if p.Strategy == "doubleTournament" {
+			v.FloatRange("parsimony.size", p.Size, 1, 2)
+		}
+	}
+}
+
+// pareto reports whether p makes size a second objective. p may be nil.
+func (p *Parsimony) pareto() bool {
+	return p != nil && p.Strategy == "pareto"
+}
+
+// fitnessWeights are the weights of the fitness: the error, and the size of
+// the tree in pareto runs.
+func (gp *GP) fitnessWeights() []float64 {
+	if gp.Parsimony.pareto() {
+		return append(slices.Clone(gp.Weights), -1.0)
+	}
+	return gp.Weights
+}
+
+// selectionFunction registers the selection that applies the pressure,
+// replacing gp's own.
+func (p *Parsimony) selectionFunction(tournamentSize int) py.Stmt {
+	switch p.Strategy {
+	case "doubleTournament":
+		return py.Do(py.Call("toolbox.register", py.Str("select"), py.Raw("tools.selDoubleTournament")).
+			Kw("fitness_size", py.Int(tournamentSize)).
+			Kw("parsimony_size", py.Float(p.Size)).
+			Kw("fitness_first", py.Bool(p.FitnessFirst)))
+	case "lexicographic":
+		return py.Block{
+			py.Source(`
+				def selLexicographicTournament(individuals, k, tournsize):
+					# The fittest aspirant wins, and the smallest of equally fit ones.
+					return [max(tools.selRandom(individuals, tournsize), key=lambda ind: (ind.fitness, -len(ind))) for _ in range(k)]
+			`),
+			py.Do(py.Call("toolbox.register", py.Str("select"), py.Raw("selLexicographicTournament")).Kw("tournsize", py.Int(tournamentSize))),
+		}
+	default:
+		return py.Do(py.Call("toolbox.register", py.Str("select"), py.Raw("tools."+p.Selection)))
+	}
+}
+
+// paretoOutputs writes the expressions no other one beats on both error and
+// size to pareto.json, smallest first with their regression metrics, and
+// plots the error against the size.
+func paretoOutputs() py.Stmt {
+	return py.Block{
+		py.Source(`
+			front = []
+			for ind in sorted(hof, key=len):
+				func = toolbox.compile(expr=ind)
+				front.append({
+					'expression': str(ind),
+					'size': len(ind),
+					'height': ind.height,
+					'fitness': list(ind.fitness.values),
+					'train': regression_metrics(func, X[train], y[train]),
+					'validation': regression_metrics(func, X[validation], y[validation]) if len(validation) else None,
+				})
+		`),
+		py.With(`open(f"{rootPath}/pareto.json", "w") as f`, py.Line("json.dump(front, f, indent=2)")),
+		py.Blank,
+		py.Section(SectionPlots, py.Source(`
+			plt.plot([ind['size'] for ind in front], [ind['fitness'][0] for ind in front], marker='o', color='red')
+			plt.xlabel('Size')
+			plt.ylabel('Error')
+			plt.title('Pareto Front')
+			plt.savefig(f'{rootPath}/pareto_front.png', dpi=300)
+			plt.close()
+		`)),
+	}
+}
+
+// parsimonySchema describes parsimony; validate also checks it against the
+// selection function.
+func parsimonySchema(s *Schema) {
+	p := s.at("parsimony").describe("Pressure towards small trees, on top of the height limits. doubleTournament and lexicographic replace the selTournament selection; pareto minimises the size as a second objective, only with eaMuPlusLambda and eaMuCommaLambda, and writes the front of expressions to pareto.json.")
+	p.at("strategy").enum(parsimonyStrategies).describe("Bloat control strategy.")
+	p.at("size").between(1, 2).describe("doubleTournament: size of the parsimony tournament.")
+	p.at("fitnessFirst").describe("doubleTournament: hold the fitness tournament first.")
+	p.at("selection").enum(orEmpty(paretoSelections)).describe("pareto: Pareto selection function, selNSGA2 when empty.")
+	p.require("strategy")
+	p.when(propertyIn("strategy", "doubleTournament"), object(map[string]*Schema{}, "size"))
+}
@@ -0,0 +1,105 @@
+package modules
+
+import (
+	"encoding/json"
+	"evolve/modules/py"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Preview is the code a request would run, without creating the run.
+type Preview struct {
+	Code     string         `json:"code"`
+	Config   map[string]any `json:"config"` // The request with defaults applied.
+	Warnings []Warning      `json:"warnings"`
+	Template *TemplateRef   `json:"template,omitempty"` // The template Code is rendered with.
+	script   py.Module
+}
+
+// Warning is something a valid request may not have meant, such as an
+// invalid value replaced by its default.
+type Warning struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// newPreview renders config, after validation and before code generation,
+// which changes some fields to the Python names they stand for.
+func newPreview(config any, script func() py.Module, seedDrawn bool, seed int64, warnings []Warning) (*Preview, error) {
+	if seedDrawn {
+		warnings = append(warnings, Warning{Field: "seed", Message: fmt.Sprintf("not set, drew %d; set it to run this exact code", seed)})
+	}
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{Warnings: warnings}
+	if err := json.Unmarshal(configBytes, &p.Config); err != nil {
+		return nil, err
+	}
+	p.script = script()
+	p.Code = p.script.String()
+	if p.Warnings == nil {
+		p.Warnings = []Warning{}
+	}
+	return p, nil
+}
+
+// UseTemplate renders the code with t, as creating the run would. t is nil
+// when no template is active.
+func (p *Preview) UseTemplate(t *CodeTemplate) {
+	p.Code = t.Render(p.script)
+	p.Template = t.Ref()
+}
+
+// CheckCode adds a warning for every part of snippets that policy does not
+// allow. Creating the run would be rejected.
+func (p *Preview) CheckCode(policy py.Policy, snippets map[string]string) {
+	check := CheckCode(policy, snippets)
+	for _, field := range slices.Sorted(maps.Keys(check.Violations)) {
+		for _, violation := range check.Violations[field] {
+			p.Warnings = append(p.Warnings, Warning{
+				Field:   field,
+				Message: fmt.Sprintf("line %d, column %d: %s; the run would be rejected", violation.Line, violation.Column, violation.Message),
+			})
+		}
+	}
+}
+
+func (ea *EA) Preview() (*Preview, error) {
+	var warnings []Warning
+	if len(ea.RandomRange) != 2 || ea.RandomRange[0] >= ea.RandomRange[1] {
+		warnings = append(warnings, Warning{Field: "randomRange", Message: "not set or invalid, using [1, 5]"})
+	}
+	seedDrawn := ea.Seed == nil
+	if err := ea.Validate(); err != nil {
+		return nil, err
+	}
+	return newPreview(ea, ea.script, seedDrawn, *ea.Seed, warnings)
+}
+
+func (gp *GP) Preview() (*Preview, error) {
+	seedDrawn := gp.Seed == nil
+	if err := gp.Validate(); err != nil {
+		return nil, err
+	}
+	return newPreview(gp, gp.script, seedDrawn, *gp.Seed, nil)
+}
+
+func (ml *EAML) Preview() (*Preview, error) {
+	seedDrawn := ml.Seed == nil
+	if err := ml.Validate(); err != nil {
+		return nil, err
+	}
+	return newPreview(ml, ml.script, seedDrawn, *ml.Seed, nil)
+}
+
+func (pso *PSO) Preview() (*Preview, error) {
+	seedDrawn := pso.Seed == nil
+	if err := pso.Validate(); err != nil {
+		return nil, err
+	}
+	return newPreview(pso, pso.script, seedDrawn, *pso.Seed, nil)
+}
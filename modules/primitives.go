@@ -0,0 +1,387 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Types of the values in a typed primitive set, by name, with their Python
+// type.
+var gpTypes = map[string]string{"float": "float", "bool": "bool"}
+
+// maxPrimitiveArity is the most arguments a user-defined primitive takes.
+const maxPrimitiveArity = 10
+
+// maxPrimitives is the most user-defined primitives a GP defines.
+const maxPrimitives = 20
+
+// gpReservedNames are the globals of the generated code, which user-defined
+// primitives and terminals must not shadow.
+var gpReservedNames = []string{
+	"operator", "math", "random", "numpy", "os", "pickle", "json", "time", "plt", "nx", "partial",
+	"algorithms", "base", "creator", "tools", "gp", "cma", "futures", "scoop",
+	"toolbox", "pset", "arg_dict", "data", "points", "X", "y", "order", "train", "validation",
+	"regression_metrics", "evalSymbReg", "Termination", "main", "evolve", "evolve_islands", "generation",
+	"evaluate", "diversity", "emit_metrics", "metric_history", "record_islands",
+	"save_checkpoint", "load_checkpoint", "save_results", "add_ephemeral", "selLexicographicTournament", "front",
+}
+
+// gpPrimitive is a primitive of the catalogue: the Python function code
+// with arguments of the types in and a result of the type out. Untyped
+// sets only use the number of arguments. def defines code when it is not in
+// a module.
+type gpPrimitive struct {
+	code string
+	in   []string
+	out  string
+	def  string
+}
+
+var (
+	floatArgs = []string{"float", "float"}
+	floatArg  = []string{"float"}
+	boolArgs  = []string{"bool", "bool"}
+)
+
+// Primitives that can be added to the primitive set by name. The protected
+// ones return a value for every input, so trees never raise.
+var gpPrimitives = map[string]gpPrimitive{
+	"add": {code: "operator.add", in: floatArgs, out: "float"},
+	"sub": {code: "operator.sub", in: floatArgs, out: "float"},
+	"mul": {code: "operator.mul", in: floatArgs, out: "float"},
+	"div": {code: "protectedDiv", in: floatArgs, out: "float", def: `
+		def protectedDiv(left, right):
+			try:
+				return left / right
+			except ZeroDivisionError:
+				return 1
+	`},
+	"neg": {code: "operator.neg", in: floatArg, out: "float"},
+	"cos": {code: "math.cos", in: floatArg, out: "float"},
+	"sin": {code: "math.sin", in: floatArg, out: "float"},
+	"lf": {code: "lf", in: floatArg, out: "float", def: `
+		def lf(x):
+			return 1 / (1 + numpy.exp(-x))
+	`},
+	"exp": {code: "protectedExp", in: floatArg, out: "float", def: `
+		def protectedExp(x):
+			return math.exp(min(x, 100))
+	`},
+	"log": {code: "protectedLog", in: floatArg, out: "float", def: `
+		def protectedLog(x):
+			return math.log(abs(x)) if x != 0 else 0
+	`},
+	"sqrt": {code: "protectedSqrt", in: floatArg, out: "float", def: `
+		def protectedSqrt(x):
+			return math.sqrt(abs(x))
+	`},
+	"pow": {code: "protectedPow", in: floatArgs, out: "float", def: `
+		def protectedPow(base, exponent):
+			try:
+				return float(abs(base) ** exponent)
+			except (OverflowError, ZeroDivisionError):
+				return 1
+	`},
+	"tanh": {code: "math.tanh", in: floatArg, out: "float"},
+	"min":  {code: "min", in: floatArgs, out: "float"},
+	"max":  {code: "max", in: floatArgs, out: "float"},
+	"if_then_else": {code: "if_then_else", in: []string{"bool", "float", "float"}, out: "float", def: `
+		def if_then_else(condition, then, otherwise):
+			return then if condition else otherwise
+	`},
+	"lt": {code: "operator.lt", in: floatArgs, out: "bool"},
+	"gt": {code: "operator.gt", in: floatArgs, out: "bool"},
+	"and": {code: "logicalAnd", in: boolArgs, out: "bool", def: `
+		def logicalAnd(left, right):
+			return bool(left) and bool(right)
+	`},
+	"or": {code: "logicalOr", in: boolArgs, out: "bool", def: `
+		def logicalOr(left, right):
+			return bool(left) or bool(right)
+	`},
+	"not": {code: "logicalNot", in: []string{"bool"}, out: "bool", def: `
+		def logicalNot(x):
+			return not x
+	`},
+}
+
+// name is the name DEAP gives the primitive, the name of its function.
+func (p gpPrimitive) name() string {
+	return p.code[strings.LastIndex(p.code, ".")+1:]
+}
+
+// GPPrimitive is a primitive defined by the user: Code defines the Python
+// function Name of Arity arguments.
+type GPPrimitive struct {
+	Name   string   `json:"name"`
+	Arity  int      `json:"arity"`
+	Inputs []string `json:"inputs,omitempty"` // Types of the arguments in typed sets, float when empty.
+	Output string   `json:"output,omitempty"` // Type of the result in typed sets, float when empty.
+	Code   string   `json:"code"`
+}
+
+// GPTerminal is a named constant leaf of the trees.
+type GPTerminal struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`          // Bool terminals are 0, False, or 1, True.
+	Type  string  `json:"type,omitempty"` // Type in typed sets, float when empty.
+}
+
+// validatePrimitiveSet checks the primitives and terminals of gp and fills
+// in the default types. In a typed set, every type a tree can need must
+// have both a terminal and a primitive that returns it, or DEAP cannot
+// generate the tree.
+func (gp *GP) validatePrimitiveSet(v *util.ValidationError) {
+	types := slices.Sorted(maps.Keys(gpTypes))
+	operators := slices.Sorted(maps.Keys(gpPrimitives))
+	if v.Length("operators", len(gp.Operators), 0, len(operators)) {
+		for i, op := range gp.Operators {
+			field := fmt.Sprintf("operators[%d]", i)
+			if v.OneOf(field, op, operators) {
+				v.Relation(field, !slices.Contains(gp.Operators[:i], op), "must be unique")
+			}
+		}
+	}
+	v.Relation("operators", len(gp.Operators)+len(gp.Primitives) > 0, "must have at least one entry, or primitives one")
+
+	if gp.Typed {
+		if len(gp.ArgTypes) == 0 {
+			gp.ArgTypes = slices.Repeat([]string{"float"}, max(gp.Arity, 0))
+		}
+		if v.Length("argTypes", len(gp.ArgTypes), gp.Arity, gp.Arity) {
+			for i, t := range gp.ArgTypes {
+				v.OneOf(fmt.Sprintf("argTypes[%d]", i), t, types)
+			}
+		}
+		if gp.ReturnType == "" {
+			gp.ReturnType = "float"
+		}
+		v.OneOf("returnType", gp.ReturnType, types)
+	} else {
+		v.Relation("argTypes", len(gp.ArgTypes) == 0, "requires typed")
+		v.Relation("returnType", gp.ReturnType == "", "requires typed")
+	}
+
+	// Names of the primitives, arguments and terminals, which share the
+	// namespace of the compiled trees.
+	names := map[string]bool{}
+	for _, op := range gp.Operators {
+		if p, ok := gpPrimitives[op]; ok {
+			names[p.name()] = true
+		}
+	}
+	for i := range gp.Arity {
+		names[fmt.Sprintf("ARG%d", i)] = true
+	}
+	for _, name := range gp.ArgNames {
+		names[name] = true
+	}
+	unique := func(field string, name string) {
+		if !validateIdentifier(v, field, name) || !v.Relation(field, !slices.Contains(gpReservedNames, name) && !slices.Contains(pythonBuiltins, name), fmt.Sprintf("%q is a name the generated code uses", name)) {
+			return
+		}
+		if v.Relation(field, !names[name], fmt.Sprintf("%q is already the name of a primitive, argument or terminal", name)) {
+			names[name] = true
+		}
+	}
+
+	v.Length("primitives", len(gp.Primitives), 0, maxPrimitives)
+	for i := range gp.Primitives {
+		p := &gp.Primitives[i]
+		field := fmt.Sprintf("primitives[%d]", i)
+		unique(field+".name", p.Name)
+		v.IntRange(field+".arity", p.Arity, 1, maxPrimitiveArity)
+		if len(p.Inputs) == 0 {
+			p.Inputs = slices.Repeat([]string{"float"}, max(p.Arity, 0))
+		}
+		if v.Length(field+".inputs", len(p.Inputs), p.Arity, p.Arity) {
+			for j, t := range p.Inputs {
+				v.OneOf(fmt.Sprintf("%s.inputs[%d]", field, j), t, types)
+			}
+		}
+		if p.Output == "" {
+			p.Output = "float"
+		}
+		v.OneOf(field+".output", p.Output, types)
+		if v.Required(field+".code", p.Code) {
+			v.Relation(field+".code", definesTopLevel(p.Code, p.Name), fmt.Sprintf("must define the function %s", p.Name))
+		}
+	}
+
+	v.Length("terminals", len(gp.Terminals), 0, maxIndividualSize)
+	for i := range gp.Terminals {
+		t := &gp.Terminals[i]
+		field := fmt.Sprintf("terminals[%d]", i)
+		unique(field+".name", t.Name)
+		if t.Type == "" {
+			t.Type = "float"
+		}
+		if v.OneOf(field+".type", t.Type, types) && t.Type == "bool" {
+			v.Relation(field+".value", t.Value == 0 || t.Value == 1, "must be 0 or 1 for a bool terminal")
+		}
+	}
+
+	gp.validateTerminalSet(v, unique)
+
+	if gp.Typed && v.Err() == nil {
+		gp.validateTypes(v)
+	}
+}
+
+// definesTopLevel reports whether code defines the function name at its
+// outermost indentation, where the generated module sees it.
+func definesTopLevel(code string, name string) bool {
+	tokens, err := py.Tokenize(code)
+	if err != nil {
+		return false
+	}
+	// Source dedents the code, so its outermost statements start at the
+	// column of the least indented one.
+	var starts []int
+	indent := 0
+	for i, tok := range tokens {
+		if tok.Kind != py.Newline && (i == 0 || tokens[i-1].Kind == py.Newline) {
+			starts = append(starts, i)
+			if indent == 0 || tok.Column < indent {
+				indent = tok.Column
+			}
+		}
+	}
+	for _, i := range starts {
+		if i+2 < len(tokens) && tokens[i].Column == indent && tokens[i].Kind == py.Name && tokens[i].Value == "def" &&
+			tokens[i+1].Kind == py.Name && tokens[i+1].Value == name && tokens[i+2].Kind == py.Op && tokens[i+2].Value == "(" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTypes checks that DEAP can generate the trees of a typed set.
+func (gp *GP) validateTypes(v *util.ValidationError) {
+	// Constants and ephemerals are floats.
+	terminals := map[string]bool{"float": len(gp.Constants)+len(gp.Ephemerals) > 0}
+	for _, t := range gp.ArgTypes {
+		terminals[t] = true
+	}
+	for _, t := range gp.Terminals {
+		terminals[t.Type] = true
+	}
+
+	returns := map[string]bool{}
+	needed := map[string]bool{gp.ReturnType: true}
+	for _, op := range gp.Operators {
+		returns[gpPrimitives[op].out] = true
+		for _, t := range gpPrimitives[op].in {
+			needed[t] = true
+		}
+	}
+	for _, p := range gp.Primitives {
+		returns[p.Output] = true
+		for _, t := range p.Inputs {
+			needed[t] = true
+		}
+	}
+
+	for _, t := range slices.Sorted(maps.Keys(needed)) {
+		v.Relation("terminals", terminals[t], fmt.Sprintf("trees need a %s terminal: add an argument, terminal, constant or ephemeral of type %s", t, t))
+		v.Relation("operators", returns[t], fmt.Sprintf("trees need a primitive that returns %s", t))
+	}
+}
+
+// pyType is the Python type of the primitive set type t.
+func pyType(t string) py.Expr {
+	return py.Raw(gpTypes[t])
+}
+
+func pyTypes(types []string) py.Expr {
+	items := make([]py.Expr, len(types))
+	for i, t := range types {
+		items[i] = pyType(t)
+	}
+	return py.List(items...)
+}
+
+// primitiveSet creates pset with the primitives, terminals and argument
+// names of gp.
+func (gp *GP) primitiveSet() py.Stmt {
+	pset := py.Call("gp.PrimitiveSet", py.Str("MAIN"), py.Int(gp.Arity))
+	if gp.Typed {
+		pset = py.Call("gp.PrimitiveSetTyped", py.Str("MAIN"), pyTypes(gp.ArgTypes), pyType(gp.ReturnType))
+	}
+
+	// addPrimitive gives the argument and result types in typed sets, and
+	// the arity otherwise.
+	var defs, primitives py.Block
+	addPrimitive := func(code string, in []string, out string) {
+		if gp.Typed {
+			primitives = append(primitives, py.Do(py.Call("pset.addPrimitive", py.Raw(code), pyTypes(in), pyType(out))))
+		} else {
+			primitives = append(primitives, py.Do(py.Call("pset.addPrimitive", py.Raw(code), py.Int(len(in)))))
+		}
+	}
+	for _, op := range gp.Operators {
+		p := gpPrimitives[op]
+		if p.def != "" {
+			defs = append(defs, py.Source(p.def))
+		}
+		addPrimitive(p.code, p.in, p.out)
+	}
+	for _, p := range gp.Primitives {
+		defs = append(defs, py.Source(p.Code))
+		addPrimitive(p.Name, p.Inputs, p.Output)
+	}
+
+	var terminals py.Block
+	for _, t := range gp.Terminals {
+		value := py.Float(t.Value)
+		if t.Type == "bool" {
+			value = py.Bool(t.Value == 1)
+		}
+		if gp.Typed {
+			terminals = append(terminals, py.Do(py.Call("pset.addTerminal", value, pyType(t.Type)).Kw("name", py.Str(t.Name))))
+		} else {
+			terminals = append(terminals, py.Do(py.Call("pset.addTerminal", value).Kw("name", py.Str(t.Name))))
+		}
+	}
+
+	return py.Block{
+		py.Assign("pset", pset),
+		defs,
+		primitives,
+		terminals,
+		py.Blank,
+		gp.terminalSet(),
+		gp.renameArgs(),
+	}
+}
+
+// primitivesSchema describes the primitive set fields, which GP validates
+// against each other.
+func primitivesSchema(s *Schema) {
+	types := slices.Sorted(maps.Keys(gpTypes))
+	s.at("operators").count(0, len(gpPrimitives)).describe("Primitives of the catalogue to add to the primitive set. At least one, unless primitives are given.")
+	s.at("operators").Items.enum(slices.Sorted(maps.Keys(gpPrimitives)))
+	s.at("typed").describe("Use a strongly typed primitive set: trees only combine primitives, arguments and terminals of matching types.")
+	s.at("argTypes").describe("typed: type of each input, arity entries; float when empty.")
+	s.at("argTypes").Items.enum(types)
+	s.at("returnType").enum(orEmpty(types)).describe("typed: type of the evolved function's result; float when empty.")
+
+	p := s.at("primitives").count(0, maxPrimitives).describe("Primitives defined in Python.").Items
+	p.at("name").length(1, maxIdentifierLength).pattern(`^[A-Za-z_][A-Za-z0-9_]*$`).describe("Name of the function code defines.")
+	p.at("arity").between(1, maxPrimitiveArity).describe("Number of arguments.")
+	p.at("inputs").describe("typed: type of each argument; float when empty.")
+	p.at("inputs").Items.enum(types)
+	p.at("output").enum(orEmpty(types)).describe("typed: type of the result; float when empty.")
+	p.at("code").nonEmpty().describe("Python code defining the function.")
+	p.require("name", "arity", "code")
+
+	t := s.at("terminals").describe("Named constants added as leaves of the trees.").Items
+	t.at("name").length(1, maxIdentifierLength).pattern(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	t.at("value").describe("The constant; 0 (False) or 1 (True) for bool terminals.")
+	t.at("type").enum(orEmpty(types)).describe("typed: type of the terminal; float when empty.")
+	t.require("name", "value")
+}
@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"errors"
+	"evolve/util"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPrimitiveNames(t *testing.T) {
+	request := readGoldenRequest(t, filepath.Join("testdata", "golden", "gp.json"))
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"square", true},
+		{"maximum", true},
+		{"len", false},
+		{"float", false},
+		{"sum", false},
+		{"max", false},
+		{"min", false},
+		{"abs", false},
+		{"zip", false},
+		{"range", false},
+		{"list", false},
+		{"tuple", false},
+		{"print", false},
+		{"ValueError", false},
+		{"toolbox", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, field := range []string{"primitives[0].name", "terminals[0].name"} {
+				config := maps.Clone(request.Config)
+				if field == "primitives[0].name" {
+					config["primitives"] = []map[string]any{{"name": tt.name, "arity": 1, "code": "def " + tt.name + "(x):\n    return x * x\n"}}
+				} else {
+					config["terminals"] = []map[string]any{{"name": tt.name, "value": 1}}
+				}
+				g, err := NewGenerator("gp", config)
+				if err == nil {
+					err = g.Validate()
+				}
+				var verr *util.ValidationError
+				rejected := errors.As(err, &verr) && slices.ContainsFunc(verr.Fields, func(f util.FieldError) bool { return f.Field == field })
+				if rejected == tt.ok || (tt.ok && err != nil) {
+					t.Errorf("%s %q: error %v, want ok %v", field, tt.name, err, tt.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestDefinesTopLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"def", "def square(x):\n    return x * x\n", true},
+		{"spaced", "def  square (x):\n    return x * x\n", true},
+		{"indented snippet", "\n    import math\n    def square(x):\n        return x * x\n", true},
+		{"decorated", "@functools.cache\ndef square(x):\n    return x * x\n", true},
+		{"after a helper", "def helper(x):\n    return x\n\ndef square(x):\n    return helper(x) ** 2\n", true},
+		{"nested", "def helper(x):\n    def square(y):\n        return y * y\n    return square(x)\n", false},
+		{"in a block", "if True:\n    def square(x):\n        return x * x\n", false},
+		{"in a comment", "# def square(x):\nsquare = lambda x: x * x\n", false},
+		{"in a string", "doc = 'def square(x):'\n", false},
+		{"prefix", "def square2(x):\n    return x * x\n", false},
+		{"other name", "def cube(x):\n    return x ** 3\n", false},
+		{"unterminated", "def square(x):\n    return 'x\n", false},
+	}
+	for _, tt := range tests {
+		if got := definesTopLevel(tt.code, "square"); got != tt.want {
+			t.Errorf("%s: definesTopLevel(%q, square) = %v, want %v", tt.name, tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package modules
+
+import (
+	"encoding/json"
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"strings"
+)
+
+// Problem is a built-in combinatorial problem instance. Its data is uploaded
+// with the run as instance.json and loaded by the generated code, which also
+// sets the individual size and evaluation function.
+type Problem struct {
+	Type string `json:"type"` // "tsp", "knapsack" or "flowshop".
+
+	// TSP: a distance matrix, or the contents of a TSPLIB file.
+	DistanceMatrix [][]float64 `json:"distanceMatrix,omitempty"`
+	TSPLIB         string      `json:"tsplib,omitempty"`
+
+	// Knapsack: items and the total weight allowed.
+	Items    []KnapsackItem `json:"items,omitempty"`
+	Capacity float64        `json:"capacity,omitempty"`
+
+	// Permutation flow shop: processing time of each job (row) on each machine.
+	ProcessingTimes [][]float64 `json:"processingTimes,omitempty"`
+}
+
+type KnapsackItem struct {
+	Weight float64 `json:"weight"`
+	Value  float64 `json:"value"`
+}
+
+var problemTypes = []string{"tsp", "knapsack", "flowshop"}
+
+// validate checks the instance and configures ea to solve it.
+func (p *Problem) validate(v *util.ValidationError, ea *EA) {
+	if !v.OneOf("problem.type", p.Type, problemTypes) {
+		return
+	}
+	v.Relation("multiObjective", ea.MultiObjective == nil, "is not supported with a problem instance")
+
+	var size int
+	switch p.Type {
+	case "tsp":
+		size = p.validateTSP(v)
+		ea.EvaluationFunction = "evalTSP"
+	case "knapsack":
+		size = p.validateKnapsack(v)
+		ea.EvaluationFunction = "evalKnapsack"
+	case "flowshop":
+		size = p.validateFlowShop(v)
+		ea.EvaluationFunction = "evalFlowShop"
+	}
+	if size > 0 {
+		ea.IndividualSize = size
+	}
+
+	// Tours and schedules are minimised, knapsack values maximised.
+	individual := "permutation"
+	if p.Type == "knapsack" {
+		individual = "binarystring"
+	}
+	v.Relation("individual", strings.ToLower(ea.Individual) == individual, fmt.Sprintf("must be %s for %s", individual, p.Type))
+	if len(ea.Weights) == 1 {
+		if p.Type == "knapsack" {
+			v.Relation("weights[0]", ea.Weights[0] > 0, "must be positive to maximise the knapsack value")
+		} else {
+			v.Relation("weights[0]", ea.Weights[0] < 0, fmt.Sprintf("must be negative to minimise the %s cost", p.Type))
+		}
+	}
+}
+
+// validateTSP parses a TSPLIB file into DistanceMatrix and returns the
+// number of cities.
+func (p *Problem) validateTSP(v *util.ValidationError) int {
+	if p.TSPLIB != "" {
+		if len(p.DistanceMatrix) > 0 {
+			v.Relation("problem.tsplib", false, "must not be given together with distanceMatrix")
+			return 0
+		}
+		matrix, err := parseTSPLIB(p.TSPLIB)
+		if err != nil {
+			v.Relation("problem.tsplib", false, err.Error())
+			return 0
+		}
+		p.DistanceMatrix = matrix
+		p.TSPLIB = ""
+	}
+
+	n := len(p.DistanceMatrix)
+	if !v.Length("problem.distanceMatrix", n, 2, maxCities) {
+		return 0
+	}
+	for i, row := range p.DistanceMatrix {
+		field := fmt.Sprintf("problem.distanceMatrix[%d]", i)
+		if !v.Length(field, len(row), n, n) {
+			continue
+		}
+		for j, d := range row {
+			v.FloatRange(fmt.Sprintf("%s[%d]", field, j), d, 0, 1e12)
+		}
+	}
+	return n
+}
+
+func (p *Problem) validateKnapsack(v *util.ValidationError) int {
+	v.FloatRange("problem.capacity", p.Capacity, 1e-12, 1e12)
+	if !v.Length("problem.items", len(p.Items), 1, maxIndividualSize) {
+		return 0
+	}
+	for i, item := range p.Items {
+		v.FloatRange(fmt.Sprintf("problem.items[%d].weight", i), item.Weight, 0, 1e12)
+		v.FloatRange(fmt.Sprintf("problem.items[%d].value", i), item.Value, 0, 1e12)
+	}
+	return len(p.Items)
+}
+
+func (p *Problem) validateFlowShop(v *util.ValidationError) int {
+	if !v.Length("problem.processingTimes", len(p.ProcessingTimes), 2, maxIndividualSize) {
+		return 0
+	}
+	machines := len(p.ProcessingTimes[0])
+	v.Length("problem.processingTimes[0]", machines, 1, 1000)
+	for i, row := range p.ProcessingTimes {
+		field := fmt.Sprintf("problem.processingTimes[%d]", i)
+		if !v.Length(field, len(row), machines, machines) {
+			continue
+		}
+		for j, t := range row {
+			v.FloatRange(fmt.Sprintf("%s[%d]", field, j), t, 0, 1e12)
+		}
+	}
+	return len(p.ProcessingTimes)
+}
+
+// problemSchema describes the instances validate checks.
+func problemSchema(s *Schema) {
+	p := s.at("problem").describe("Built-in problem instance. It sets individualSize and evaluationFunction; tsp and flowshop need permutation individuals, knapsack binaryString.")
+	p.at("type").enum(problemTypes).describe("Problem to solve.")
+	p.at("distanceMatrix").describe("tsp: distance between every pair of cities.")
+	p.at("tsplib").describe("tsp: the contents of a TSPLIB file, instead of distanceMatrix.")
+	p.at("items").describe("knapsack: the items to choose from.")
+	p.at("capacity").describe("knapsack: the total weight allowed.")
+	p.at("processingTimes").describe("flowshop: processing time of each job (row) on each machine.")
+	p.require("type")
+
+	// Weights, values and times are never negative.
+	amount := new(Schema).between(0, 1e12)
+	p.when(propertyIn("type", "tsp"), object(map[string]*Schema{
+		"distanceMatrix": {Items: &Schema{Items: amount}},
+	}))
+	p.when(propertyIn("type", "knapsack"), object(map[string]*Schema{
+		"items":    (&Schema{Items: object(map[string]*Schema{"weight": amount, "value": amount})}).count(1, maxIndividualSize),
+		"capacity": new(Schema).between(1e-12, 1e12),
+	}, "items", "capacity"))
+	p.when(propertyIn("type", "flowshop"), object(map[string]*Schema{
+		"processingTimes": (&Schema{Items: &Schema{Items: amount}}).count(2, maxIndividualSize),
+	}, "processingTimes"))
+}
+
+// instance is the data written to instance.json.
+func (p *Problem) instance() ([]byte, error) {
+	data := map[string]any{"type": p.Type}
+	switch p.Type {
+	case "tsp":
+		data["distances"] = p.DistanceMatrix
+	case "knapsack":
+		data["items"] = p.Items
+		data["capacity"] = p.Capacity
+	case "flowshop":
+		data["processingTimes"] = p.ProcessingTimes
+	}
+	return json.Marshal(data)
+}
+
+// evalFunction loads instance.json next to the script and defines the
+// evaluation function for the problem.
+func (p *Problem) evalFunction() py.Stmt {
+	var eval py.Stmt
+	switch p.Type {
+	case "tsp":
+		eval = py.Source(`
+			def evalTSP(individual):
+				distances = instance["distances"]
+				return sum(distances[individual[i - 1]][individual[i]] for i in range(len(individual))),
+		`)
+	case "knapsack":
+		// Overweight solutions score below every feasible one.
+		eval = py.Source(`
+			def evalKnapsack(individual):
+				chosen = [item for item, bit in zip(instance["items"], individual) if bit]
+				weight = sum(item["weight"] for item in chosen)
+				if weight > instance["capacity"]:
+					return instance["capacity"] - weight,
+				return sum(item["value"] for item in chosen),
+		`)
+	case "flowshop":
+		eval = py.Source(`
+			def evalFlowShop(individual):
+				times = instance["processingTimes"]
+				finish = [0] * len(times[0])
+				for job in individual:
+					for m in range(len(finish)):
+						finish[m] = max(finish[m], finish[m - 1] if m > 0 else 0) + times[job][m]
+				return finish[-1],
+		`)
+	}
+	return py.Block{
+		py.With(py.Call("open", scriptPath("instance.json")).Code()+" as f", py.Assign("instance", py.Raw("json.load(f)"))),
+		eval,
+	}
+}
@@ -2,9 +2,9 @@ package modules
 
 import (
 	"encoding/json"
+	"evolve/modules/py"
+	"evolve/util"
 	"fmt"
-	"slices"
-	"strings"
 )
 
 type PSO struct {
@@ -20,6 +20,16 @@ type PSO struct {
 	Benchmark      string    `json:"benchmark"` // Evaluation function.
 	PopulationSize int       `json:"populationSize"`
 	Generations    int       `json:"generations"`
+
+	// Seed for random and numpy.random, drawn when omitted.
+	Seed *int64 `json:"seed,omitempty"`
+
+	// Rules that end the run before Generations.
+	Termination *Termination `json:"termination,omitempty"`
+}
+
+func init() {
+	RegisterGenerator("pso", func(data map[string]any) (Generator, error) { return PSOFromJSON(data) }, psoSchema())
 }
 
 func PSOFromJSON(jsonData map[string]any) (*PSO, error) {
@@ -35,208 +45,296 @@ func PSOFromJSON(jsonData map[string]any) (*PSO, error) {
 	return pso, nil
 }
 
-func (pso *PSO) validate() error {
-	if !slices.Contains([]string{"original", "multiswarm", "speciation"}, pso.Algorithm) {
-		return fmt.Errorf("invalid PSO algorithm name: %s", pso.Algorithm)
+var psoAlgorithms = []string{"original", "multiswarm", "speciation"}
+
+func (pso *PSO) Validate() error {
+	v := &util.ValidationError{}
+	pso.Seed = resolveSeed(v, pso.Seed)
+	v.OneOf("algorithm", pso.Algorithm, psoAlgorithms)
+
+	// The animation plots the first two coordinates.
+	v.IntRange("dimensions", pso.Dimensions, 2, maxIndividualSize)
+	v.Relation("maxPosition", pso.MinPosition < pso.MaxPosition, fmt.Sprintf("must be greater than minPosition (%v)", pso.MinPosition))
+	v.Relation("maxSpeed", pso.MinSpeed < pso.MaxSpeed, fmt.Sprintf("must be greater than minSpeed (%v)", pso.MinSpeed))
+	v.OneOf("benchmark", pso.Benchmark, benchmarkFunctions)
+	v.IntRange("populationSize", pso.PopulationSize, 1, maxPopulationSize)
+	v.IntRange("generations", pso.Generations, 1, maxGenerations)
+	validateWeights(v, pso.Weights, 1)
+	if pso.Termination != nil {
+		pso.Termination.validate(v, pso.Weights, pso.Generations)
 	}
+	return v.Err()
+}
+
+// psoSchema describes the PSO config.
+func psoSchema() *Schema {
+	s := configSchema[PSO]("Particle swarm optimisation", "Particle swarm optimisation of a DEAP benchmark.")
+	s.at("algorithm").enum(psoAlgorithms).describe("Swarm variant.")
+	s.at("dimensions").between(2, maxIndividualSize).describe("Dimensions of the search space.")
+	s.at("minPosition").describe("Lower bound of the initial positions.")
+	s.at("maxPosition").describe("Upper bound of the initial positions, greater than minPosition.")
+	s.at("minSpeed").describe("Lower bound of the speed.")
+	s.at("maxSpeed").describe("Upper bound of the speed, greater than minSpeed.")
+	s.at("phi1").describe("Cognitive component, the pull towards a particle's best position.")
+	s.at("phi2").describe("Social component, the pull towards the swarm's best position.")
+	s.at("benchmark").enum(benchmarkFunctions).describe("DEAP benchmark to optimise.")
+	s.at("populationSize").between(1, maxPopulationSize).describe("Particles in the swarm.")
+	s.at("generations").between(1, maxGenerations).describe("Generations to run, the upper bound of any termination rule.")
+	s.require("algorithm", "dimensions", "benchmark", "populationSize", "generations")
+	seedSchema(s)
+	weightsSchema(s, 1)
+	terminationSchema(s)
+	return s
+}
 
-	if pso.Dimensions <= 0 {
-		return fmt.Errorf("invalid number of dimensions: %d", pso.Dimensions)
+func (pso *PSO) imports() py.Stmt {
+	return py.Section(SectionImports,
+		py.Import("math, os, random, json, time"),
+		py.Import("numpy"),
+		py.From("deap", "base, benchmarks, creator, tools"),
+		py.Import("matplotlib.pyplot as plt"),
+		py.Import("matplotlib.animation as animation"),
+	)
+}
+
+func (pso *PSO) generateAndUpdateParticle() py.Stmt {
+	return py.Source(`
+		def generate(size, pmin, pmax, smin, smax):
+			part = creator.Particle(numpy.random.uniform(pmin, pmax, size))
+			part.speed = numpy.random.uniform(smin, smax, size)
+			part.smin = smin
+			part.smax = smax
+			return part
+
+		def updateParticle(part, best, phi1, phi2):
+			u1 = numpy.random.uniform(0, phi1, len(part))
+			u2 = numpy.random.uniform(0, phi2, len(part))
+			v_u1 = u1 * (part.best - part)
+			v_u2 = u2 * (best - part)
+			part.speed += v_u1 + v_u2
+			for i, speed in enumerate(part.speed):
+				if abs(speed) < part.smin:
+					part.speed[i] = math.copysign(part.smin, speed)
+				elif abs(speed) > part.smax:
+					part.speed[i] = math.copysign(part.smax, speed)
+			part += part.speed
+	`)
+}
+
+func (pso *PSO) toolbox() py.Stmt {
+	return py.Block{
+		py.Assign("toolbox", py.Raw("base.Toolbox()")),
+		py.Do(py.Call("toolbox.register", py.Str("particle"), py.Raw("generate")).
+			Kw("size", py.Int(pso.Dimensions)).
+			Kw("pmin", py.Float(pso.MinPosition)).
+			Kw("pmax", py.Float(pso.MaxPosition)).
+			Kw("smin", py.Float(pso.MinSpeed)).
+			Kw("smax", py.Float(pso.MaxSpeed))),
+		py.Do(py.Call("toolbox.register", py.Str("population"), py.Raw("tools.initRepeat"), py.Raw("list"), py.Raw("toolbox.particle"))),
+		py.Do(py.Call("toolbox.register", py.Str("update"), py.Raw("updateParticle")).Kw("phi1", py.Float(pso.Phi1)).Kw("phi2", py.Float(pso.Phi2))),
+		py.Do(py.Call("toolbox.register", py.Str("evaluate"), py.Raw("benchmarks."+pso.Benchmark))),
 	}
+}
+
+func (pso *PSO) setupPlot() py.Stmt {
+	return py.Source(`
+		fig, ax = plt.subplots()
+		# Dynamically determine plot space based on initial particle positions.
+		all_x = [p[0] for p in pop]
+		all_y = [p[1] for p in pop]
+		x_min = min(all_x)
+		x_max = max(all_x)
+		y_min = min(all_y)
+		y_max = max(all_y)
+		# Add a buffer to the plot limits to ensure particles don't get cut off
+		x_buffer = (x_max - x_min) * 0.5
+		y_buffer = (y_max - y_min) * 0.5
+		x_min -= x_buffer
+		x_max += x_buffer
+		y_min -= y_buffer
+		y_max += y_buffer
+		ax.set_xlim(x_min, x_max)
+		ax.set_ylim(y_min, y_max)
+		scat = ax.scatter([p[0] for p in pop], [p[1] for p in pop])  # Initial scatter plot
+		best_scat = ax.scatter([], [], color='red', marker='*', s=100) # Scatter plot for the best particle
+		plt.xlabel('x')
+		plt.ylabel('y')
+		plt.title('Particle Swarm Optimization')
+		generation_text = ax.text(0.02, 0.95, '', transform=ax.transAxes)  # Text to display generation
+	`)
+}
 
-	if pso.MinPosition >= pso.MaxPosition {
-		return fmt.Errorf("invalid min/max position: %f/%f", pso.MinPosition, pso.MaxPosition)
+// thePSOAlgo is update, which runs one generation and draws it as a frame
+// of the animation.
+func (pso *PSO) thePSOAlgo() py.Stmt {
+	var stop py.Stmt
+	if pso.Termination != nil {
+		stop = py.Line("stop.update(frame, pop, len(pop))")
 	}
+	return py.Def("update(frame)",
+		py.Line("nonlocal best, pop, x_min, x_max, y_min, y_max  # Access the pop variable and plot limits"),
+		py.For("part", "pop",
+			py.Assign("part.fitness.values", py.Raw("toolbox.evaluate(part)")),
+			py.If("part.best is None or part.best.fitness < part.fitness",
+				py.Assign("part.best", py.Raw("creator.Particle(part)")),
+				py.Assign("part.best.fitness.values", py.Raw("part.fitness.values")),
+			),
+			py.If("best is None or best.fitness < part.fitness",
+				py.Assign("best", py.Raw("creator.Particle(part)")),
+				py.Assign("best.fitness.values", py.Raw("part.fitness.values")),
+			),
+		),
+		py.For("part", "pop", py.Line("toolbox.update(part, best)")),
+		py.Source(`
+			# Update scatter plot positions
+			scat.set_offsets(numpy.array([[p[0], p[1]] for p in pop]))
+			# Update best particle position
+			best_scat.set_offsets(numpy.array([[best[0], best[1]]]))
+			# Update generation text
+			generation_text.set_text(f'Generation: {frame}')
+			# Dynamically adjust the plot limits based on particle positions
+			all_x = [p[0] for p in pop]
+			all_y = [p[1] for p in pop]
+			curr_x_min = min(all_x)
+			curr_x_max = max(all_x)
+			curr_y_min = min(all_y)
+			curr_y_max = max(all_y)
+			x_buffer = (curr_x_max - curr_x_min) * 0.5
+			y_buffer = (curr_y_max - curr_y_min) * 0.5
+			curr_x_min -= x_buffer
+			curr_x_max += x_buffer
+			curr_y_min -= y_buffer
+			curr_y_max += y_buffer
+			# Expand the plot space if particles are going out of range, but never shrink it.
+			if curr_x_min < x_min:
+				x_min = curr_x_min
+			if curr_x_max > x_max:
+				x_max = curr_x_max
+			if curr_y_min < y_min:
+				y_min = curr_y_min
+			if curr_y_max > y_max:
+				y_max = curr_y_max
+			ax.set_xlim(x_min, x_max)
+			ax.set_ylim(y_min, y_max)
+			# Gather all the fitnesses in one list and print the stats
+			logbook.record(gen=frame, evals=len(pop), **stats.compile(pop))
+			print(logbook.stream)
+			emit_metrics(frame, len(pop), pop, best)
+		`),
+		stop,
+		py.Return(py.Raw("scat"), py.Raw("best_scat"), py.Raw("generation_text")),
+	)
+}
 
-	if pso.MinSpeed >= pso.MaxSpeed {
-		return fmt.Errorf("invalid min/max speed: %f/%f", pso.MinSpeed, pso.MaxSpeed)
+// frames renders the frames of the animation, one per generation. With a
+// Termination the animation ends once a rule holds.
+func (pso *PSO) frames() (py.Stmt, py.Expr) {
+	if pso.Termination == nil {
+		return nil, py.Raw("GEN")
 	}
+	return py.Def("frames()",
+		py.For("frame", "range(GEN)",
+			py.If("stop.reason", py.Return()),
+			py.Line("yield frame"),
+		),
+	), py.Raw("frames")
+}
 
-	if !slices.Contains([]string{"rand", "plane", "sphere", "cigar", "rosenbrock", "h1", "ackley", "bohachevsky", "griewank", "rastrigin", "rastrigin_scaled", "rastrigin_skew", "schaffer", "schwefel", "himmelblau"}, pso.Benchmark) {
-		return fmt.Errorf("invalid benchmark function: %s", pso.Benchmark)
+func (pso *PSO) Code() (py.Module, error) {
+	if err := pso.Validate(); err != nil {
+		return nil, err
 	}
+	return pso.script(), nil
+}
 
-	if pso.PopulationSize <= 0 {
-		return fmt.Errorf("invalid population size: %d", pso.PopulationSize)
+// script generates the code of a validated PSO.
+func (pso *PSO) script() py.Module {
+	code := py.Module{
+		pso.imports(),
+		seedCode(*pso.Seed),
+		py.Do(py.Call("creator.create", py.Str("FitnessMax"), py.Raw("base.Fitness")).Kw("weights", py.Tuple(py.Floats(pso.Weights)...))),
+		py.Do(py.Call("creator.create", py.Str("Particle"), py.Raw("numpy.ndarray")).
+			Kw("fitness", py.Raw("creator.FitnessMax")).
+			Kw("speed", py.Raw("list")).
+			Kw("smin", py.None).
+			Kw("smax", py.None).
+			Kw("best", py.None)),
+		pso.generateAndUpdateParticle(),
+		metricsFunction(),
+		pso.toolbox(),
+		py.Def("main()", pso.main()),
+		mainGuard,
 	}
+	return code
+}
 
-	if pso.Generations <= 0 {
-		return fmt.Errorf("invalid number of generations: %d", pso.Generations)
+// main is the body of main(): it animates the swarm, one generation per
+// frame, and writes its outputs.
+func (pso *PSO) main() py.Stmt {
+	var stop py.Stmt
+	if pso.Termination != nil {
+		// Frames count from 0, so the last generation is GEN - 1.
+		stop = pso.Termination.instance(py.Raw("GEN - 1"), pso.Weights)
 	}
+	frames, framesExpr := pso.frames()
 
-	return nil
-}
+	return py.Block{
+		py.Assign("rootPath", py.Raw("os.path.dirname(os.path.abspath(__file__))")),
+		py.Assign("pop", py.Rawf("toolbox.population(n=%d)", pso.PopulationSize)),
+		py.Source(`
+			stats = tools.Statistics(lambda ind: ind.fitness.values)
+			stats.register('avg', numpy.mean)
+			stats.register('std', numpy.std)
+			stats.register('min', numpy.min)
+			stats.register('max', numpy.max)
+
+			logbook = tools.Logbook()
+			logbook.header = ['gen', 'evals'] + stats.fields
+
+			best = None
+		`),
+		py.Assign("GEN", py.Int(pso.Generations)),
+		stop,
+		py.Blank,
+		pso.setupPlot(),
+		pso.thePSOAlgo(),
+		frames,
+
+		// init_func keeps FuncAnimation from running the first generation twice.
+		py.Assign("ani", py.Call("animation.FuncAnimation", py.Raw("fig"), py.Raw("update")).
+			Kw("frames", framesExpr).
+			Kw("init_func", py.Raw("lambda: (scat, best_scat, generation_text)")).
+			Kw("save_count", py.Raw("GEN")).
+			Kw("blit", py.Raw("True")).
+			Kw("repeat", py.Raw("False"))),
+		py.Line("ani.save(f'{rootPath}/pso_animation.gif', writer='pillow', fps=10)"),
+		py.Blank,
 
-func (pso *PSO) imports() string {
-	return strings.Join([]string{
-		"import math, os",
-		"import numpy",
-		"from deap import base, benchmarks, creator, tools",
-		"import matplotlib.pyplot as plt",
-		"import matplotlib.animation as animation",
-	}, "\n")
-}
-
-func (pso *PSO) generateAndUpdateParticle() string {
-	return strings.Join([]string{
-		"def generate(size, pmin, pmax, smin, smax):",
-		"\tpart = creator.Particle(numpy.random.uniform(pmin, pmax, size))",
-		"\tpart.speed = numpy.random.uniform(smin, smax, size)",
-		"\tpart.smin = smin",
-		"\tpart.smax = smax",
-		"\treturn part\n",
-		"def updateParticle(part, best, phi1, phi2):",
-		"\tu1 = numpy.random.uniform(0, phi1, len(part))",
-		"\tu2 = numpy.random.uniform(0, phi2, len(part))",
-		"\tv_u1 = u1 * (part.best - part)",
-		"\tv_u2 = u2 * (best - part)",
-		"\tpart.speed += v_u1 + v_u2",
-		"\tfor i, speed in enumerate(part.speed):",
-		"\t\tif abs(speed) < part.smin:",
-		"\t\t\tpart.speed[i] = math.copysign(part.smin, speed)",
-		"\t\telif abs(speed) > part.smax:",
-		"\t\t\tpart.speed[i] = math.copysign(part.smax, speed)",
-		"\tpart += part.speed",
-	}, "\n")
-}
-
-func (pso *PSO) toolbox() string {
-	return strings.Join([]string{
-		"toolbox = base.Toolbox()",
-		fmt.Sprintf("toolbox.register('particle', generate, size=%d, pmin=%f, pmax=%f, smin=%f, smax=%f)", pso.Dimensions, pso.MinPosition, pso.MaxPosition, pso.MinSpeed, pso.MaxSpeed),
-		"toolbox.register('population', tools.initRepeat, list, toolbox.particle)",
-		fmt.Sprintf("toolbox.register('update', updateParticle, phi1=%f, phi2=%f)", pso.Phi1, pso.Phi2),
-		fmt.Sprintf("toolbox.register('evaluate', benchmarks.%s)", pso.Benchmark),
-	}, "\n")
-}
-
-func (pso *PSO) setupPlot() string {
-	return strings.Join([]string{
-		"\n\tfig, ax = plt.subplots()",
-		"\t# Dynamically determine plot space based on initial particle positions.",
-		"\tall_x = [p[0] for p in pop]",
-		"\tall_y = [p[1] for p in pop]",
-		"\tx_min = min(all_x)",
-		"\tx_max = max(all_x)",
-		"\ty_min = min(all_y)",
-		"\ty_max = max(all_y)",
-		"\t# Add a buffer to the plot limits to ensure particles don't get cut off",
-		"\tx_buffer = (x_max - x_min) * 0.5",
-		"\ty_buffer = (y_max - y_min) * 0.5",
-		"\tx_min -= x_buffer",
-		"\tx_max += x_buffer",
-		"\ty_min -= y_buffer",
-		"\ty_max += y_buffer",
-		"\tax.set_xlim(x_min, x_max)",
-		"\tax.set_ylim(y_min, y_max)",
-		"\tscat = ax.scatter([p[0] for p in pop], [p[1] for p in pop])  # Initial scatter plot",
-		"\tbest_scat = ax.scatter([], [], color='red', marker='*', s=100) # Scatter plot for the best particle",
-		"\tplt.xlabel('x')",
-		"\tplt.ylabel('y')",
-		"\tplt.title('Particle Swarm Optimization')",
-		"\tgeneration_text = ax.text(0.02, 0.95, '', transform=ax.transAxes)  # Text to display generation",
-	}, "\n")
-}
-
-func (pso *PSO) thePSOAlgo() string {
-	return strings.Join([]string{
-		"\tdef update(frame):",
-		"\tnonlocal best, pop, x_min, x_max, y_min, y_max  # Access the pop variable and plot limits",
-		"\tfor part in pop:",
-		"\t\tpart.fitness.values = toolbox.evaluate(part)",
-		"\t\tif part.best is None or part.best.fitness < part.fitness:",
-		"\t\t\tpart.best = creator.Particle(part)",
-		"\t\t\tpart.best.fitness.values = part.fitness.values",
-		"\t\tif best is None or best.fitness < part.fitness:",
-		"\t\t\tbest = creator.Particle(part)",
-		"\t\t\tbest.fitness.values = part.fitness.values",
-		"\tfor part in pop:",
-		"\t\ttoolbox.update(part, best)",
-		"\t# Update scatter plot positions",
-		"\tscat.set_offsets(numpy.array([[p[0], p[1]] for p in pop]))",
-		"\t# Update best particle position",
-		"\tbest_scat.set_offsets(numpy.array([[best[0], best[1]]]))",
-		"\t# Update generation text",
-		"\tgeneration_text.set_text(f'Generation: {frame}')",
-		"\t# Dynamically adjust the plot limits based on particle positions",
-		"\tall_x = [p[0] for p in pop]",
-		"\tall_y = [p[1] for p in pop]",
-		"\tcurr_x_min = min(all_x)",
-		"\tcurr_x_max = max(all_x)",
-		"\tcurr_y_min = min(all_y)",
-		"\tcurr_y_max = max(all_y)",
-		"\tx_buffer = (curr_x_max - curr_x_min) * 0.5",
-		"\ty_buffer = (curr_y_max - curr_y_min) * 0.5",
-		"\tcurr_x_min -= x_buffer",
-		"\tcurr_x_max += x_buffer",
-		"\tcurr_y_min -= y_buffer",
-		"\tcurr_y_max += y_buffer",
-		"\t# Expand the plot space if particles are going out of range, but never shrink it.",
-		"\tif curr_x_min < x_min:",
-		"\t\tx_min = curr_x_min",
-		"\tif curr_x_max > x_max:",
-		"\t\tx_max = curr_x_max",
-		"\tif curr_y_min < y_min:",
-		"\t\ty_min = curr_y_min",
-		"\tif curr_y_max > y_max:",
-		"\t\ty_max = curr_y_max",
-		"\tax.set_xlim(x_min, x_max)",
-		"\tax.set_ylim(y_min, y_max)",
-		"\t# Gather all the fitnesses in one list and print the stats",
-		"\tlogbook.record(gen=frame, evals=len(pop), **stats.compile(pop))",
-		"\tprint(logbook.stream)",
-		"\treturn scat, best_scat, generation_text",
-	}, "\n\t")
-}
-
-func (pso *PSO) Code() (string, error) {
-	if err := pso.validate(); err != nil {
-		return "", err
+		py.Source(`
+			# Save the position of the best particle
+			out_file = open(f'{rootPath}/best.txt', 'w')
+			out_file.write(f'Best individual fitness: {best.fitness.values}\n')
+			out_file.write(f'Best individual position: {best}\n')
+			out_file.close()
+		`),
+		py.With("open(f'{rootPath}/logbook.txt', 'w') as f", py.Line("f.write(str(logbook))")),
+		saveResults("best", pso.Termination != nil),
 	}
+}
+
+func (pso *PSO) Metadata() RunMetadata {
+	return RunMetadata{Name: fmt.Sprintf("%d-%d", pso.Generations, pso.PopulationSize), Description: "Particle Swarm Optimization", Seed: *pso.Seed}
+}
+
+func (pso *PSO) Command() string {
+	return "python code.py"
+}
+
+func (pso *PSO) Artifacts() ([]Artifact, error) {
+	return nil, nil
+}
 
-	var code string
-	code += pso.imports() + "\n\n"
-	weights := strings.ReplaceAll(strings.ReplaceAll(fmt.Sprintf("%f", pso.Weights), "[", "("), "]", ",)")
-	code += fmt.Sprintf("creator.create('FitnessMax', base.Fitness, weights=%s)\n", weights)
-	code += "creator.create('Particle', numpy.ndarray, fitness=creator.FitnessMax, speed=list, smin=None, smax=None, best=None)\n\n"
-	code += pso.generateAndUpdateParticle() + "\n"
-	code += pso.toolbox() + "\n"
-
-	// main
-	code += strings.Join([]string{
-		"def main():",
-		"\trootPath = os.path.dirname(os.path.abspath(__file__))",
-		fmt.Sprintf("\tpop = toolbox.population(n=%d)", pso.PopulationSize),
-		"\tstats = tools.Statistics(lambda ind: ind.fitness.values)",
-		"\tstats.register('avg', numpy.mean)",
-		"\tstats.register('std', numpy.std)",
-		"\tstats.register('min', numpy.min)",
-		"\tstats.register('max', numpy.max)",
-		"\n\tlogbook = tools.Logbook()",
-		"\tlogbook.header = ['gen', 'evals'] + stats.fields",
-		"\n\tbest = None",
-		fmt.Sprintf("\tGEN = %d", pso.Generations),
-	}, "\n")
-
-	code += pso.setupPlot() + "\n"
-	code += pso.thePSOAlgo() + "\n"
-
-	code += strings.Join([]string{
-		"\tani = animation.FuncAnimation(fig, update, frames=GEN, blit=True, repeat=False)",
-		"\tani.save(f'{rootPath}/pso_animation.gif', writer='pillow', fps=10)",
-
-		"\t# Save the position of the best particle",
-		"\tout_file = open(f'{rootPath}/best.txt', 'w')",
-		"\tout_file.write(f'Best individual fitness: {best.fitness.values}\\n')",
-		"\tout_file.write(f'Best individual position: {best}\\n')",
-		"\tout_file.close()",
-
-		"\twith open(f'{rootPath}/logbook.txt', 'w') as f:",
-		"\t\tf.write(str(logbook))",
-
-		"if __name__ == '__main__':",
-		"\tmain()",
-	}, "\n")
-
-	return code, nil
+// Snippets returns nil, PSO requests have no user-supplied Python.
+func (pso *PSO) Snippets() map[string]string {
+	return nil
 }
@@ -0,0 +1,403 @@
+package py
+
+import (
+	"strings"
+)
+
+// Stmt is a Python statement. Blocks are indented with one tab per level.
+type Stmt interface {
+	render(w *writer, depth int)
+}
+
+// writer lays out rendered lines. Functions and classes are set apart by a
+// blank line, except at the start of a block.
+type writer struct {
+	b        strings.Builder
+	blank    bool // The last line was blank, or nothing was written yet.
+	opened   bool // The last line opened a block.
+	pending  bool // A blank line goes before the next line.
+	sections map[string]Stmt
+}
+
+func (w *writer) line(depth int, text string) {
+	if w.pending && !w.blank && !w.opened {
+		w.b.WriteByte('\n')
+	}
+	w.pending = false
+	w.b.WriteString(strings.Repeat("\t", depth))
+	w.b.WriteString(text)
+	w.b.WriteByte('\n')
+	w.blank = false
+	w.opened = strings.HasSuffix(text, ":")
+}
+
+func (w *writer) blankLine() {
+	if !w.blank && !w.opened {
+		w.b.WriteByte('\n')
+		w.blank = true
+	}
+	w.pending = false
+}
+
+// header writes the first line of a compound statement and its body, or
+// pass for an empty body.
+func (w *writer) header(depth int, text string, body Block) {
+	w.line(depth, text+":")
+	if body.empty() {
+		w.line(depth+1, "pass")
+		return
+	}
+	body.render(w, depth+1)
+}
+
+// Module is a Python source file.
+type Module []Stmt
+
+// String renders m, ending with a newline.
+func (m Module) String() string {
+	return m.Render(nil)
+}
+
+// Render renders m with the Sections named in overrides replaced by their
+// statements. Names m has no Section for are ignored.
+func (m Module) Render(overrides map[string]Stmt) string {
+	w := &writer{blank: true, sections: overrides}
+	Block(m).render(w, 0)
+	return strings.TrimRight(w.b.String(), "\n") + "\n"
+}
+
+// Block is a sequence of statements at the same depth. Nil statements are
+// skipped, so optional parts can be left out in place.
+type Block []Stmt
+
+func (b Block) render(w *writer, depth int) {
+	for _, s := range b {
+		if s != nil {
+			s.render(w, depth)
+		}
+	}
+}
+
+func (b Block) empty() bool {
+	for _, s := range b {
+		switch s := s.(type) {
+		case nil:
+		case Block:
+			if !s.empty() {
+				return false
+			}
+		case source:
+			if len(s.lines) > 0 {
+				return false
+			}
+		case section:
+			if !s.body.empty() {
+				return false
+			}
+		case blank:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type line string
+
+func (l line) render(w *writer, depth int) { w.line(depth, string(l)) }
+
+// Line is a simple statement the generator writes as Python source, such as
+// "break" or "x_min -= x_buffer". It panics if src spans lines.
+func Line(src string) Stmt {
+	oneLine("statement", src)
+	return line(src)
+}
+
+// Assign is target = value.
+func Assign(target string, value Expr) Stmt {
+	return Line(target + " = " + value.Code())
+}
+
+// Do is an expression statement, typically a call.
+func Do(e Expr) Stmt {
+	return line(e.Code())
+}
+
+// Return returns values, as a tuple if there is more than one.
+func Return(values ...Expr) Stmt {
+	if len(values) == 0 {
+		return line("return")
+	}
+	return line("return " + join(values))
+}
+
+// Comment is a comment on a line of its own.
+func Comment(text string) Stmt {
+	return Line("# " + text)
+}
+
+// Import is an import statement of modules, e.g. "os, json".
+func Import(modules string) Stmt {
+	return Line("import " + modules)
+}
+
+// From imports names from module.
+func From(module string, names string) Stmt {
+	return Line("from " + module + " import " + names)
+}
+
+type blank struct{}
+
+func (blank) render(w *writer, depth int) { w.blankLine() }
+
+// Blank is an empty line. Blank lines never start a block or follow one
+// another.
+var Blank Stmt = blank{}
+
+type section struct {
+	name string
+	body Block
+}
+
+func (s section) render(w *writer, depth int) {
+	if override, ok := w.sections[s.name]; ok {
+		if override != nil {
+			override.render(w, depth)
+		}
+		return
+	}
+	s.body.render(w, depth)
+}
+
+// Section is a named part of the code, such as the imports, that
+// Module.Render can replace. It is rendered as body otherwise.
+func Section(name string, body ...Stmt) Stmt {
+	return section{name: name, body: body}
+}
+
+type compound struct {
+	header string
+	body   Block
+}
+
+// block is a compound statement with its clauses, such as if, elif and
+// else. Functions and classes are set apart from their neighbours.
+type block struct {
+	clauses  []compound
+	setApart bool
+}
+
+func (b *block) render(w *writer, depth int) {
+	if b.setApart {
+		w.blankLine()
+	}
+	for _, c := range b.clauses {
+		w.header(depth, c.header, c.body)
+	}
+	w.pending = w.pending || b.setApart
+}
+
+func newBlock(header string, body []Stmt, setApart bool) *block {
+	oneLine("header", header)
+	return &block{clauses: []compound{{header: header, body: body}}, setApart: setApart}
+}
+
+func (b *block) add(header string, body []Stmt) {
+	oneLine("header", header)
+	b.clauses = append(b.clauses, compound{header: header, body: body})
+}
+
+// Def defines a function; signature is its name and parameters, e.g.
+// "update(frame)".
+func Def(signature string, body ...Stmt) Stmt {
+	return newBlock("def "+signature, body, true)
+}
+
+// Class defines a class; signature is its name and bases, if any.
+func Class(signature string, body ...Stmt) Stmt {
+	return newBlock("class "+signature, body, true)
+}
+
+// For loops over iter, a Python expression, binding target.
+func For(target string, iter string, body ...Stmt) Stmt {
+	return newBlock("for "+target+" in "+iter, body, false)
+}
+
+// While loops while cond holds.
+func While(cond string, body ...Stmt) Stmt {
+	return newBlock("while "+cond, body, false)
+}
+
+// With runs body in the context of items, e.g. "open(path) as f".
+func With(items string, body ...Stmt) Stmt {
+	return newBlock("with "+items, body, false)
+}
+
+// IfStmt is an if statement. Elif and Else add clauses.
+type IfStmt struct {
+	block
+}
+
+// If runs body when cond holds.
+func If(cond string, body ...Stmt) *IfStmt {
+	return &IfStmt{*newBlock("if "+cond, body, false)}
+}
+
+// Elif adds an elif clause and returns s.
+func (s *IfStmt) Elif(cond string, body ...Stmt) *IfStmt {
+	s.add("elif "+cond, body)
+	return s
+}
+
+// Else adds the else clause and returns s.
+func (s *IfStmt) Else(body ...Stmt) *IfStmt {
+	s.add("else", body)
+	return s
+}
+
+// TryStmt is a try statement. Except adds handlers.
+type TryStmt struct {
+	block
+}
+
+// Try runs body, with the handlers added by Except.
+func Try(body ...Stmt) *TryStmt {
+	return &TryStmt{*newBlock("try", body, false)}
+}
+
+// Except adds a handler of clause, e.g. "ZeroDivisionError", and returns s.
+func (s *TryStmt) Except(clause string, body ...Stmt) *TryStmt {
+	s.add("except "+clause, body)
+	return s
+}
+
+type source struct {
+	lines    []string
+	setApart bool
+}
+
+func (s source) render(w *writer, depth int) {
+	if s.setApart {
+		w.blankLine()
+	}
+	for _, l := range s.lines {
+		if l == "" {
+			w.blankLine()
+			continue
+		}
+		w.line(depth, l)
+	}
+	w.pending = w.pending || s.setApart
+}
+
+// Source is Python written out as text: fixed helper code, or a snippet
+// from a request. Its statements are indented with one tab per block level
+// from the depth they are placed at, whether it is indented with tabs or
+// spaces. Source that starts with a function, class or decorator is set
+// apart like Def.
+func Source(src string) Stmt {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	lines = reindent(lines)
+
+	s := source{lines: lines}
+	if len(lines) > 0 {
+		first := lines[0]
+		s.setApart = strings.HasPrefix(first, "def ") || strings.HasPrefix(first, "async def ") || strings.HasPrefix(first, "class ") || strings.HasPrefix(first, "@")
+	}
+	return s
+}
+
+// reindent indents each statement of lines with one tab per block level,
+// counting levels the way Python does. Lines that continue a statement,
+// inside brackets or a triple-quoted string, only lose the indentation of
+// the least indented statement. Comments keep the level of the block they
+// are indented to.
+func reindent(lines []string) []string {
+	continued := continuationLines(lines)
+	base, prefix := -1, ""
+	for i, l := range lines {
+		if continued[i] || strings.TrimSpace(l) == "" || strings.HasPrefix(strings.TrimSpace(l), "#") {
+			continue
+		}
+		if width, n := indentation(l); base < 0 || width < base {
+			base, prefix = width, l[:n]
+		}
+	}
+
+	levels := []int{max(base, 0)}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		text := strings.TrimLeft(l, " \t")
+		width, _ := indentation(l)
+		switch {
+		case strings.TrimSpace(text) == "":
+		case continued[i]:
+			out[i] = strings.TrimPrefix(l, prefix)
+		case strings.HasPrefix(text, "#"):
+			// A comment more indented than the block opens the next one.
+			level := 0
+			for level < len(levels) && levels[level] <= width {
+				level++
+			}
+			if width <= levels[len(levels)-1] {
+				level--
+			}
+			out[i] = strings.Repeat("\t", max(level, 0)) + text
+		default:
+			for width < levels[len(levels)-1] {
+				levels = levels[:len(levels)-1]
+			}
+			if width > levels[len(levels)-1] {
+				levels = append(levels, width)
+			}
+			out[i] = strings.Repeat("\t", len(levels)-1) + text
+		}
+	}
+	return out
+}
+
+// indentation returns the width of the indentation of l, with tabs to the
+// next multiple of eight as in Python, and its length in bytes.
+func indentation(l string) (width int, n int) {
+	for n < len(l) {
+		switch l[n] {
+		case ' ':
+			width++
+		case '\t':
+			width = width/8*8 + 8
+		default:
+			return width, n
+		}
+		n++
+	}
+	return width, n
+}
+
+// continuationLines reports which lines continue the statement of an
+// earlier line. Source that does not tokenize has none.
+func continuationLines(lines []string) []bool {
+	continued := make([]bool, len(lines))
+	tokens, err := Tokenize(strings.Join(lines, "\n"))
+	if err != nil {
+		return continued
+	}
+	first := 0
+	for i, tok := range tokens {
+		if tok.Kind == Newline {
+			continue
+		}
+		if i == 0 || tokens[i-1].Kind == Newline {
+			first = tok.Line
+		}
+		for line := first + 1; line <= tok.Line+strings.Count(tok.Value, "\n"); line++ {
+			continued[line-1] = true
+		}
+	}
+	return continued
+}
@@ -0,0 +1,45 @@
+package py
+
+import "testing"
+
+func TestSourceIndentation(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "spaces",
+			src:  "x = 1\nif x:\n    y = 2\n    if y:\n        z = 3\nreturn x",
+			want: "def f():\n\tx = 1\n\tif x:\n\t\ty = 2\n\t\tif y:\n\t\t\tz = 3\n\treturn x\n",
+		},
+		{
+			name: "indented snippet",
+			src:  "\n    for i in range(3):\n      print(i)\n    return i\n",
+			want: "def f():\n\tfor i in range(3):\n\t\tprint(i)\n\treturn i\n",
+		},
+		{
+			name: "tabs and spaces",
+			src:  "if a:\n\tif b:\n\t        c()\n        d()",
+			want: "def f():\n\tif a:\n\t\tif b:\n\t\t\tc()\n\t\td()\n",
+		},
+		{
+			name: "continuation lines",
+			src:  "  x = g(1,\n        2)\n  s = '''a\n    b'''\n  y = 1 + \\\n      2",
+			want: "def f():\n\tx = g(1,\n\t      2)\n\ts = '''a\n\t  b'''\n\ty = 1 + \\\n\t    2\n",
+		},
+		{
+			name: "comments",
+			src:  "if x:\n    # opens the block\n    y = 1\n    # ends it\n# after it\nz = 2",
+			want: "def f():\n\tif x:\n\t\t# opens the block\n\t\ty = 1\n\t\t# ends it\n\t# after it\n\tz = 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Module{Def("f()", Source(tt.src))}).String(); got != tt.want {
+				t.Errorf("Source(%q) renders\n%s\nwant\n%s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package py
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expr is a Python expression. Code renders it on a single line.
+type Expr interface {
+	Code() string
+}
+
+type raw string
+
+func (r raw) Code() string { return string(r) }
+
+// None is Python's None.
+var None Expr = raw("None")
+
+// Raw is an expression the generator writes as Python source, such as a
+// dotted name or a comprehension. Values from a request never go through
+// Raw: use the literals, which quote them. It panics if src spans lines.
+func Raw(src string) Expr {
+	oneLine("expression", src)
+	return raw(src)
+}
+
+// Rawf formats an expression like fmt.Sprintf. Args that are an Expr are
+// rendered by their Code, so literals can be placed into source.
+func Rawf(format string, args ...any) Expr {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg
+		if e, ok := arg.(Expr); ok {
+			values[i] = e.Code()
+		}
+	}
+	return Raw(fmt.Sprintf(format, values...))
+}
+
+// oneLine panics if src, a header or expression of generated code, spans
+// lines. Such a line would escape the indentation of its block.
+func oneLine(what string, src string) {
+	if strings.ContainsAny(src, "\r\n") {
+		panic(fmt.Sprintf("py: %s spans lines: %q", what, src))
+	}
+}
+
+// Quote renders s as a single-quoted Python string literal. Only printable
+// ASCII other than the quote and the backslash is written as is; anything
+// else is escaped, so the literal is always one line and s cannot end it.
+// Invalid UTF-8 becomes U+FFFD.
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r < 0x100:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r < 0x10000:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			fmt.Fprintf(&b, `\U%08x`, r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// Str is a string literal. Every generator puts strings into generated code
+// through it.
+func Str(s string) Expr {
+	return raw(Quote(s))
+}
+
+// Bool is True or False.
+func Bool(value bool) Expr {
+	if value {
+		return raw("True")
+	}
+	return raw("False")
+}
+
+// Int is an integer literal.
+func Int[T ~int | ~int64](value T) Expr {
+	return raw(strconv.FormatInt(int64(value), 10))
+}
+
+// Float is a number literal in its shortest form. Infinities and NaN, which
+// have no literal, are rendered as calls to float.
+func Float(value float64) Expr {
+	switch {
+	case math.IsInf(value, 1):
+		return raw("float('inf')")
+	case math.IsInf(value, -1):
+		return raw("float('-inf')")
+	case math.IsNaN(value):
+		return raw("float('nan')")
+	}
+	return raw(strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Floats renders each of values with Float.
+func Floats(values []float64) []Expr {
+	items := make([]Expr, len(values))
+	for i, value := range values {
+		items[i] = Float(value)
+	}
+	return items
+}
+
+// Strs renders each of values with Str.
+func Strs(values []string) []Expr {
+	items := make([]Expr, len(values))
+	for i, value := range values {
+		items[i] = Str(value)
+	}
+	return items
+}
+
+// List is a list display.
+func List(items ...Expr) Expr {
+	return raw("[" + join(items) + "]")
+}
+
+// Tuple is a tuple display; a single item keeps its trailing comma.
+func Tuple(items ...Expr) Expr {
+	if len(items) == 1 {
+		return raw("(" + items[0].Code() + ",)")
+	}
+	return raw("(" + join(items) + ")")
+}
+
+// Entry is a key and value of a Dict.
+type Entry struct {
+	Key   Expr
+	Value Expr
+}
+
+// Dict is a dict display, in the order of entries.
+func Dict(entries ...Entry) Expr {
+	items := make([]string, len(entries))
+	for i, e := range entries {
+		items[i] = e.Key.Code() + ": " + e.Value.Code()
+	}
+	return raw("{" + strings.Join(items, ", ") + "}")
+}
+
+// CallExpr is a call. Keyword arguments follow the positional ones in the
+// order they were added.
+type CallExpr struct {
+	fn     string
+	args   []Expr
+	kwargs []Entry
+}
+
+// Call calls fn, a name or dotted name, with args.
+func Call(fn string, args ...Expr) *CallExpr {
+	oneLine("function", fn)
+	return &CallExpr{fn: fn, args: args}
+}
+
+// Kw adds the keyword argument name=value and returns c.
+func (c *CallExpr) Kw(name string, value Expr) *CallExpr {
+	c.kwargs = append(c.kwargs, Entry{Key: raw(name), Value: value})
+	return c
+}
+
+func (c *CallExpr) Code() string {
+	items := make([]string, 0, len(c.args)+len(c.kwargs))
+	for _, arg := range c.args {
+		items = append(items, arg.Code())
+	}
+	for _, kw := range c.kwargs {
+		items = append(items, kw.Key.Code()+"="+kw.Value.Code())
+	}
+	return c.fn + "(" + strings.Join(items, ", ") + ")"
+}
+
+func join(items []Expr) string {
+	codes := make([]string, len(items))
+	for i, item := range items {
+		codes[i] = item.Code()
+	}
+	return strings.Join(codes, ", ")
+}
@@ -0,0 +1,107 @@
+package py
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodePython decodes a single-quoted Python string literal, as Python
+// reads it from source.
+func decodePython(literal string) (string, error) {
+	if len(literal) < 2 || literal[0] != '\'' || literal[len(literal)-1] != '\'' {
+		return "", fmt.Errorf("not a single-quoted literal")
+	}
+	body := literal[1 : len(literal)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'':
+			return "", fmt.Errorf("unescaped quote at %d ends the literal", i)
+		case c == '\n' || c == '\r':
+			return "", fmt.Errorf("line break at %d", i)
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", fmt.Errorf("backslash escapes the closing quote")
+		}
+		hex := 0
+		switch e := body[i]; e {
+		case '\\', '\'', '"':
+			b.WriteByte(e)
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			hex = 2
+		case 'u':
+			hex = 4
+		case 'U':
+			hex = 8
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 1
+			for n < 3 && i+n < len(body) && body[i+n] >= '0' && body[i+n] <= '7' {
+				n++
+			}
+			value, _ := strconv.ParseUint(body[i:i+n], 8, 32)
+			b.WriteRune(rune(value))
+			i += n - 1
+		case 'N':
+			return "", fmt.Errorf("named escape at %d", i)
+		default:
+			// Python keeps unknown escapes as they are.
+			b.WriteByte('\\')
+			b.WriteByte(e)
+		}
+		if hex > 0 {
+			if i+hex >= len(body) {
+				return "", fmt.Errorf("truncated escape at %d", i)
+			}
+			value, err := strconv.ParseUint(body[i+1:i+1+hex], 16, 32)
+			if err != nil || value > 0x10ffff {
+				return "", fmt.Errorf("invalid escape at %d", i)
+			}
+			b.WriteRune(rune(value))
+			i += hex
+		}
+	}
+	return b.String(), nil
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, s := range []string{"", "abc", "it's", `C:\path`, "a\nb\r\nc\td", "\x00\x7f\x80", "é€😀", "\xff\xfe", "\u2028\u0085", `\N{BULLET}`, "'''", "\\'"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		literal := Quote(s)
+		for i := 0; i < len(literal); i++ {
+			if c := literal[i]; c < 0x20 || c > 0x7e {
+				t.Fatalf("Quote(%q) = %q has byte %#x, want printable ASCII on one line", s, literal, c)
+			}
+		}
+		decoded, err := decodePython(literal)
+		if err != nil {
+			t.Fatalf("Quote(%q) = %q is not a Python literal: %v", s, literal, err)
+		}
+		// Invalid UTF-8 decodes to U+FFFD, a byte at a time.
+		if want := string([]rune(s)); decoded != want {
+			t.Fatalf("Quote(%q) = %q decodes to %q, want %q", s, literal, decoded, want)
+		}
+	})
+}
@@ -0,0 +1,372 @@
+package py
+
+import (
+	"evolve/util"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy decides which Python snippets may be run. Admins can change it;
+// DefaultPolicy applies until they do.
+type Policy struct {
+	BlockedImports        []string `json:"blockedImports"`        // Modules, including their submodules.
+	BlockedBuiltins       []string `json:"blockedBuiltins"`       // Names that may not be referenced.
+	BlockedAttributes     []string `json:"blockedAttributes"`     // Dotted names such as "os.system"; a trailing "*" matches any suffix.
+	BlockDunderAttributes bool     `json:"blockDunderAttributes"` // Block attributes such as __class__ and __subclasses__.
+	MaxBytes              int      `json:"maxBytes"`              // Size limit of a snippet.
+	MaxLines              int      `json:"maxLines"`              // Line limit of a snippet.
+}
+
+// Rules reported in a Violation.
+const (
+	RuleImport    = "import"
+	RuleBuiltin   = "builtin"
+	RuleAttribute = "attribute"
+	RuleSize      = "size"
+	RuleSyntax    = "syntax"
+	RuleName      = "name"
+)
+
+// Limits on the size limits an admin can set.
+const (
+	maxBytesLimit = 1 << 20
+	maxLinesLimit = 100000
+)
+
+// Dunder attributes that are safe and common in user code.
+var allowedDunders = []string{"__init__", "__name__", "__doc__", "__len__", "__call__"}
+
+// DefaultPolicy blocks process, network, file system and FFI access, and
+// the builtins that run or import code by name.
+func DefaultPolicy() Policy {
+	return Policy{
+		BlockedImports: []string{
+			"subprocess", "socket", "ctypes", "shutil", "importlib", "multiprocessing", "pty",
+			"signal", "http", "urllib", "ftplib", "smtplib", "telnetlib", "requests", "sys", "builtins", "posix",
+		},
+		BlockedBuiltins: []string{
+			"eval", "exec", "compile", "__import__", "globals", "locals", "vars",
+			"getattr", "setattr", "delattr", "open", "input", "breakpoint", "__builtins__",
+		},
+		BlockedAttributes: []string{
+			"os.system", "os.popen", "os.exec*", "os.spawn*", "os.posix_spawn*", "os.fork*", "os.kill*",
+			"os.open", "os.fdopen", "os.remove", "os.unlink", "os.rmdir", "os.removedirs", "os.rename",
+			"os.replace", "os.chmod", "os.chown", "os.environ", "os.putenv", "os.setuid", "os.setgid",
+			"io.open*", "io.FileIO", "pickle.load*", "numpy.load",
+		},
+		BlockDunderAttributes: true,
+		MaxBytes:              64 << 10,
+		MaxLines:              1000,
+	}
+}
+
+// Validate checks a policy set by an admin.
+func (p *Policy) Validate(v *util.ValidationError) {
+	v.IntRange("maxBytes", p.MaxBytes, 1, maxBytesLimit)
+	v.IntRange("maxLines", p.MaxLines, 1, maxLinesLimit)
+	for i, name := range p.BlockedImports {
+		v.Relation(fmt.Sprintf("blockedImports[%d]", i), isDottedName(name), "must be a module name such as os.path")
+	}
+	for i, name := range p.BlockedBuiltins {
+		v.Relation(fmt.Sprintf("blockedBuiltins[%d]", i), isDottedName(name) && !strings.Contains(name, "."), "must be a name such as eval")
+	}
+	for i, name := range p.BlockedAttributes {
+		v.Relation(fmt.Sprintf("blockedAttributes[%d]", i), isDottedName(strings.TrimSuffix(name, "*")) && strings.Contains(name, "."), "must be a dotted name such as os.system, optionally ending in *")
+	}
+}
+
+func isDottedName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, part := range strings.Split(name, ".") {
+		tokens, err := Tokenize(part)
+		if err != nil || len(tokens) != 2 || tokens[0].Kind != Name || tokens[0].Value != part {
+			return false
+		}
+	}
+	return true
+}
+
+// Violation is a part of a snippet the policy does not allow.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func violation(rule string, tok Token, format string, args ...any) Violation {
+	return Violation{Rule: rule, Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+// Check returns every violation of the policy in src.
+func (p *Policy) Check(src string) []Violation {
+	var violations []Violation
+	if len(src) > p.MaxBytes {
+		line := strings.Count(src[:p.MaxBytes], "\n") + 1
+		column := len([]rune(src[strings.LastIndex(src[:p.MaxBytes], "\n")+1:p.MaxBytes])) + 1
+		violations = append(violations, Violation{Rule: RuleSize, Line: line, Column: column, Message: fmt.Sprintf("exceeds %d bytes", p.MaxBytes)})
+	}
+	if lines := strings.Split(strings.TrimRight(src, "\n"), "\n"); len(lines) > p.MaxLines {
+		violations = append(violations, Violation{Rule: RuleSize, Line: p.MaxLines + 1, Column: 1, Message: fmt.Sprintf("exceeds %d lines", p.MaxLines)})
+	}
+
+	tokens, err := Tokenize(src)
+	if err != nil {
+		serr := err.(*SyntaxError)
+		return append(violations, Violation{Rule: RuleSyntax, Line: serr.Line, Column: serr.Column, Message: serr.Message})
+	}
+
+	// Python compares names after NFKC normalization, so ｅｖａｌ is eval:
+	// only ASCII names are compared reliably.
+	for _, tok := range tokens {
+		if tok.Kind == Name && !isASCII(tok.Value) {
+			violations = append(violations, violation(RuleName, tok, "name %s is not ASCII", tok.Value))
+		}
+	}
+
+	aliases := importAliases(tokens)
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Kind != Name {
+			continue
+		}
+		afterDot := i > 0 && tokens[i-1].Kind == Op && tokens[i-1].Value == "."
+
+		switch {
+		case tok.Value == "import" && !afterDot:
+			violations = append(violations, p.checkImport(tokens, i)...)
+			i = statementEnd(tokens, i)
+		case tok.Value == "from" && !afterDot:
+			violations = append(violations, p.checkFromImport(tokens, i)...)
+			i = statementEnd(tokens, i)
+		case afterDot:
+			if p.BlockDunderAttributes && isDunder(tok.Value) && !slices.Contains(allowedDunders, tok.Value) {
+				violations = append(violations, violation(RuleAttribute, tok, "attribute %s is not allowed", tok.Value))
+			}
+		default:
+			if slices.Contains(p.BlockedBuiltins, tok.Value) {
+				violations = append(violations, violation(RuleBuiltin, tok, "%s is not allowed", tok.Value))
+				continue
+			}
+			// Attribute chains such as os.path.join start with a plain name,
+			// which may be an alias of a module or one of its attributes.
+			chain, end := dottedName(tokens, i)
+			resolved := resolveAlias(chain, aliases)
+			if blocked := p.blockedAttribute(resolved); blocked != "" {
+				violations = append(violations, violation(RuleAttribute, tok, "%s is not allowed", blocked))
+				continue
+			}
+			// A module with blocked attributes cannot be passed around, as
+			// its attributes would then be reached through another name.
+			assigned := end < len(tokens) && isOp(tokens[end], "=") && !(end+1 < len(tokens) && isOp(tokens[end+1], "="))
+			if end == i+1 && !assigned && p.attributesBlocked(resolved) {
+				violations = append(violations, violation(RuleAttribute, tok, "%s may only be used for its attributes", resolved))
+			}
+		}
+	}
+	return violations
+}
+
+// checkImport checks "import a.b as c, d" starting at tokens[i].
+func (p *Policy) checkImport(tokens []Token, i int) []Violation {
+	// "from x import y" is checked by checkFromImport.
+	for j := i - 1; j >= 0 && tokens[j].Kind != Newline && !isOp(tokens[j], ";"); j-- {
+		if tokens[j].Kind == Name && tokens[j].Value == "from" {
+			return nil
+		}
+	}
+
+	var violations []Violation
+	for j := i + 1; j < len(tokens) && tokens[j].Kind != Newline && !isOp(tokens[j], ";"); j++ {
+		if tokens[j].Kind != Name || (j > i+1 && !isOp(tokens[j-1], ",") && !isOp(tokens[j-1], "(")) {
+			continue
+		}
+		module, end := dottedName(tokens, j)
+		if p.blockedImport(module) {
+			violations = append(violations, violation(RuleImport, tokens[j], "import of %s is not allowed", module))
+		}
+		j = end - 1
+	}
+	return violations
+}
+
+// checkFromImport checks "from a.b import c, d" starting at tokens[i]. The
+// imported names are checked as attributes of the module too.
+func (p *Policy) checkFromImport(tokens []Token, i int) []Violation {
+	j := i + 1
+	// Relative imports stay inside the user's own package.
+	if j < len(tokens) && isOp(tokens[j], ".") {
+		return nil
+	}
+	if j >= len(tokens) || tokens[j].Kind != Name {
+		return nil
+	}
+	module, end := dottedName(tokens, j)
+	if p.blockedImport(module) {
+		return []Violation{violation(RuleImport, tokens[j], "import of %s is not allowed", module)}
+	}
+	if end >= len(tokens) || tokens[end].Value != "import" {
+		return nil
+	}
+
+	var violations []Violation
+	for k := end + 1; k < len(tokens) && tokens[k].Kind != Newline && !isOp(tokens[k], ";"); k++ {
+		// A star import binds names that are not written out.
+		if isOp(tokens[k], "*") {
+			violations = append(violations, violation(RuleImport, tokens[k], "import * from %s is not allowed", module))
+			continue
+		}
+		// Aliases do not change what is imported.
+		if tokens[k].Kind != Name || isName(tokens[k], "as") || isName(tokens[k-1], "as") {
+			continue
+		}
+		name := module + "." + tokens[k].Value
+		if p.blockedImport(name) {
+			violations = append(violations, violation(RuleImport, tokens[k], "import of %s is not allowed", name))
+		} else if blocked := p.blockedAttribute(name); blocked != "" {
+			violations = append(violations, violation(RuleAttribute, tokens[k], "%s is not allowed", blocked))
+		}
+	}
+	return violations
+}
+
+// statementEnd returns the index of the last token of the simple statement
+// that tokens[i] is part of.
+func statementEnd(tokens []Token, i int) int {
+	for i+1 < len(tokens) && tokens[i+1].Kind != Newline && !isOp(tokens[i+1], ";") {
+		i++
+	}
+	return i
+}
+
+// importAliases maps the names import statements bind to what they stand
+// for: o to os for "import os as o", and l to numpy.load for "from numpy
+// import load as l". Names are mapped wherever they are bound. Other
+// bindings, such as "o = os", are not followed: Check rejects the module
+// value they need instead.
+func importAliases(tokens []Token) map[string]string {
+	aliases := map[string]string{}
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Kind != Name || i > 0 && isOp(tokens[i-1], ".") {
+			continue
+		}
+		switch tokens[i].Value {
+		case "import":
+			// "import a.b" binds a, which needs no alias.
+			for j := i + 1; j < len(tokens) && tokens[j].Kind != Newline && !isOp(tokens[j], ";"); j++ {
+				if tokens[j].Kind != Name || isName(tokens[j], "as") || isName(tokens[j-1], "as") {
+					continue
+				}
+				module, end := dottedName(tokens, j)
+				if end+1 < len(tokens) && isName(tokens[end], "as") && tokens[end+1].Kind == Name {
+					aliases[tokens[end+1].Value] = module
+				}
+				j = end - 1
+			}
+		case "from":
+			if i+1 >= len(tokens) || tokens[i+1].Kind != Name {
+				continue
+			}
+			module, end := dottedName(tokens, i+1)
+			if end >= len(tokens) || !isName(tokens[end], "import") {
+				continue
+			}
+			for k := end + 1; k < len(tokens) && tokens[k].Kind != Newline && !isOp(tokens[k], ";"); k++ {
+				if tokens[k].Kind != Name || isName(tokens[k], "as") || isName(tokens[k-1], "as") {
+					continue
+				}
+				name := tokens[k].Value
+				if k+2 < len(tokens) && isName(tokens[k+1], "as") && tokens[k+2].Kind == Name {
+					name = tokens[k+2].Value
+				}
+				aliases[name] = module + "." + tokens[k].Value
+			}
+		}
+	}
+	return aliases
+}
+
+// resolveAlias replaces the first name of chain by what it is an alias of.
+func resolveAlias(chain string, aliases map[string]string) string {
+	first, rest, _ := strings.Cut(chain, ".")
+	target, ok := aliases[first]
+	if !ok {
+		return chain
+	}
+	if rest == "" {
+		return target
+	}
+	return target + "." + rest
+}
+
+// attributesBlocked reports whether module has attributes the policy
+// blocks, such as os for os.system.
+func (p *Policy) attributesBlocked(module string) bool {
+	for _, blocked := range p.BlockedAttributes {
+		if i := strings.LastIndex(blocked, "."); i > 0 && blocked[:i] == module {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) blockedImport(module string) bool {
+	for _, blocked := range p.BlockedImports {
+		if module == blocked || strings.HasPrefix(module, blocked+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedAttribute returns the pattern that blocks chain or one of its
+// prefixes, or "" if none does.
+func (p *Policy) blockedAttribute(chain string) string {
+	parts := strings.Split(chain, ".")
+	for n := 2; n <= len(parts); n++ {
+		prefix := strings.Join(parts[:n], ".")
+		for _, blocked := range p.BlockedAttributes {
+			if pattern, wildcard := strings.CutSuffix(blocked, "*"); wildcard && strings.HasPrefix(prefix, pattern) || prefix == blocked {
+				return prefix
+			}
+		}
+	}
+	return ""
+}
+
+// dottedName reads "a.b.c" starting at tokens[i] and returns it with the
+// index after its last token.
+func dottedName(tokens []Token, i int) (string, int) {
+	parts := []string{tokens[i].Value}
+	j := i + 1
+	for j+1 < len(tokens) && isOp(tokens[j], ".") && tokens[j+1].Kind == Name {
+		parts = append(parts, tokens[j+1].Value)
+		j += 2
+	}
+	return strings.Join(parts, "."), j
+}
+
+func isOp(tok Token, value string) bool {
+	return tok.Kind == Op && tok.Value == value
+}
+
+func isName(tok Token, value string) bool {
+	return tok.Kind == Name && tok.Value == value
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func isDunder(name string) bool {
+	return len(name) > 4 && strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__")
+}
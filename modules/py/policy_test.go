@@ -0,0 +1,100 @@
+package py
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckBlocksBypasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		rule    string
+		message string
+	}{
+		{"module alias", "import os as o\no.system('ls')", RuleAttribute, "os.system is not allowed"},
+		{"numpy alias", "import numpy as np\nnp.load('x')", RuleAttribute, "numpy.load is not allowed"},
+		{"pickle alias", "import pickle as p\np.loads(b'')", RuleAttribute, "pickle.loads is not allowed"},
+		{"submodule alias", "import os.path as op\nop.join('a')\nimport os as o2\no2.path.join('a')\no2.popen('ls')", RuleAttribute, "os.popen is not allowed"},
+		{"from import alias", "from os import path as q\nfrom os import system as run\nrun('ls')", RuleAttribute, "os.system is not allowed"},
+		{"f-string import", `x = f"{__import__('os').system('ls')}"`, RuleBuiltin, "__import__ is not allowed"},
+		{"f-string eval", `x = f"{eval('1')}"`, RuleBuiltin, "eval is not allowed"},
+		{"f-string attribute", `import os` + "\n" + `x = f"{os.system('ls')}"`, RuleAttribute, "os.system is not allowed"},
+		{"f-string alias", "import os as o\n" + `x = f"{o.system('ls')}"`, RuleAttribute, "os.system is not allowed"},
+		{"f-string dunder", `x = f"{().__class__}"`, RuleAttribute, "attribute __class__ is not allowed"},
+		{"nested f-string", `x = f"{f'{eval(1)}'}"`, RuleBuiltin, "eval is not allowed"},
+		{"format spec field", `x = f"{1:>{eval('3')}}"`, RuleBuiltin, "eval is not allowed"},
+		{"conversion", `x = f"{eval('1')!r}"`, RuleBuiltin, "eval is not allowed"},
+		{"backslash before brace", `x = f"\{eval('1')}"`, RuleBuiltin, "eval is not allowed"},
+		{"raw f-string", `x = rf"{eval('1')}"`, RuleBuiltin, "eval is not allowed"},
+		{"triple-quoted f-string", "x = f'''\n{\neval('1')\n}\n'''", RuleBuiltin, "eval is not allowed"},
+		{"star import", "from os import *\nsystem('id')", RuleImport, "import * from os is not allowed"},
+		{"module assigned", "o = os\no.system('id')", RuleAttribute, "os may only be used for its attributes"},
+		{"module passed", "f(os)", RuleAttribute, "os may only be used for its attributes"},
+		{"module returned", "def f():\n    return os", RuleAttribute, "os may only be used for its attributes"},
+		{"aliased module assigned", "import pickle as p\nq = p", RuleAttribute, "pickle may only be used for its attributes"},
+		{"fullwidth builtin", "ｅｖａｌ('1')", RuleName, "name ｅｖａｌ is not ASCII"},
+		{"fullwidth module", "ｏｓ.system('id')", RuleName, "name ｏｓ is not ASCII"},
+		{"fullwidth import", "from ｓｕｂｐｒｏｃｅｓｓ import run", RuleName, "name ｓｕｂｐｒｏｃｅｓｓ is not ASCII"},
+		{"posix_spawnp", "os.posix_spawnp('id', ['id'], {})", RuleAttribute, "os.posix_spawnp is not allowed"},
+		{"execvp", "os.execvp('id', ['id'])", RuleAttribute, "os.execvp is not allowed"},
+		{"spawnlp", "os.spawnlp(0, 'id', 'id')", RuleAttribute, "os.spawnlp is not allowed"},
+		{"io.open", "io.open('/etc/passwd')", RuleAttribute, "io.open is not allowed"},
+		{"posix module", "import posix\nposix.system('id')", RuleImport, "import of posix is not allowed"},
+	}
+
+	policy := DefaultPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := policy.Check(tt.src)
+			if !slices.ContainsFunc(violations, func(v Violation) bool { return v.Rule == tt.rule && v.Message == tt.message }) {
+				t.Errorf("Check(%q) = %+v, want a %s violation %q", tt.src, violations, tt.rule, tt.message)
+			}
+		})
+	}
+}
+
+func TestCheckAllowsFStrings(t *testing.T) {
+	srcs := []string{
+		`x = f"{{eval('1')}}"`,
+		`x = f"{value!r:>10} and {{braces}}"`,
+		`x = f"{'}'}"`,
+		`x = f"{a[1:2]} {b!s} {c != d} {e:{width}.{precision}}"`,
+		`x = f"\N{BULLET} {y}"`,
+		`x = "{eval('1')}"`,
+		"import numpy as np\nx = np.array([1, 2])",
+		"import os as o\nx = o.path.join('a', 'b')",
+		"os = 1",
+		"f(os=1)",
+		"x = os.path.join('a', 'b')",
+		"x = np.mean(pop)",
+	}
+
+	policy := DefaultPolicy()
+	for _, src := range srcs {
+		if violations := policy.Check(src); len(violations) > 0 {
+			t.Errorf("Check(%q) = %+v, want none", src, violations)
+		}
+	}
+}
+
+func TestTokenizeFStringFields(t *testing.T) {
+	tokens, err := Tokenize(`f"a{b.c}d" + e`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Value)
+	}
+	want := []string{`f"a{b.c}d"`, "(", "b", ".", "c", ")", "+", "e", ""}
+	if !slices.Equal(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+
+	for _, src := range []string{`f"{x"`, `f"{x`, `f"{x!r"`} {
+		if _, err := Tokenize(src); err == nil {
+			t.Errorf("Tokenize(%q) succeeded, want a syntax error", src)
+		}
+	}
+}
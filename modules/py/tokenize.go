@@ -0,0 +1,275 @@
+// Package py checks user-supplied Python snippets against a Policy before
+// they are pasted into generated code, and builds that code: a Module of
+// statements and expressions that renders its own indentation and quoting.
+package py
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Kind is the kind of a Token.
+type Kind int
+
+const (
+	Name    Kind = iota // Identifiers and keywords.
+	Number              // Numeric literals.
+	String              // String and bytes literals, including f-strings.
+	Op                  // Operators and delimiters, one rune each.
+	Newline             // End of a logical line.
+)
+
+// Token is a lexical token. Line and Column are 1-based; Column counts runes.
+type Token struct {
+	Kind   Kind
+	Value  string
+	Line   int
+	Column int
+}
+
+// SyntaxError is returned by Tokenize for input that is not valid Python,
+// such as an unterminated string.
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+type tokenizer struct {
+	src    []rune
+	pos    int
+	line   int
+	column int
+	depth  int // Open brackets; newlines inside them do not end the line.
+	tokens []Token
+}
+
+// Tokenize splits src into tokens. Comments and indentation are dropped,
+// and a Newline token ends every logical line that has tokens. The
+// replacement fields of an f-string follow its String token, each as the
+// tokens of its expression between "(" and ")", so they are checked like
+// any other code.
+func Tokenize(src string) ([]Token, error) {
+	t := &tokenizer{src: []rune(src), line: 1, column: 1}
+	if err := t.scan(-1); err != nil {
+		return nil, err
+	}
+	t.endLine()
+	return t.tokens, nil
+}
+
+// scan emits the tokens up to the end of the source or, when field is the
+// bracket depth of an open replacement field, up to the end of its
+// expression: a "}", ":" or "!" outside further brackets.
+func (t *tokenizer) scan(field int) error {
+	for t.pos < len(t.src) {
+		r := t.src[t.pos]
+		if t.depth == field && (r == '}' || r == ':' || r == '!' && t.peek(1) != '=') {
+			return nil
+		}
+		switch {
+		case r == '\n':
+			if t.depth == 0 {
+				t.endLine()
+			}
+			t.advance()
+		case r == '\\' && t.peek(1) == '\n':
+			// Explicit line joining.
+			t.advance()
+			t.advance()
+		case unicode.IsSpace(r):
+			t.advance()
+		case r == '#':
+			for t.pos < len(t.src) && t.src[t.pos] != '\n' {
+				t.advance()
+			}
+		case t.stringStart() > 0:
+			if err := t.string(t.stringStart()); err != nil {
+				return err
+			}
+		case r == '_' || unicode.IsLetter(r):
+			t.name()
+		case unicode.IsDigit(r) || (r == '.' && unicode.IsDigit(t.peek(1))):
+			t.number()
+		default:
+			switch r {
+			case '(', '[', '{':
+				t.depth++
+			case ')', ']', '}':
+				if t.depth == max(field, 0) {
+					return &SyntaxError{Line: t.line, Column: t.column, Message: fmt.Sprintf("unmatched %q", r)}
+				}
+				t.depth--
+			}
+			t.emit(Op, string(r), t.line, t.column)
+			t.advance()
+		}
+	}
+	if field >= 0 {
+		return &SyntaxError{Line: t.line, Column: t.column, Message: "unterminated string literal"}
+	}
+	return nil
+}
+
+func (t *tokenizer) peek(n int) rune {
+	if t.pos+n < len(t.src) {
+		return t.src[t.pos+n]
+	}
+	return 0
+}
+
+func (t *tokenizer) advance() {
+	if t.src[t.pos] == '\n' {
+		t.line++
+		t.column = 1
+	} else {
+		t.column++
+	}
+	t.pos++
+}
+
+func (t *tokenizer) emit(kind Kind, value string, line int, column int) {
+	t.tokens = append(t.tokens, Token{Kind: kind, Value: value, Line: line, Column: column})
+}
+
+func (t *tokenizer) endLine() {
+	if n := len(t.tokens); n > 0 && t.tokens[n-1].Kind != Newline {
+		t.emit(Newline, "", t.line, t.column)
+	}
+}
+
+// stringStart returns the length of the prefix and opening quote when a
+// string literal starts at the current position, and 0 otherwise.
+func (t *tokenizer) stringStart() int {
+	n := 0
+	for n < 2 && strings.ContainsRune("rRbBuUfF", t.peek(n)) {
+		n++
+	}
+	if q := t.peek(n); q == '\'' || q == '"' {
+		return n + 1
+	}
+	return 0
+}
+
+func (t *tokenizer) string(start int) error {
+	line, column := t.line, t.column
+	begin := t.pos
+	prefix := strings.ToLower(string(t.src[t.pos : t.pos+start-1]))
+	quote := t.src[t.pos+start-1]
+	for range start {
+		t.advance()
+	}
+
+	triple := t.peek(0) == quote && t.peek(1) == quote
+	if triple {
+		t.advance()
+		t.advance()
+	}
+	raw := strings.Contains(prefix, "r")
+	format := strings.Contains(prefix, "f")
+
+	// The fields of an f-string are emitted after the string, which is
+	// completed once its end is known.
+	t.emit(String, "", line, column)
+	token := len(t.tokens) - 1
+
+	for t.pos < len(t.src) {
+		r := t.src[t.pos]
+		switch {
+		case format && (r == '{' && t.peek(1) == '{' || r == '}' && t.peek(1) == '}'):
+			t.advance()
+		case format && r == '{':
+			if err := t.field(triple); err != nil {
+				return err
+			}
+			continue
+		case format && r == '\\' && !raw && t.peek(1) == 'N' && t.peek(2) == '{':
+			// A named character, such as \N{BULLET}, is not a field.
+			for t.pos < len(t.src) && t.src[t.pos] != '}' && t.src[t.pos] != quote {
+				t.advance()
+			}
+			continue
+		case format && r == '\\' && (t.peek(1) == '{' || t.peek(1) == '}'):
+			// A backslash does not escape a brace.
+		case r == '\\' && !raw && t.pos+1 < len(t.src):
+			t.advance()
+		case r == '\\' && raw && t.pos+1 < len(t.src) && (t.peek(1) == quote || t.peek(1) == '\\'):
+			// Raw strings still cannot end in an escaped quote.
+			t.advance()
+		case r == '\n' && !triple:
+			return &SyntaxError{Line: line, Column: column, Message: "unterminated string literal"}
+		case r == quote && (!triple || (t.peek(1) == quote && t.peek(2) == quote)):
+			if triple {
+				t.advance()
+				t.advance()
+			}
+			t.advance()
+			t.tokens[token].Value = string(t.src[begin:t.pos])
+			return nil
+		}
+		t.advance()
+	}
+	return &SyntaxError{Line: line, Column: column, Message: "unterminated string literal"}
+}
+
+// field emits the replacement field of an f-string that starts at the
+// current "{": its expression, then the fields nested in its format spec.
+func (t *tokenizer) field(triple bool) error {
+	line, column := t.line, t.column
+	t.emit(Op, "(", t.line, t.column)
+	t.advance()
+	t.depth++
+	if err := t.scan(t.depth); err != nil {
+		return err
+	}
+	for t.pos < len(t.src) {
+		r := t.src[t.pos]
+		switch {
+		case r == '}':
+			t.emit(Op, ")", t.line, t.column)
+			t.advance()
+			t.depth--
+			return nil
+		case r == '{':
+			if err := t.field(triple); err != nil {
+				return err
+			}
+			continue
+		case r == '\n' && !triple:
+			return &SyntaxError{Line: line, Column: column, Message: "unterminated f-string replacement field"}
+		}
+		t.advance()
+	}
+	return &SyntaxError{Line: line, Column: column, Message: "unterminated f-string replacement field"}
+}
+
+func (t *tokenizer) name() {
+	line, column := t.line, t.column
+	begin := t.pos
+	for t.pos < len(t.src) && (t.src[t.pos] == '_' || unicode.IsLetter(t.src[t.pos]) || unicode.IsDigit(t.src[t.pos])) {
+		t.advance()
+	}
+	t.emit(Name, string(t.src[begin:t.pos]), line, column)
+}
+
+func (t *tokenizer) number() {
+	line, column := t.line, t.column
+	begin := t.pos
+	for t.pos < len(t.src) {
+		r := t.src[t.pos]
+		if (r == '+' || r == '-') && t.pos > begin && strings.ContainsRune("eE", t.src[t.pos-1]) && !strings.HasPrefix(strings.ToLower(string(t.src[begin:t.pos])), "0x") {
+			t.advance()
+			continue
+		}
+		if r != '.' && r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		t.advance()
+	}
+	t.emit(Number, string(t.src[begin:t.pos]), line, column)
+}
@@ -3,9 +3,11 @@ package modules
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"evolve/db/connection"
 	"evolve/util"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -18,6 +20,10 @@ type (
 	RunDataReq struct {
 		RunID string `json:"runID"`
 	}
+
+	ResumeRunReq struct {
+		RunID string `json:"runID"` // Run whose checkpoint is resumed.
+	}
 )
 
 func UserRuns(ctx context.Context, userID string, logger *util.LoggerService) ([]map[string]string, error) {
@@ -50,7 +56,7 @@ func UserRuns(ctx context.Context, userID string, logger *util.LoggerService) ([
 
 	// logger.Info(fmt.Sprintf("RunIDs: %s", runIDs))
 
-	rows, err = db.Query(ctx, "SELECT * FROM run WHERE id = ANY($1)", runIDs)
+	rows, err = db.Query(ctx, "SELECT id, name, description, status, type, command, createdBy, createdAt, updatedAt, seed, templateName, templateVersion FROM run WHERE id = ANY($1)", runIDs)
 	if err != nil {
 		logger.Error(fmt.Sprintf("UserRuns.db.Query: %s", err.Error()), err)
 		return nil, fmt.Errorf("something went wrong")
@@ -67,8 +73,11 @@ func UserRuns(ctx context.Context, userID string, logger *util.LoggerService) ([
 		var createdBy string
 		var createdAt time.Time
 		var updatedAt time.Time
+		var seed *int64
+		var templateName *string
+		var templateVersion *int
 
-		err := rows.Scan(&id, &name, &description, &status, &runType, &command, &createdBy, &createdAt, &updatedAt)
+		err := rows.Scan(&id, &name, &description, &status, &runType, &command, &createdBy, &createdAt, &updatedAt, &seed, &templateName, &templateVersion)
 		if err != nil {
 			logger.Error(fmt.Sprintf("UserRuns.rows.Scan: %s", err.Error()), err)
 			return nil, fmt.Errorf("something went wrong")
@@ -84,6 +93,13 @@ func UserRuns(ctx context.Context, userID string, logger *util.LoggerService) ([
 			"createdAt":   createdAt.Local().String(),
 			"updatedAt":   updatedAt.Local().String(),
 		}
+		if seed != nil {
+			run["seed"] = strconv.FormatInt(*seed, 10)
+		}
+		if templateName != nil {
+			run["templateName"] = *templateName
+			run["templateVersion"] = strconv.Itoa(*templateVersion)
+		}
 
 		if createdBy != userID {
 			run["isShared"] = "true"
@@ -191,14 +207,17 @@ func (r *RunDataReq) UserRun(ctx context.Context, userID string, logger *util.Lo
 
 	var id, name, description, status, runType, command, createdBy string
 	var createdAt, updatedAt time.Time
-	// Get the run details like name, description, status, type, command, createdBy, createdAt, updatedAt.
-	err = db.QueryRow(ctx, "SELECT id, name, description, status, type, command, createdBy, createdAt, updatedAt FROM run WHERE id = $1", r.RunID).Scan(&id, &name, &description, &status, &runType, &command, &createdBy, &createdAt, &updatedAt)
+	var seed *int64
+	var templateName *string
+	var templateVersion *int
+	// Get the run details like name, description, status, type, command, createdBy, createdAt, updatedAt, seed, template.
+	err = db.QueryRow(ctx, "SELECT id, name, description, status, type, command, createdBy, createdAt, updatedAt, seed, templateName, templateVersion FROM run WHERE id = $1", r.RunID).Scan(&id, &name, &description, &status, &runType, &command, &createdBy, &createdAt, &updatedAt, &seed, &templateName, &templateVersion)
 	if err != nil {
 		logger.Error(fmt.Sprintf("RunData.db.QueryRow: %s", err.Error()), err)
 		return nil, fmt.Errorf("something went wrong")
 	}
 
-	return map[string]string{
+	run := map[string]string{
 		"id":          id,
 		"name":        name,
 		"description": description,
@@ -208,5 +227,119 @@ func (r *RunDataReq) UserRun(ctx context.Context, userID string, logger *util.Lo
 		"createdBy":   createdBy,
 		"createdAt":   createdAt.Local().String(),
 		"updatedAt":   updatedAt.Local().String(),
-	}, nil
+	}
+	// Runs created before seeds were recorded have none.
+	if seed != nil {
+		run["seed"] = strconv.FormatInt(*seed, 10)
+	}
+	// Runs generated without a template have none.
+	if templateName != nil {
+		run["templateName"] = *templateName
+		run["templateVersion"] = strconv.Itoa(*templateVersion)
+	}
+	return run, nil
+}
+
+func ResumeRunReqFromJSON(jsonData map[string]any) (*ResumeRunReq, error) {
+	r := &ResumeRunReq{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Errors of Resume that the caller can act on.
+var (
+	ErrRunNotFound  = errors.New("run does not exist")
+	ErrRunReadOnly  = errors.New("run is shared read-only, only its owner can resume it")
+	ErrNoCheckpoint = errors.New("run has no checkpoint, set checkpointEvery to save one")
+)
+
+// Resume creates a follow-up run with the code, input and last checkpoint of
+// the given run, and queues it. The generated code continues from the
+// checkpoint. It returns the ID of the new run. The new run is only recorded
+// once its files are copied.
+func (r *ResumeRunReq) Resume(ctx context.Context, userID string, logger *util.LoggerService) (string, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	// Check if user has write access to the run.
+	var mode string
+	if err := db.QueryRow(ctx, "SELECT mode FROM access WHERE userID = $1 AND runID = $2", userID, r.RunID).Scan(&mode); err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun.db.QueryRow: %s", err.Error()), err)
+		return "", ErrRunNotFound
+	}
+	if mode != "write" {
+		return "", ErrRunReadOnly
+	}
+
+	var name, description, runType, command string
+	var seed *int64
+	var templateName *string
+	var templateVersion *int
+	err = db.QueryRow(ctx, "SELECT name, description, type, command, seed, templateName, templateVersion FROM run WHERE id = $1", r.RunID).Scan(&name, &description, &runType, &command, &seed, &templateName, &templateVersion)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun.db.QueryRow: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	// The run and access rows are rolled back unless every file is copied.
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun.db.Begin: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+	defer tx.Rollback(ctx)
+
+	var newRunID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO run (name, description, type, command, createdBy, seed, templateName, templateVersion)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, name, fmt.Sprintf("%s, resumed from %s", description, r.RunID), runType, command, userID, seed, templateName, templateVersion).Scan(&newRunID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun.row.Scan: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO access (runID, userID, mode) VALUES ($1, $2, $3)", newRunID, userID, "write")
+	if err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun.tx.Exec: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	// The checkpoint is copied first, so a run without one copies nothing.
+	// instance.json only exists for EA runs with a problem instance, and
+	// dataset.csv for GP runs with a dataset.
+	for _, file := range []string{CheckpointFile, "code.py", "input.json", "instance.json", DatasetFile} {
+		found, err := util.CopyFile(ctx, r.RunID, newRunID, file)
+		if err != nil {
+			return "", fmt.Errorf("something went wrong")
+		}
+		if !found && file == CheckpointFile {
+			return "", ErrNoCheckpoint
+		}
+		if !found && file != "instance.json" && file != DatasetFile {
+			return "", fmt.Errorf("run has no %s", file)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Error(fmt.Sprintf("ResumeRun.tx.Commit: %s", err.Error()), err)
+		return "", fmt.Errorf("something went wrong")
+	}
+
+	if err := util.EnqueueRunRequest(ctx, newRunID, "code", "py"); err != nil {
+		return "", err
+	}
+
+	return newRunID, nil
 }
@@ -0,0 +1,444 @@
+package modules
+
+import (
+	"encoding/json"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SchemaDialect is the JSON Schema version of every config schema.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema (draft 2020-12) used to describe the
+// algorithm configs. The properties and types are derived from the config
+// structs; each algorithm type adds its enums, ranges and conditions from
+// the same catalogs and limits its Validate uses.
+type Schema struct {
+	Dialect     string      `json:"$schema,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Type        schemaTypes `json:"type,omitempty"`
+	Default     any         `json:"default,omitempty"`
+
+	Enum      []string `json:"enum,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	PropertyNames        *Schema            `json:"propertyNames,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	If    *Schema   `json:"if,omitempty"`
+	Then  *Schema   `json:"then,omitempty"`
+}
+
+// schemaTypes is the "type" keyword, a single name or a list of names.
+type schemaTypes []string
+
+func (t schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// schemaer is implemented by config types whose JSON form is not derived
+// from their Go type, such as Centroid.
+type schemaer interface {
+	jsonSchema() *Schema
+}
+
+var schemaerType = reflect.TypeFor[schemaer]()
+
+// schemaOf derives the schema of a config struct from its json tags.
+// Pointers may also be null, as they are optional.
+func schemaOf(t reflect.Type) *Schema {
+	if t.Implements(schemaerType) {
+		return reflect.Zero(t).Interface().(schemaer).jsonSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaOf(t.Elem())
+		s.Type = append(s.Type, "null")
+		return s
+	case reflect.Bool:
+		return &Schema{Type: schemaTypes{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: schemaTypes{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: schemaTypes{"number"}}
+	case reflect.String:
+		return &Schema{Type: schemaTypes{"string"}}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: schemaTypes{"array"}, Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: schemaTypes{"object"}, AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: schemaTypes{"object"}, Properties: map[string]*Schema{}}
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			s.Properties[name] = schemaOf(field.Type)
+		}
+		return s
+	}
+	panic(fmt.Sprintf("no schema for %s", t))
+}
+
+// configSchema returns the schema of the config struct T.
+func configSchema[T any](title string, description string) *Schema {
+	s := schemaOf(reflect.TypeFor[T]())
+	s.Dialect = SchemaDialect
+	s.Title = title
+	s.Description = description
+	return s
+}
+
+// at returns the schema of the property at path, such as "cma.sigma". It
+// panics if there is none, so a misspelt path fails at start-up.
+func (s *Schema) at(path string) *Schema {
+	for name := range strings.SplitSeq(path, ".") {
+		property, ok := s.Properties[name]
+		if !ok {
+			panic(fmt.Sprintf("schema %q has no property %q", s.Title, path))
+		}
+		s = property
+	}
+	return s
+}
+
+func (s *Schema) describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+func (s *Schema) enum(values []string) *Schema {
+	s.Enum = slices.Clone(values)
+	return s
+}
+
+func (s *Schema) between(min float64, max float64) *Schema {
+	s.Minimum, s.Maximum = &min, &max
+	return s
+}
+
+func (s *Schema) atLeast(min float64) *Schema {
+	s.Minimum = &min
+	return s
+}
+
+// length bounds the characters of a string.
+func (s *Schema) length(min int, max int) *Schema {
+	s.MinLength, s.MaxLength = &min, &max
+	return s
+}
+
+// nonEmpty requires a string of at least one character.
+func (s *Schema) nonEmpty() *Schema {
+	one := 1
+	s.MinLength = &one
+	return s
+}
+
+// count bounds the items of an array.
+func (s *Schema) count(min int, max int) *Schema {
+	s.MinItems, s.MaxItems = &min, &max
+	return s
+}
+
+// pattern restricts strings to the regular expression p, which must also
+// be valid in ECMA-262.
+func (s *Schema) pattern(p string) *Schema {
+	regexp.MustCompile(p)
+	s.Pattern = p
+	return s
+}
+
+func (s *Schema) withDefault(value any) *Schema {
+	s.Default = value
+	return s
+}
+
+func (s *Schema) require(names ...string) *Schema {
+	for _, name := range names {
+		s.at(name)
+	}
+	s.Required = append(s.Required, names...)
+	return s
+}
+
+// when applies then to configs that match cond.
+func (s *Schema) when(cond *Schema, then *Schema) *Schema {
+	s.AllOf = append(s.AllOf, &Schema{If: cond, Then: then})
+	return s
+}
+
+// Conditions and consequences for Schema.when.
+
+// object returns a schema for the given properties, requiring required.
+func object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Properties: properties, Required: required}
+}
+
+// all matches when every schema matches.
+func all(schemas ...*Schema) *Schema {
+	return &Schema{AllOf: schemas}
+}
+
+// propertyIn matches configs whose property name is one of values.
+func propertyIn(name string, values ...string) *Schema {
+	return object(map[string]*Schema{name: {Enum: values}}, name)
+}
+
+// unset matches configs where the string property name is missing or
+// empty, which the generators treat the same.
+func unset(name string) *Schema {
+	none := 0
+	return object(map[string]*Schema{name: {MaxLength: &none}})
+}
+
+// given matches configs where the property name is set: an object that is
+// not null, or a string that is not empty.
+func given(name string) *Schema {
+	one := 1
+	return object(map[string]*Schema{name: {Type: schemaTypes{"object", "string"}, MinLength: &one}}, name)
+}
+
+// null matches configs where the optional object name is missing or null.
+func null(name string) *Schema {
+	return object(map[string]*Schema{name: {Type: schemaTypes{"null"}}})
+}
+
+// Validate checks a config against the schema and reports every failure
+// as a field error. Property names are joined with dots and list indexes
+// in brackets, like the errors of Validate. Null members are treated as
+// missing, as they are when the config is decoded.
+func (s *Schema) Validate(data any) error {
+	// Normalise Go values, such as the ints of sweep points, to JSON.
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var value any
+	if err := json.Unmarshal(dataBytes, &value); err != nil {
+		return err
+	}
+
+	v := &util.ValidationError{}
+	s.validate(v, "", dropNulls(value))
+	return v.Err()
+}
+
+// dropNulls removes the null members of every object in value.
+func dropNulls(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for name, member := range value {
+			if member == nil {
+				delete(value, name)
+			} else {
+				value[name] = dropNulls(member)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = dropNulls(item)
+		}
+	}
+	return value
+}
+
+// matches reports whether value is valid, without recording errors.
+func (s *Schema) matches(path string, value any) bool {
+	v := &util.ValidationError{}
+	s.validate(v, path, value)
+	return v.Err() == nil
+}
+
+func (s *Schema) validate(v *util.ValidationError, path string, value any) {
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return isType(value, t) }) {
+		v.Add(util.FieldError{Field: path, Rule: util.RuleType, Message: "must be " + typeNames(s.Type)})
+		return
+	}
+
+	if s.Enum != nil {
+		if str, ok := value.(string); ok {
+			v.OneOf(path, str, s.Enum)
+		} else {
+			v.Add(util.FieldError{Field: path, Rule: util.RuleOneOf, Message: fmt.Sprintf("must be one of %s, got %v", strings.Join(s.Enum, ", "), value), Options: s.Enum})
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		s.validateString(v, path, value)
+	case float64:
+		s.validateNumber(v, path, value)
+	case []any:
+		s.validateArray(v, path, value)
+	case map[string]any:
+		s.validateObject(v, path, value)
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(v, path, value)
+	}
+	if s.If != nil && s.Then != nil && s.If.matches(path, value) {
+		s.Then.validate(v, path, value)
+	}
+}
+
+func (s *Schema) validateString(v *util.ValidationError, path string, value string) {
+	n := len([]rune(value))
+	if s.MinLength != nil && *s.MinLength > 0 && n == 0 {
+		v.Add(util.FieldError{Field: path, Rule: util.RuleRequired, Message: "is required"})
+	} else if !inBounds(float64(n), s.MinLength, s.MaxLength) {
+		v.Add(boundsError(path, util.RuleLength, float64(n), s.MinLength, s.MaxLength, "characters"))
+	}
+	if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(value) {
+		v.Add(util.FieldError{Field: path, Rule: util.RuleRelation, Message: fmt.Sprintf("must match %s", s.Pattern)})
+	}
+}
+
+func (s *Schema) validateNumber(v *util.ValidationError, path string, value float64) {
+	if (s.Minimum != nil && value < *s.Minimum) || (s.Maximum != nil && value > *s.Maximum) {
+		fe := util.FieldError{Field: path, Rule: util.RuleRange, Min: s.Minimum, Max: s.Maximum}
+		switch {
+		case s.Minimum != nil && s.Maximum != nil:
+			fe.Message = fmt.Sprintf("must be between %v and %v, got %v", *s.Minimum, *s.Maximum, value)
+		case s.Minimum != nil:
+			fe.Message = fmt.Sprintf("must be at least %v, got %v", *s.Minimum, value)
+		default:
+			fe.Message = fmt.Sprintf("must be at most %v, got %v", *s.Maximum, value)
+		}
+		v.Add(fe)
+	}
+}
+
+func (s *Schema) validateArray(v *util.ValidationError, path string, value []any) {
+	if !inBounds(float64(len(value)), s.MinItems, s.MaxItems) {
+		v.Add(boundsError(path, util.RuleLength, float64(len(value)), s.MinItems, s.MaxItems, "entries"))
+	}
+	if s.Items == nil {
+		return
+	}
+	for i, item := range value {
+		s.Items.validate(v, fmt.Sprintf("%s[%d]", path, i), item)
+	}
+}
+
+func (s *Schema) validateObject(v *util.ValidationError, path string, value map[string]any) {
+	for _, name := range s.Required {
+		if _, ok := value[name]; !ok {
+			v.Add(util.FieldError{Field: join(path, name), Rule: util.RuleRequired, Message: "is required"})
+		}
+	}
+	if s.MaxProperties != nil && len(value) > *s.MaxProperties {
+		v.Add(util.FieldError{Field: path, Rule: util.RuleLength, Message: fmt.Sprintf("must have at most %d entries, got %d", *s.MaxProperties, len(value))})
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(value)) {
+		if s.PropertyNames != nil && s.PropertyNames.Enum != nil && !slices.Contains(s.PropertyNames.Enum, name) {
+			v.Add(util.FieldError{Field: join(path, name), Rule: util.RuleOneOf, Message: fmt.Sprintf("is not one of %s", strings.Join(s.PropertyNames.Enum, ", ")), Options: s.PropertyNames.Enum})
+			continue
+		}
+		if property, ok := s.Properties[name]; ok {
+			property.validate(v, join(path, name), value[name])
+		} else if s.AdditionalProperties != nil {
+			s.AdditionalProperties.validate(v, join(path, name), value[name])
+		}
+	}
+}
+
+// isType reports whether a decoded JSON value has the JSON Schema type t.
+func isType(value any, t string) bool {
+	switch value := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case float64:
+		return t == "number" || (t == "integer" && value == math.Trunc(value) && !math.IsInf(value, 0))
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
+
+// typeNames describes a type keyword, e.g. "an integer or null".
+func typeNames(types []string) string {
+	names := map[string]string{
+		"null":    "null",
+		"boolean": "true or false",
+		"integer": "an integer",
+		"number":  "a number",
+		"string":  "a string",
+		"array":   "a list",
+		"object":  "an object",
+	}
+	described := make([]string, len(types))
+	for i, t := range types {
+		described[i] = names[t]
+	}
+	return strings.Join(described, " or ")
+}
+
+func inBounds(n float64, min *int, max *int) bool {
+	return (min == nil || n >= float64(*min)) && (max == nil || n <= float64(*max))
+}
+
+func boundsError(path string, rule string, n float64, min *int, max *int, unit string) util.FieldError {
+	fe := util.FieldError{Field: path, Rule: rule}
+	switch {
+	case min != nil && max != nil:
+		fe.Message = fmt.Sprintf("must have between %d and %d %s, got %v", *min, *max, unit, n)
+	case min != nil:
+		fe.Message = fmt.Sprintf("must have at least %d %s, got %v", *min, unit, n)
+	default:
+		fe.Message = fmt.Sprintf("must have at most %d %s, got %v", *max, unit, n)
+	}
+	if min != nil {
+		fmin := float64(*min)
+		fe.Min = &fmin
+	}
+	if max != nil {
+		fmax := float64(*max)
+		fe.Max = &fmax
+	}
+	return fe
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
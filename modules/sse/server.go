@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"evolve/modules"
 	"evolve/util"
 	"fmt"
 	"net/http"
@@ -17,6 +18,7 @@ const (
 	runIdHeader     = "X-RUN-ID"      // Header key for the run ID.
 	retrySeconds    = 3               // SSE retry interval suggestion for clients.
 	sseDoneEvent    = "done"          // Event name for the end of the stream.
+	sseMetricEvent  = "metric"        // Event name for the metrics of a generation.
 	eofStatus       = "EOF"           // Expected status value for the end message.
 	logDataField    = "log_data"      // Field name in Redis Stream (must match 'runner').
 	streamReadCount = 100             // How many messages to read per XREAD call.
@@ -72,8 +74,51 @@ func GetSSEHandler(logger util.LoggerService, redisClient *redis.Client) http.Ha
 	}
 }
 
+// metricPayload returns the metrics of a log line printed with
+// modules.MetricPrefix by the generated code.
+func metricPayload(logPayloadStr string) (string, bool) {
+	var logData redisLogPayload
+	if json.Unmarshal([]byte(logPayloadStr), &logData) != nil || logData.Stream != "stdout" {
+		return "", false
+	}
+	line, found := strings.CutPrefix(strings.TrimSpace(logData.Line), modules.MetricPrefix)
+	if !found {
+		return "", false
+	}
+
+	// Only JSON objects are metrics; anything else stays a log line.
+	var metric map[string]any
+	if err := json.Unmarshal([]byte(line), &metric); err != nil {
+		return "", false
+	}
+	payload, err := json.Marshal(metric)
+	if err != nil {
+		return "", false
+	}
+	return string(payload), true
+}
+
+// sendSSEPayload sends a metrics line as a metric event and any other line as data.
+func sendSSEPayload(w http.ResponseWriter, rc *http.ResponseController, payload string, runId string, logger *util.LoggerService) bool {
+	if metric, ok := metricPayload(payload); ok {
+		return sendSSEEvent(w, rc, sseMetricEvent, metric, runId, logger)
+	}
+	return sendSSEData(w, rc, payload, runId, logger)
+}
+
 func sendSSEData(w http.ResponseWriter, rc *http.ResponseController, payload string, runId string, logger *util.LoggerService) bool {
+	return sendSSEEvent(w, rc, "", payload, runId, logger)
+}
+
+// sendSSEEvent sends payload as an event of the given type, or as an
+// unnamed event when event is empty.
+func sendSSEEvent(w http.ResponseWriter, rc *http.ResponseController, event string, payload string, runId string, logger *util.LoggerService) bool {
 	// logger.Info(fmt.Sprintf("[SSE SENDING DATA] runId=%s | data=%s", runId, payload)) // Debug log
+	if event != "" {
+		if _, writeErr := fmt.Fprintf(w, "event: %s\n", event); writeErr != nil {
+			return false
+		}
+	}
 	_, writeErr := fmt.Fprintf(w, "data: %s\n\n", payload) // Payload should already be JSON string
 	if writeErr != nil {
 		// Don't log excessive errors if client simply disconnected
@@ -213,7 +258,7 @@ func serveSSEWithStream(logger util.LoggerService, redisClient *redis.Client, w
 			}
 
 			// Send the payload.
-			if !sendSSEData(w, rc, logPayloadStr, runId, &logger) {
+			if !sendSSEPayload(w, rc, logPayloadStr, runId, &logger) {
 				return
 			}
 			historyProcessed++
@@ -288,7 +333,7 @@ func serveSSEWithStream(logger util.LoggerService, redisClient *redis.Client, w
 				}
 
 				// Send the payload.
-				if !sendSSEData(w, rc, logPayloadStr, runId, &logger) {
+				if !sendSSEPayload(w, rc, logPayloadStr, runId, &logger) {
 					return
 				}
 
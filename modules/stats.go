@@ -0,0 +1,222 @@
+package modules
+
+import (
+	"math"
+	"slices"
+)
+
+// Summary statistics and the Wilcoxon rank-sum test, for comparing the
+// results of repeated runs.
+
+// Statistics summarises a sample. Quantiles are linearly interpolated.
+type Statistics struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Std    float64 `json:"std"` // Sample standard deviation.
+	Min    float64 `json:"min"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+	Max    float64 `json:"max"`
+	IQR    float64 `json:"iqr"`
+}
+
+func describe(values []float64) Statistics {
+	if len(values) == 0 {
+		return Statistics{}
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	s := Statistics{
+		N:      len(sorted),
+		Mean:   mean(sorted),
+		Std:    std(sorted),
+		Min:    sorted[0],
+		Q1:     quantile(sorted, 0.25),
+		Median: quantile(sorted, 0.5),
+		Q3:     quantile(sorted, 0.75),
+		Max:    sorted[len(sorted)-1],
+	}
+	s.IQR = s.Q3 - s.Q1
+	return s
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+func std(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	var sum float64
+	for _, value := range values {
+		sum += (value - m) * (value - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// quantile returns the q-quantile of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (pos-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// Two-sided 95% critical values of Student's t distribution by degrees of
+// freedom; the normal value is used beyond the table.
+var tCritical95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// confidenceInterval95 returns the 95% confidence interval of the mean.
+func confidenceInterval95(values []float64) (float64, float64) {
+	m := mean(values)
+	if len(values) < 2 {
+		return m, m
+	}
+	t := 1.96
+	if df := len(values) - 1; df <= len(tCritical95) {
+		t = tCritical95[df-1]
+	}
+	half := t * std(values) / math.Sqrt(float64(len(values)))
+	return m - half, m + half
+}
+
+// RankSumTest is the two-sided Wilcoxon rank-sum (Mann-Whitney U) test of
+// two samples. A12 is the Vargha-Delaney effect size, the probability that
+// a value of A is larger than one of B, counting ties as half.
+type RankSumTest struct {
+	NA     int     `json:"nA"`
+	NB     int     `json:"nB"`
+	W      float64 `json:"w"` // Rank sum of A.
+	U      float64 `json:"u"` // U statistic of A.
+	Z      float64 `json:"z,omitempty"`
+	PValue float64 `json:"pValue"`
+	Method string  `json:"method"` // "exact" or "normal".
+	A12    float64 `json:"a12"`
+}
+
+// Largest combined sample the exact distribution of U is computed for.
+const maxExactRankSum = 50
+
+func rankSum(a []float64, b []float64) RankSumTest {
+	na, nb := len(a), len(b)
+	n := na + nb
+	t := RankSumTest{NA: na, NB: nb}
+
+	// Rank the pooled sample, giving ties their mean rank.
+	type sample struct {
+		value float64
+		inA   bool
+	}
+	pooled := make([]sample, 0, n)
+	for _, value := range a {
+		pooled = append(pooled, sample{value, true})
+	}
+	for _, value := range b {
+		pooled = append(pooled, sample{value, false})
+	}
+	slices.SortFunc(pooled, func(x, y sample) int {
+		switch {
+		case x.value < y.value:
+			return -1
+		case x.value > y.value:
+			return 1
+		}
+		return 0
+	})
+
+	var tieCorrection float64
+	for i := 0; i < n; {
+		j := i
+		for j < n && pooled[j].value == pooled[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if pooled[k].inA {
+				t.W += rank
+			}
+		}
+		ties := float64(j - i)
+		tieCorrection += ties*ties*ties - ties
+		i = j
+	}
+
+	t.U = t.W - float64(na*(na+1))/2
+	t.A12 = t.U / float64(na*nb)
+
+	if tieCorrection == 0 && n <= maxExactRankSum {
+		t.Method = "exact"
+		t.PValue = exactRankSumP(na, nb, t.U)
+		return t
+	}
+
+	// Normal approximation with tie and continuity corrections.
+	t.Method = "normal"
+	mu := float64(na*nb) / 2
+	variance := float64(na*nb) / 12 * (float64(n+1) - tieCorrection/float64(n*(n-1)))
+	if variance <= 0 {
+		// Every value is the same.
+		t.PValue = 1
+		return t
+	}
+	diff := math.Max(math.Abs(t.U-mu)-0.5, 0)
+	t.Z = math.Copysign(diff/math.Sqrt(variance), t.U-mu)
+	t.PValue = math.Min(1, math.Erfc(diff/math.Sqrt(variance)/math.Sqrt2))
+	return t
+}
+
+// exactRankSumP returns the two-sided p-value of U for samples of na and nb
+// values without ties.
+func exactRankSumP(na int, nb int, u float64) float64 {
+	// counts[i][j][k] is the number of orderings of i values of A and j of
+	// B with U = k; only the current i is kept.
+	maxU := na * nb
+	prev := make([][]float64, nb+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1
+	}
+	for i := 1; i <= na; i++ {
+		cur := make([][]float64, nb+1)
+		cur[0] = make([]float64, maxU+1)
+		cur[0][0] = 1
+		for j := 1; j <= nb; j++ {
+			cur[j] = make([]float64, maxU+1)
+			for k := 0; k <= i*j; k++ {
+				// The largest value is from A, above all j values of B,
+				// or from B.
+				if k >= j {
+					cur[j][k] += prev[j][k-j]
+				}
+				cur[j][k] += cur[j-1][k]
+			}
+		}
+		prev = cur
+	}
+
+	counts := prev[nb]
+	var total, lower, upper float64
+	k := int(math.Round(u))
+	for i, count := range counts {
+		total += count
+		if i <= k {
+			lower += count
+		}
+		if i >= k {
+			upper += count
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/total)
+}
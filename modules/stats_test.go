@@ -0,0 +1,104 @@
+package modules
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got float64, want float64) bool {
+	return math.Abs(got-want) < 1e-4
+}
+
+func TestRankSum(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   []float64
+		w, u   float64
+		z      float64
+		p      float64
+		method string
+		a12    float64
+	}{
+		{"separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 6, 0, 0, 0.1, "exact", 0},
+		{"separated reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 15, 9, 0, 0.1, "exact", 1},
+		{"interleaved", []float64{1, 3, 5, 7}, []float64{2, 4, 6, 8}, 16, 6, 0, 0.6857, "exact", 0.375},
+		// Ranks 1, 3, 3, 5.5 for A; variance 16/12 * (9 - 30/56).
+		{"ties", []float64{1, 2, 2, 3}, []float64{2, 3, 4, 5}, 12.5, 2.5, -1.48835, 0.13666, "normal", 2.5 / 16},
+		{"all equal", []float64{1, 1}, []float64{1, 1}, 5, 2, 0, 1, "normal", 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankSum(tt.a, tt.b)
+			if got.NA != len(tt.a) || got.NB != len(tt.b) || got.Method != tt.method {
+				t.Errorf("rankSum = %d, %d values by %s, want %d, %d by %s", got.NA, got.NB, got.Method, len(tt.a), len(tt.b), tt.method)
+			}
+			if !near(got.W, tt.w) || !near(got.U, tt.u) || !near(got.Z, tt.z) || !near(got.PValue, tt.p) || !near(got.A12, tt.a12) {
+				t.Errorf("rankSum = W %g, U %g, z %g, p %g, A12 %g, want W %g, U %g, z %g, p %g, A12 %g",
+					got.W, got.U, got.Z, got.PValue, got.A12, tt.w, tt.u, tt.z, tt.p, tt.a12)
+			}
+		})
+	}
+}
+
+func TestExactRankSumP(t *testing.T) {
+	// Two-sided p-values from the exact null distribution of U.
+	tests := []struct {
+		na, nb int
+		u      float64
+		want   float64
+	}{
+		{3, 3, 0, 0.1},
+		{3, 3, 9, 0.1},
+		{3, 3, 4.5, 1},
+		{4, 4, 0, 2.0 / 70},
+		{4, 4, 3, 14.0 / 70},
+		{5, 5, 2, 8.0 / 252},
+		{1, 1, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := exactRankSumP(tt.na, tt.nb, tt.u); !near(got, tt.want) {
+			t.Errorf("exactRankSumP(%d, %d, %g) = %g, want %g", tt.na, tt.nb, tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	// Expected values are numpy.quantile's default, linear interpolation.
+	tests := []struct {
+		sorted []float64
+		q      float64
+		want   float64
+	}{
+		{[]float64{1, 2, 3, 4}, 0.25, 1.75},
+		{[]float64{1, 2, 3, 4}, 0.5, 2.5},
+		{[]float64{1, 2, 3, 4}, 0.75, 3.25},
+		{[]float64{1, 3, 7, 15, 31}, 0.25, 3},
+		{[]float64{1, 3, 7, 15, 31}, 0.75, 15},
+		{[]float64{0, 10}, 0.3, 3},
+		{[]float64{5}, 0.75, 5},
+		{[]float64{1, 2, 3}, 1, 3},
+	}
+	for _, tt := range tests {
+		if got := quantile(tt.sorted, tt.q); !near(got, tt.want) {
+			t.Errorf("quantile(%v, %g) = %g, want %g", tt.sorted, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestConfidenceInterval95(t *testing.T) {
+	tests := []struct {
+		values    []float64
+		low, high float64
+	}{
+		// Mean 2, standard deviation 1 and t = 4.303 for 2 degrees of freedom.
+		{[]float64{1, 2, 3}, 2 - 4.303/math.Sqrt(3), 2 + 4.303/math.Sqrt(3)},
+		{[]float64{4}, 4, 4},
+		{[]float64{7, 7, 7, 7}, 7, 7},
+	}
+	for _, tt := range tests {
+		if low, high := confidenceInterval95(tt.values); !near(low, tt.low) || !near(high, tt.high) {
+			t.Errorf("confidenceInterval95(%v) = %g, %g, want %g, %g", tt.values, low, high, tt.low, tt.high)
+		}
+	}
+}
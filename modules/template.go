@@ -0,0 +1,287 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evolve/db/connection"
+	"evolve/modules/py"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Sections of the generated code a CodeTemplate can replace.
+const (
+	SectionImports = "imports" // The libraries the generated code imports.
+	SectionPlots   = "plots"   // The plots written after the run. PSO has none: its animation is the run.
+)
+
+// TemplateSections lists the sections a CodeTemplate can replace.
+var TemplateSections = []string{SectionImports, SectionPlots}
+
+// CodeTemplate is a version of the Python an organization wraps every
+// generated script in: a prologue before the code, an epilogue after it,
+// and replacements of its sections. Saving a template adds its next
+// version; versions are never changed, so a run can name the exact code it
+// was generated with. Templates are written by admins and are not checked
+// against the code policy.
+type CodeTemplate struct {
+	Name      string            `json:"name"`
+	Version   int               `json:"version"`
+	Prologue  string            `json:"prologue"`
+	Epilogue  string            `json:"epilogue"`
+	Sections  map[string]string `json:"sections"` // Replacements by section name; an empty one removes the section.
+	CreatedBy string            `json:"createdBy"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// TemplateRef names a version of a template.
+type TemplateRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+// CodeTemplateFromJSON reads a template sent by an admin. Its version is
+// assigned when it is saved.
+func CodeTemplateFromJSON(jsonData map[string]any) (*CodeTemplate, error) {
+	t := &CodeTemplate{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, t); err != nil {
+		return nil, err
+	}
+	if t.Sections == nil {
+		t.Sections = map[string]string{}
+	}
+
+	v := &util.ValidationError{}
+	validateIdentifier(v, "name", t.Name)
+	validateTemplateSource(v, "prologue", t.Prologue)
+	validateTemplateSource(v, "epilogue", t.Epilogue)
+	for _, name := range slices.Sorted(maps.Keys(t.Sections)) {
+		if v.OneOf("sections", name, TemplateSections) {
+			validateTemplateSource(v, "sections."+name, t.Sections[name])
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// validateTemplateSource records an error if src does not tokenize as
+// Python.
+func validateTemplateSource(v *util.ValidationError, field string, src string) {
+	_, err := py.Tokenize(src)
+	var serr *py.SyntaxError
+	if errors.As(err, &serr) {
+		v.Add(util.FieldError{
+			Field:   field,
+			Rule:    py.RuleSyntax,
+			Message: fmt.Sprintf("line %d, column %d: %s", serr.Line, serr.Column, serr.Message),
+			Line:    serr.Line,
+			Column:  serr.Column,
+		})
+	}
+}
+
+// TemplateRefFromJSON reads the template an admin activates. An empty name
+// deactivates templates, and version 0 stands for the latest version.
+func TemplateRefFromJSON(jsonData map[string]any) (*TemplateRef, error) {
+	r := &TemplateRef{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, r); err != nil {
+		return nil, err
+	}
+
+	v := &util.ValidationError{}
+	if r.Name != "" {
+		validateIdentifier(v, "name", r.Name)
+	}
+	v.Relation("version", r.Version >= 0, "must be 0, for the latest version, or a version number")
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Render renders code inside t. A nil t renders code as is.
+func (t *CodeTemplate) Render(code py.Module) string {
+	if t == nil {
+		return code.String()
+	}
+
+	overrides := map[string]py.Stmt{}
+	for name, src := range t.Sections {
+		overrides[name] = py.Source(src)
+	}
+	m := py.Module{py.Source(t.Prologue), py.Blank}
+	m = append(m, code...)
+	m = append(m, py.Blank, py.Source(t.Epilogue))
+	return m.Render(overrides)
+}
+
+// Ref returns the name and version of t, or nil if t is nil.
+func (t *CodeTemplate) Ref() *TemplateRef {
+	if t == nil {
+		return nil
+	}
+	return &TemplateRef{Name: t.Name, Version: t.Version}
+}
+
+// Save adds t as the next version of its name, and sets its version, author
+// and creation time.
+func (t *CodeTemplate) Save(ctx context.Context, userID string, logger *util.LoggerService) error {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeTemplate.Save: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+
+	sectionsJSON, err := json.Marshal(t.Sections)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeTemplate.Save.json.Marshal: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+
+	err = db.QueryRow(ctx, `
+		INSERT INTO code_template (name, version, prologue, epilogue, sections, createdBy)
+		SELECT $1, coalesce(max(version), 0) + 1, $2, $3, $4, $5 FROM code_template WHERE name = $1
+		RETURNING version, createdAt
+	`, t.Name, t.Prologue, t.Epilogue, sectionsJSON, userID).Scan(&t.Version, &t.CreatedAt)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeTemplate.Save.row.Scan: %s", err.Error()), err)
+		return fmt.Errorf("something went wrong")
+	}
+	t.CreatedBy = userID
+	return nil
+}
+
+const templateColumns = "t.name, t.version, t.prologue, t.epilogue, t.sections, t.createdBy, t.createdAt"
+
+func scanTemplate(row pgx.Row) (*CodeTemplate, error) {
+	t := &CodeTemplate{}
+	var sectionsJSON []byte
+	if err := row.Scan(&t.Name, &t.Version, &t.Prologue, &t.Epilogue, &sectionsJSON, &t.CreatedBy, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(sectionsJSON, &t.Sections); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CodeTemplates returns every version of every template, by name and
+// version.
+func CodeTemplates(ctx context.Context, logger *util.LoggerService) ([]*CodeTemplate, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeTemplates: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	rows, err := db.Query(ctx, "SELECT "+templateColumns+" FROM code_template t ORDER BY t.name, t.version")
+	if err != nil {
+		logger.Error(fmt.Sprintf("CodeTemplates.db.Query: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+	defer rows.Close()
+
+	templates := []*CodeTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			logger.Error(fmt.Sprintf("CodeTemplates.rows.Scan: %s", err.Error()), err)
+			return nil, fmt.Errorf("something went wrong")
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(fmt.Sprintf("CodeTemplates.rows.Err: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+	return templates, nil
+}
+
+// ActiveTemplate returns the template new runs are generated with, or nil
+// if none is active.
+func ActiveTemplate(ctx context.Context, logger *util.LoggerService) (*CodeTemplate, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("ActiveTemplate: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	t, err := scanTemplate(db.QueryRow(ctx, `
+		SELECT `+templateColumns+` FROM code_template_active a
+		JOIN code_template t ON t.name = a.name AND t.version = a.version
+		WHERE a.id = 1
+	`))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("ActiveTemplate.row.Scan: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+	return t, nil
+}
+
+// SetActiveTemplate makes the template r names the one new runs are
+// generated with, or deactivates templates if r has no name. A version 0 is
+// resolved to the latest version. It returns the activated template, or nil.
+// The caller must be an admin.
+func SetActiveTemplate(ctx context.Context, r TemplateRef, userID string, logger *util.LoggerService) (*CodeTemplate, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("SetActiveTemplate: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	var t *CodeTemplate
+	var name *string
+	var version *int
+	if r.Name != "" {
+		t, err = scanTemplate(db.QueryRow(ctx, `
+			SELECT `+templateColumns+` FROM code_template t
+			WHERE t.name = $1 AND ($2 = 0 OR t.version = $2)
+			ORDER BY t.version DESC LIMIT 1
+		`, r.Name, r.Version))
+		if errors.Is(err, pgx.ErrNoRows) {
+			v := &util.ValidationError{}
+			if r.Version == 0 {
+				v.Relation("name", false, fmt.Sprintf("no template named %q", r.Name))
+			} else {
+				v.Relation("version", false, fmt.Sprintf("template %q has no version %d", r.Name, r.Version))
+			}
+			return nil, v.Err()
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("SetActiveTemplate.row.Scan: %s", err.Error()), err)
+			return nil, fmt.Errorf("something went wrong")
+		}
+		name, version = &t.Name, &t.Version
+	}
+
+	_, err = db.Exec(ctx, `
+		UPSERT INTO code_template_active (id, name, version, updatedBy, updatedAt)
+		VALUES (1, $1, $2, $3, now())
+	`, name, version, userID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("SetActiveTemplate.db.Exec: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+	return t, nil
+}
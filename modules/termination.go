@@ -0,0 +1,130 @@
+package modules
+
+import (
+	"evolve/modules/py"
+	"evolve/util"
+)
+
+// Termination stops a run before Generations when any of its rules holds.
+// Generations is always the upper bound. The reason is printed to the log
+// and written to ResultsFile with the generation and evaluation counts.
+type Termination struct {
+	TargetFitness  *float64 `json:"targetFitness,omitempty"`  // Stop once the best fitness is at least as good.
+	Stagnation     int      `json:"stagnation,omitempty"`     // Stop after N generations without improvement of the best fitness.
+	MaxEvaluations int      `json:"maxEvaluations,omitempty"` // Stop once N fitness evaluations have been made.
+	MaxTime        float64  `json:"maxTime,omitempty"`        // Stop after N seconds.
+}
+
+// Limits on the termination rules.
+const (
+	maxEvaluationCount = 1_000_000_000
+	maxRunTime         = 7 * 24 * 60 * 60 // A week, in seconds.
+)
+
+func (t *Termination) validate(v *util.ValidationError, weights []float64, generations int) {
+	if t.TargetFitness == nil && t.Stagnation == 0 && t.MaxEvaluations == 0 && t.MaxTime == 0 {
+		v.Relation("termination", false, "must set targetFitness, stagnation, maxEvaluations or maxTime")
+		return
+	}
+
+	// The best fitness is only defined for a single objective.
+	if t.TargetFitness != nil {
+		v.FloatRange("termination.targetFitness", *t.TargetFitness, -1e12, 1e12)
+		v.Relation("termination.targetFitness", len(weights) == 1, "requires a single objective")
+	}
+	if t.Stagnation != 0 {
+		v.IntRange("termination.stagnation", t.Stagnation, 1, max(generations, 1))
+		v.Relation("termination.stagnation", len(weights) == 1, "requires a single objective")
+	}
+	if t.MaxEvaluations != 0 {
+		v.IntRange("termination.maxEvaluations", t.MaxEvaluations, 1, maxEvaluationCount)
+	}
+	if t.MaxTime != 0 {
+		v.FloatRange("termination.maxTime", t.MaxTime, 1, maxRunTime)
+	}
+}
+
+// terminationSchema describes the rules validate checks.
+func terminationSchema(s *Schema) {
+	t := s.at("termination").describe("Rules that end the run before generations; it stops when any holds. Set at least one.")
+	t.at("targetFitness").between(-1e12, 1e12).describe("Stop once the best fitness is at least as good. Single objective only.")
+	t.at("stagnation").atLeast(0).describe("Stop after N generations without improvement of the best fitness, at most generations. Single objective only.")
+	t.at("maxEvaluations").between(0, maxEvaluationCount).describe("Stop once N fitness evaluations have been made.")
+	t.at("maxTime").between(0, maxRunTime).describe("Stop after N seconds, at least 1.")
+}
+
+// instance renders the construction of the Termination object. ngen is a
+// Python expression and weights the fitness weights.
+func (t *Termination) instance(ngen py.Expr, weights []float64) py.Stmt {
+	target := py.None
+	if t.TargetFitness != nil {
+		target = py.Float(*t.TargetFitness)
+	}
+	return py.Assign("stop", py.Call("Termination", ngen).
+		Kw("weight", py.Float(weights[0])).
+		Kw("target", target).
+		Kw("stagnation", py.Int(t.Stagnation)).
+		Kw("max_evaluations", py.Int(t.MaxEvaluations)).
+		Kw("max_time", py.Float(t.MaxTime)))
+}
+
+// terminationClass is the Python side of Termination. update is called
+// once per generation with the evaluations it made and returns the reason
+// to stop, if any. state and restore carry it across checkpoints, and
+// finish reports the outcome for save_results.
+func terminationClass() py.Stmt {
+	return py.Source(`
+		class Termination:
+			def __init__(self, ngen, weight=1.0, target=None, stagnation=0, max_evaluations=0, max_time=0):
+				self.ngen = ngen
+				self.weight = weight
+				self.target = target
+				self.stagnation = stagnation
+				self.max_evaluations = max_evaluations
+				self.max_time = max_time
+				self.start = time.time()
+				self.generation = 0
+				self.evaluations = 0
+				self.best = None
+				self.stagnant = 0
+				self.reason = None
+
+			def update(self, generation, population, nevals):
+				self.generation = generation
+				self.evaluations += nevals
+				# Weighted values are maximised whatever the sign of the weight.
+				best = max(ind.fitness.wvalues for ind in population)
+				if self.best is None or best > self.best:
+					self.best = best
+					self.stagnant = 0
+				else:
+					self.stagnant += 1
+
+				if self.target is not None and self.best[0] >= self.target * self.weight:
+					self.reason = 'targetFitness'
+				elif self.stagnation and self.stagnant >= self.stagnation:
+					self.reason = 'stagnation'
+				elif self.max_evaluations and self.evaluations >= self.max_evaluations:
+					self.reason = 'maxEvaluations'
+				elif self.max_time and time.time() - self.start >= self.max_time:
+					self.reason = 'maxTime'
+				elif generation >= self.ngen:
+					self.reason = 'generations'
+				return self.reason
+
+			def state(self):
+				return {'generation': self.generation, 'evaluations': self.evaluations, 'best': self.best, 'stagnant': self.stagnant, 'elapsed': time.time() - self.start}
+
+			def restore(self, state):
+				self.generation = state['generation']
+				self.evaluations = state['evaluations']
+				self.best = state['best']
+				self.stagnant = state['stagnant']
+				self.start = time.time() - state['elapsed']
+
+			def finish(self):
+				reason = self.reason or 'generations'
+				print(f'Stopped after generation {self.generation}: {reason}')
+				return {'stopReason': reason, 'generations': self.generation, 'evaluations': self.evaluations, 'elapsed': time.time() - self.start}
+	`)
+}
@@ -0,0 +1,179 @@
+import random, os, json, math, pickle, time
+from deap import base, creator, tools, algorithms, cma
+import numpy
+import matplotlib.pyplot as plt
+from functools import reduce, partial
+from scoop import futures
+from deap import benchmarks
+from itertools import chain
+random.seed(42)
+numpy.random.seed(42)
+
+def run_cma(centroid, sigma, lambda_, ngen, stats, halloffame, restarts=None, max_restarts=0, inc_popsize=2, tolfun=1e-12, tolx=1e-12, stop=None):
+	logbook = tools.Logbook()
+	logbook.header = ['gen', 'restart', 'lambda_', 'evals'] + (stats.fields if stats else [])
+	N = len(centroid)
+	default_lambda = lambda_ or int(4 + 3 * math.log(N))
+	gen, restart, large_runs = 0, 0, 0
+	large_evals, small_evals = 0, 0
+	population = []
+	while True:
+		# BIPOP runs a small-population regime whenever it has used fewer evaluations than the large one.
+		if restarts == 'bipop' and restart > 0 and small_evals < large_evals:
+			regime = 'small'
+			lambda_r = max(2, int(default_lambda * (0.5 * inc_popsize ** large_runs) ** (random.random() ** 2)))
+			sigma_r = sigma * 10 ** (-2 * random.random())
+		else:
+			regime = 'large'
+			lambda_r = int(default_lambda * inc_popsize ** large_runs)
+			sigma_r = sigma
+		strategy = cma.Strategy(centroid=centroid, sigma=sigma_r, lambda_=lambda_r)
+		toolbox.register('generate', strategy.generate, creator.Individual)
+		toolbox.register('update', strategy.update)
+		tolhist = 10 + int(math.ceil(30.0 * N / lambda_r))
+		history = []
+		reason = 'generations'
+		while gen < ngen:
+			gen += 1
+			population = toolbox.generate()
+			fitnesses = toolbox.map(toolbox.evaluate, population)
+			for ind, fit in zip(population, fitnesses):
+				ind.fitness.values = fit
+			if halloffame is not None:
+				halloffame.update(population)
+			# update() sorts the population, best first.
+			toolbox.update(population)
+			record = stats.compile(population) if stats else {}
+			logbook.record(gen=gen, restart=restart, lambda_=lambda_r, evals=len(population), **record)
+			print(logbook.stream)
+			emit_metrics(gen, len(population), population, halloffame[0] if halloffame else None)
+			if regime == 'large':
+				large_evals += len(population)
+			else:
+				small_evals += len(population)
+			if stop and stop.update(gen, population, len(population)):
+				break
+			if not restarts:
+				continue
+			history.append(population[0].fitness.values[0])
+			if len(history) >= tolhist and max(history[-tolhist:]) - min(history[-tolhist:]) < tolfun:
+				reason = 'tolfun'
+				break
+			if strategy.sigma * max(strategy.diagD) < tolx:
+				reason = 'tolx'
+				break
+			if strategy.cond > 1e14:
+				reason = 'conditioncov'
+				break
+		if not restarts or gen >= ngen or restart >= max_restarts or (stop and stop.reason):
+			break
+		if regime == 'large':
+			large_runs += 1
+		restart += 1
+		print(f'CMA-ES restart {restart} after {reason} (generation {gen})')
+	return population, logbook
+
+def diversity(population):
+	try:
+		points = numpy.array([list(ind) for ind in population], dtype=float)
+	except (TypeError, ValueError):
+		return len({str(ind) for ind in population}) / len(population)
+	return float(numpy.mean(numpy.linalg.norm(points - points.mean(axis=0), axis=1)))
+
+metric_history = []
+
+def emit_metrics(gen, evals, population, best=None):
+	fitnesses = numpy.array([ind.fitness.values for ind in population], dtype=float)
+	def summary(values):
+		values = values.tolist()
+		return values[0] if len(values) == 1 else values
+	record = {
+		'gen': gen,
+		'evals': evals,
+		'avg': summary(fitnesses.mean(axis=0)),
+		'min': summary(fitnesses.min(axis=0)),
+		'max': summary(fitnesses.max(axis=0)),
+		'std': summary(fitnesses.std(axis=0)),
+		'diversity': diversity(population),
+		'best': best.fitness.values[0] if best is not None and fitnesses.shape[1] == 1 else None,
+	}
+	metric_history.append(record)
+	print('@@METRIC ' + json.dumps(record), flush=True)
+
+def save_results(path, best, stop=None):
+	results = {
+		'best': list(best.fitness.values) if best is not None else None,
+		'generations': metric_history[-1]['gen'] if metric_history else 0,
+		'evaluations': sum(record['evals'] for record in metric_history),
+		'metrics': metric_history,
+	}
+	if stop is not None:
+		results.update(stop.finish())
+	with open(path, 'w') as f:
+		json.dump(results, f, indent=2)
+
+toolbox = base.Toolbox()
+
+creator.create('FitnessMax', base.Fitness, weights=(-1,))
+creator.create('Individual', list, fitness=creator.FitnessMax)
+
+toolbox.register('attr', random.uniform, -5, 5)
+toolbox.register('individual', tools.initRepeat, creator.Individual, toolbox.attr, 5)
+toolbox.register('population', tools.initRepeat, list, toolbox.individual)
+toolbox.register('evaluate', benchmarks.rastrigin)
+
+toolbox.register('map', futures.map)
+
+def main():
+	populationSize = 60
+	generations = 30
+	cxpb = 0.5
+	mutpb = 0.3
+	N = 5
+
+	pop = toolbox.population(n=populationSize)
+	hof = tools.HallOfFame(1)
+
+	stats = tools.Statistics(lambda ind: ind.fitness.values)
+	stats.register('avg', numpy.mean)
+	stats.register('min', numpy.min)
+	stats.register('max', numpy.max)
+
+	pop, logbook = run_cma([0] * N, sigma=2.5, lambda_=0, ngen=generations, stats=stats, halloffame=hof, restarts=None, max_restarts=0, inc_popsize=0, tolfun=0, tolx=0, stop=None)
+	save_results(os.path.join(os.path.dirname(os.path.abspath(__file__)), 'results.json'), hof[0], stop=None)
+
+	rootPath = os.path.dirname(os.path.abspath(__file__))
+	with open(f"{rootPath}/logbook.txt", "w") as f:
+		f.write(str(logbook))
+
+	out_file = open(f"{rootPath}/best.txt", "w")
+	out_file.write(f"Best individual fitness: {hof[0].fitness.values}\n")
+	out_file.write(f"Best individual: {hof[0]}\n")
+	out_file.close()
+
+	gen = logbook.select("gen")
+	avg = logbook.select("avg")
+	min_ = logbook.select("min")
+	max_ = logbook.select("max")
+
+	plt.plot(gen, avg, label="average")
+	plt.plot(gen, min_, label="minimum")
+	plt.plot(gen, max_, label="maximum")
+	plt.xlabel("Generation")
+	plt.ylabel("Fitness")
+	plt.legend(loc="lower right")
+	plt.savefig(f"{rootPath}/fitness_plot.png", dpi=300)
+	plt.close()
+
+	avg_fitness = logbook.select("avg")
+	fitness_diff = [avg_fitness[i] - avg_fitness[i-1] for i in range(1, len(avg_fitness))]
+	plt.plot(gen[1:], fitness_diff, label="Fitness Change", color="purple")
+	plt.xlabel("Generation")
+	plt.ylabel("Fitness Change")
+	plt.title("Effect of Mutation and Crossover on Fitness")
+	plt.legend()
+	plt.savefig(f"{rootPath}/mutation_crossover_effect.png", dpi=300)
+	plt.close()
+
+if __name__ == '__main__':
+	main()
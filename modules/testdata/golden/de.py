@@ -0,0 +1,198 @@
+import random, os, json, math, pickle, time
+from deap import base, creator, tools, algorithms, cma
+import numpy
+import matplotlib.pyplot as plt
+from functools import reduce, partial
+from scoop import futures
+from deap import benchmarks
+from itertools import chain
+random.seed(42)
+numpy.random.seed(42)
+
+def mutDE_best2(y, best, b, c, d, e, f):
+	size = len(y)
+	for i in range(size):
+		y[i] = best[i] + f * (b[i] - c[i]) + f * (d[i] - e[i])
+	return y
+
+def cxBinomial(x, y, cr):
+	size = len(x)
+	index = random.randrange(size)
+	for i in range(size):
+		if i == index or random.random() < cr:
+			x[i] = y[i]
+	return x
+
+def cxExponential(x, y, cr):
+	size = len(x)
+	index = random.randrange(size)
+	for i in chain(range(index, size), range(0, index)):
+		x[i] = y[i]
+		if random.random() < cr:
+			break
+	return x
+
+def diversity(population):
+	try:
+		points = numpy.array([list(ind) for ind in population], dtype=float)
+	except (TypeError, ValueError):
+		return len({str(ind) for ind in population}) / len(population)
+	return float(numpy.mean(numpy.linalg.norm(points - points.mean(axis=0), axis=1)))
+
+metric_history = []
+
+def emit_metrics(gen, evals, population, best=None):
+	fitnesses = numpy.array([ind.fitness.values for ind in population], dtype=float)
+	def summary(values):
+		values = values.tolist()
+		return values[0] if len(values) == 1 else values
+	record = {
+		'gen': gen,
+		'evals': evals,
+		'avg': summary(fitnesses.mean(axis=0)),
+		'min': summary(fitnesses.min(axis=0)),
+		'max': summary(fitnesses.max(axis=0)),
+		'std': summary(fitnesses.std(axis=0)),
+		'diversity': diversity(population),
+		'best': best.fitness.values[0] if best is not None and fitnesses.shape[1] == 1 else None,
+	}
+	metric_history.append(record)
+	print('@@METRIC ' + json.dumps(record), flush=True)
+
+def save_results(path, best, stop=None):
+	results = {
+		'best': list(best.fitness.values) if best is not None else None,
+		'generations': metric_history[-1]['gen'] if metric_history else 0,
+		'evaluations': sum(record['evals'] for record in metric_history),
+		'metrics': metric_history,
+	}
+	if stop is not None:
+		results.update(stop.finish())
+	with open(path, 'w') as f:
+		json.dump(results, f, indent=2)
+
+toolbox = base.Toolbox()
+
+creator.create('FitnessMax', base.Fitness, weights=(-1,))
+creator.create('Individual', list, fitness=creator.FitnessMax)
+
+toolbox.register('attr', random.uniform, -5, 5)
+toolbox.register('individual', tools.initRepeat, creator.Individual, toolbox.attr, 5)
+toolbox.register('population', tools.initRepeat, list, toolbox.individual)
+toolbox.register('evaluate', benchmarks.sphere)
+CR = 0.9
+F = 0.5
+toolbox.register('mutate', mutDE_best2, f=F)
+toolbox.register('mate', cxExponential, cr=CR)
+
+toolbox.register('map', futures.map)
+
+def main():
+	populationSize = 40
+	generations = 50
+	cxpb = 0.5
+	mutpb = 0.2
+	N = 5
+
+	pop = toolbox.population(n=populationSize)
+	hof = tools.HallOfFame(1)
+
+	stats = tools.Statistics(lambda ind: ind.fitness.values)
+	stats.register('avg', numpy.mean)
+	stats.register('min', numpy.min)
+	stats.register('max', numpy.max)
+
+	logbook = tools.Logbook()
+	logbook.header = 'gen', 'evals', 'min', 'avg', 'max'
+	fitnesses = toolbox.map(toolbox.evaluate, pop)
+	for ind, fit in zip(pop, fitnesses):
+		ind.fitness.values = fit
+	hof.update(pop)
+	record = stats.compile(pop)
+	logbook.record(gen=0, evals=len(pop), **record)
+	print(logbook.stream)
+	emit_metrics(0, len(pop), pop, hof[0])
+
+	H = 10
+	M_F = [F] * H
+	M_CR = [CR] * H
+	k = 0
+
+	for g in range(1, generations + 1):
+		best = tools.selBest(pop, 1)[0]
+		children = []
+		S_F, S_CR, S_W = [], [], []
+		for i, agent in enumerate(pop):
+			r = random.randrange(H)
+			cr = min(1.0, max(0.0, random.gauss(M_CR[r], 0.1)))
+			f = 0
+			while f <= 0:
+				f = M_F[r] + 0.1 * math.tan(math.pi * (random.random() - 0.5))
+			f = min(f, 1.0)
+			others = pop[:i] + pop[i+1:]
+			donors = [toolbox.clone(ind) for ind in random.sample(others, 4)]
+			x = toolbox.clone(agent)
+			y = toolbox.clone(agent)
+			y = toolbox.mutate(y, best, donors[0], donors[1], donors[2], donors[3], f=f)
+			z = toolbox.mate(x, y, cr=cr)
+			del z.fitness.values
+			children.append((z, f, cr))
+
+		fitnesses = toolbox.map(toolbox.evaluate, [z for z, _, _ in children])
+		for i, ((z, f, cr), fit) in enumerate(zip(children, fitnesses)):
+			z.fitness.values = fit
+			if z.fitness > pop[i].fitness:
+				S_F.append(f)
+				S_CR.append(cr)
+				S_W.append(abs(sum(z.fitness.wvalues) - sum(pop[i].fitness.wvalues)))
+				pop[i] = z
+
+		if S_F:
+			total = sum(S_W)
+			w = [s / total for s in S_W] if total > 0 else [1 / len(S_W)] * len(S_W)
+			M_CR[k] = sum(wi * c for wi, c in zip(w, S_CR))
+			M_F[k] = sum(wi * f * f for wi, f in zip(w, S_F)) / sum(wi * f for wi, f in zip(w, S_F))
+			k = (k + 1) % H
+
+		hof.update(pop)
+		record = stats.compile(pop)
+		logbook.record(gen=g, evals=len(pop), **record)
+		print(logbook.stream)
+		emit_metrics(g, len(pop), pop, hof[0])
+	save_results(os.path.join(os.path.dirname(os.path.abspath(__file__)), 'results.json'), hof[0], stop=None)
+
+	rootPath = os.path.dirname(os.path.abspath(__file__))
+	with open(f"{rootPath}/logbook.txt", "w") as f:
+		f.write(str(logbook))
+
+	out_file = open(f"{rootPath}/best.txt", "w")
+	out_file.write(f"Best individual fitness: {hof[0].fitness.values}\n")
+	out_file.write(f"Best individual: {hof[0]}\n")
+	out_file.close()
+
+	gen = logbook.select("gen")
+	avg = logbook.select("avg")
+	min_ = logbook.select("min")
+	max_ = logbook.select("max")
+
+	plt.plot(gen, avg, label="average")
+	plt.plot(gen, min_, label="minimum")
+	plt.plot(gen, max_, label="maximum")
+	plt.xlabel("Generation")
+	plt.ylabel("Fitness")
+	plt.legend(loc="lower right")
+	plt.savefig(f"{rootPath}/fitness_plot.png", dpi=300)
+	plt.close()
+
+	avg_fitness = logbook.select("avg")
+	fitness_diff = [avg_fitness[i] - avg_fitness[i-1] for i in range(1, len(avg_fitness))]
+	plt.plot(gen[1:], fitness_diff, label="Fitness Change", color="purple")
+	plt.xlabel("Generation")
+	plt.ylabel("Fitness Change")
+	plt.title("Effect of Mutation and Crossover on Fitness")
+	plt.legend()
+	plt.savefig(f"{rootPath}/mutation_crossover_effect.png", dpi=300)
+	plt.close()
+
+if __name__ == '__main__':
+	main()
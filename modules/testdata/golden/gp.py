@@ -0,0 +1,297 @@
+import operator
+import math
+import random
+import numpy
+import os
+import pickle
+import json
+import time
+import matplotlib.pyplot as plt
+import networkx as nx
+from functools import partial
+from deap import algorithms, base, creator, tools, gp, cma
+from scoop import futures
+random.seed(42)
+numpy.random.seed(42)
+points = [x / 10.0 for x in range(-10, 10)]
+X = numpy.array([[x] for x in points])
+y = numpy.array([eval('x**4 + x**3 + x**2 + x', globals(), {'x': x}) for x in points], dtype=float)
+train = numpy.arange(len(y))
+validation = numpy.arange(0)
+
+def regression_metrics(func, X, y):
+	with numpy.errstate(all='ignore'):
+		try:
+			error = numpy.array([func(*row) for row in X.tolist()], dtype=float) - y
+		except (ArithmeticError, ValueError, TypeError):
+			error = numpy.full(len(y), math.inf)
+		sse = float(numpy.sum(error ** 2))
+		sst = float(numpy.sum((y - numpy.mean(y)) ** 2))
+		metrics = {
+			'mse': sse / len(y),
+			'r2': 1 - sse / sst if sst > 0 else math.nan,
+			'mae': float(numpy.mean(numpy.abs(error))),
+		}
+	# NaN and infinities have no JSON form.
+	return {name: value if math.isfinite(value) else None for name, value in metrics.items()}
+
+def evalSymbReg(individual, X, y):
+	# Transform the tree expression in a callable function
+	func = toolbox.compile(expr=individual)
+	mse = regression_metrics(func, X, y)['mse']
+	return (mse if mse is not None else math.inf,)
+
+toolbox = base.Toolbox()
+pset = gp.PrimitiveSet('MAIN', 1)
+
+def protectedDiv(left, right):
+	try:
+		return left / right
+	except ZeroDivisionError:
+		return 1
+
+pset.addPrimitive(operator.add, 2)
+pset.addPrimitive(operator.sub, 2)
+pset.addPrimitive(operator.mul, 2)
+pset.addPrimitive(protectedDiv, 2)
+pset.addPrimitive(operator.neg, 1)
+pset.addPrimitive(math.cos, 1)
+pset.addPrimitive(math.sin, 1)
+
+def add_ephemeral(name, func, *ret_type):
+	# DEAP keeps the class of an ephemeral in deap.gp by name, and
+	# rejects the name for another function, as when scoop imports
+	# this module again in the same process: drop the stale class.
+	stale = getattr(gp, name, None)
+	if isinstance(stale, type) and issubclass(stale, gp.Ephemeral):
+		delattr(gp, name)
+	pset.addEphemeralConstant(name, func, *ret_type)
+
+add_ephemeral('rand101', partial(random.randint, -1, 1))
+arg_dict = {'ARG0': 'x'}
+pset.renameArguments(**arg_dict)
+
+creator.create('Fitness', base.Fitness, weights=(-1,))
+creator.create('Individual', gp.PrimitiveTree, fitness=creator.Fitness)
+
+toolbox.register('expr', gp.genHalfAndHalf, pset=pset, min_=1, max_=2)
+toolbox.register('individual', tools.initIterate, creator.Individual, toolbox.expr)
+toolbox.register('population', tools.initRepeat, list, toolbox.individual)
+toolbox.register('compile', gp.compile, pset=pset)
+
+toolbox.register('evaluate', evalSymbReg, X=X[train], y=y[train])
+
+toolbox.register('select', tools.selTournament, tournsize=3)
+toolbox.register('mate', gp.cxOnePoint)
+toolbox.register('expr_mut', gp.genFull, min_=0, max_=2)
+toolbox.register('mutate', gp.mutUniform, expr=toolbox.expr_mut, pset=pset)
+toolbox.decorate('mate', gp.staticLimit(key=operator.attrgetter('height'), max_value=17))
+toolbox.decorate('mutate', gp.staticLimit(key=operator.attrgetter('height'), max_value=17))
+toolbox.register('map', futures.map)
+
+def diversity(population):
+	try:
+		points = numpy.array([list(ind) for ind in population], dtype=float)
+	except (TypeError, ValueError):
+		return len({str(ind) for ind in population}) / len(population)
+	return float(numpy.mean(numpy.linalg.norm(points - points.mean(axis=0), axis=1)))
+
+metric_history = []
+
+def emit_metrics(gen, evals, population, best=None):
+	fitnesses = numpy.array([ind.fitness.values for ind in population], dtype=float)
+	def summary(values):
+		values = values.tolist()
+		return values[0] if len(values) == 1 else values
+	record = {
+		'gen': gen,
+		'evals': evals,
+		'avg': summary(fitnesses.mean(axis=0)),
+		'min': summary(fitnesses.min(axis=0)),
+		'max': summary(fitnesses.max(axis=0)),
+		'std': summary(fitnesses.std(axis=0)),
+		'diversity': diversity(population),
+		'best': best.fitness.values[0] if best is not None and fitnesses.shape[1] == 1 else None,
+	}
+	metric_history.append(record)
+	print('@@METRIC ' + json.dumps(record), flush=True)
+
+def save_results(path, best, stop=None):
+	results = {
+		'best': list(best.fitness.values) if best is not None else None,
+		'generations': metric_history[-1]['gen'] if metric_history else 0,
+		'evaluations': sum(record['evals'] for record in metric_history),
+		'metrics': metric_history,
+	}
+	if stop is not None:
+		results.update(stop.finish())
+	with open(path, 'w') as f:
+		json.dump(results, f, indent=2)
+
+def save_checkpoint(path, population, generation, halloffame, logbook, stop=None):
+	state = {
+		'population': population,
+		'generation': generation,
+		'halloffame': list(halloffame) if halloffame is not None else None,
+		'logbook': logbook,
+		'random': random.getstate(),
+		'numpy': numpy.random.get_state(),
+		'termination': stop.state() if stop else None,
+		'metric_history': metric_history,
+	}
+	# Written to a temporary file first so a crash never leaves a partial checkpoint.
+	with open(path + '.tmp', 'wb') as f:
+		pickle.dump(state, f)
+	os.replace(path + '.tmp', path)
+
+def load_checkpoint(path, population, halloffame, stop=None):
+	with open(path, 'rb') as f:
+		state = pickle.load(f)
+	population[:] = state['population']
+	if halloffame is not None:
+		halloffame.clear()
+		halloffame.update(state['halloffame'])
+	random.setstate(state['random'])
+	numpy.random.set_state(state['numpy'])
+	if stop and state.get('termination'):
+		stop.restore(state['termination'])
+	# results.json covers the generations before the checkpoint too.
+	metric_history[:] = state.get('metric_history', [])
+	print(f'Resuming from checkpoint at generation {state["generation"]}')
+	return state['logbook'], state['generation'] + 1
+
+def evaluate(population, toolbox, halloffame):
+	invalid = [ind for ind in population if not ind.fitness.valid]
+	for ind, fit in zip(invalid, toolbox.map(toolbox.evaluate, invalid)):
+		ind.fitness.values = fit
+	if halloffame is not None:
+		halloffame.update(population)
+	return len(invalid)
+
+def generation(population, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_):
+	if algorithm == 'eaSimple':
+		offspring = algorithms.varAnd(toolbox.select(population, len(population)), toolbox, cxpb, mutpb)
+	else:
+		offspring = algorithms.varOr(population, toolbox, lambda_, cxpb, mutpb)
+	nevals = evaluate(offspring, toolbox, halloffame)
+	if algorithm == 'eaSimple':
+		population[:] = offspring
+	elif algorithm == 'eaMuPlusLambda':
+		population[:] = toolbox.select(population + offspring, mu)
+	else:
+		population[:] = toolbox.select(offspring, mu)
+	return nevals
+
+def evolve(population, toolbox, algorithm, cxpb, mutpb, ngen, stats, halloffame, mu=0, lambda_=0, checkpoint_every=0, stop=None):
+	checkpoint = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'checkpoint.pkl')
+	if os.path.exists(checkpoint):
+		logbook, start = load_checkpoint(checkpoint, population, halloffame, stop)
+	else:
+		logbook = tools.Logbook()
+		logbook.header = ['gen', 'nevals'] + (stats.fields if stats else [])
+		nevals = evaluate(population, toolbox, halloffame)
+		logbook.record(gen=0, nevals=nevals, **(stats.compile(population) if stats else {}))
+		print(logbook.stream)
+		emit_metrics(0, nevals, population, halloffame[0] if halloffame else None)
+		if stop:
+			stop.update(0, population, nevals)
+		start = 1
+
+	for gen in range(start, ngen + 1):
+		if stop and stop.reason:
+			break
+		nevals = generation(population, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_)
+		logbook.record(gen=gen, nevals=nevals, **(stats.compile(population) if stats else {}))
+		print(logbook.stream)
+		emit_metrics(gen, nevals, population, halloffame[0] if halloffame else None)
+		if stop:
+			stop.update(gen, population, nevals)
+		if checkpoint_every and gen % checkpoint_every == 0:
+			save_checkpoint(checkpoint, population, gen, halloffame, logbook, stop)
+	return population, logbook
+
+def record_islands(logbook, gen, islands, nevals, stats, halloffame):
+	# The top level holds statistics over all islands, each island has its own chapter.
+	population = [ind for island in islands for ind in island]
+	chapters = {f'island{i}': dict(nevals=n, **(stats.compile(island) if stats else {})) for i, (island, n) in enumerate(zip(islands, nevals))}
+	logbook.record(gen=gen, nevals=sum(nevals), **(stats.compile(population) if stats else {}), **chapters)
+	print(logbook.stream)
+	emit_metrics(gen, sum(nevals), population, halloffame[0] if halloffame else None)
+
+def evolve_islands(islands, toolbox, algorithm, cxpb, mutpb, ngen, stats, halloffame, mu=0, lambda_=0, checkpoint_every=0, stop=None, migration_interval=1, migrants=1, emigrants=tools.selBest, replacement=None, migarray=None):
+	checkpoint = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'checkpoint.pkl')
+	if os.path.exists(checkpoint):
+		logbook, start = load_checkpoint(checkpoint, islands, halloffame, stop)
+	else:
+		logbook = tools.Logbook()
+		logbook.header = ['gen', 'nevals'] + (stats.fields if stats else []) + [f'island{i}' for i in range(len(islands))]
+		nevals = [evaluate(island, toolbox, halloffame) for island in islands]
+		record_islands(logbook, 0, islands, nevals, stats, halloffame)
+		if stop:
+			stop.update(0, [ind for island in islands for ind in island], sum(nevals))
+		start = 1
+
+	for gen in range(start, ngen + 1):
+		if stop and stop.reason:
+			break
+		nevals = [generation(island, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_) for island in islands]
+		if gen % migration_interval == 0:
+			tools.migRing(islands, migrants, emigrants, replacement=replacement, migarray=migarray)
+		record_islands(logbook, gen, islands, nevals, stats, halloffame)
+		if stop:
+			stop.update(gen, [ind for island in islands for ind in island], sum(nevals))
+		if checkpoint_every and gen % checkpoint_every == 0:
+			save_checkpoint(checkpoint, islands, gen, halloffame, logbook, stop)
+	return islands, logbook
+
+def main():
+	rootPath = os.path.dirname(os.path.abspath(__file__))
+	pop = toolbox.population(n=300)
+	hof = tools.HallOfFame(1)
+	stats_fit = tools.Statistics(lambda ind: ind.fitness.values)
+	stats_size = tools.Statistics(len)
+	mstats = tools.MultiStatistics(fitness=stats_fit, size=stats_size)
+	mstats.register('avg', numpy.mean)
+	mstats.register('std', numpy.std)
+	mstats.register('min', numpy.min)
+	mstats.register('max', numpy.max)
+
+	N = 0
+	pop, logbook = evolve(pop, toolbox, 'eaSimple', cxpb=0.5, mutpb=0.1, ngen=40, stats=mstats, halloffame=hof, mu=0, lambda_=0, checkpoint_every=0)
+	save_results(os.path.join(os.path.dirname(os.path.abspath(__file__)), 'results.json'), hof[0], stop=None)
+	with open(f"{rootPath}/logbook.txt", "w") as f:
+		f.write(str(logbook))
+
+	func = toolbox.compile(expr=hof[0])
+	regression = {
+		'train': regression_metrics(func, X[train], y[train]),
+		'validation': regression_metrics(func, X[validation], y[validation]) if len(validation) else None,
+	}
+	with open(f"{rootPath}/regression.json", "w") as f:
+		json.dump(regression, f, indent=2)
+
+	out_file = open(f"{rootPath}/best.txt", "w")
+	out_file.write(f"Best individual fitness: {hof[0].fitness.values}\n")
+	out_file.write(f"Best individual: {hof[0]}\n")
+	for rows, metrics in regression.items():
+		if metrics is not None:
+			out_file.write(f"{rows.capitalize()} MSE: {metrics['mse']}, R2: {metrics['r2']}, MAE: {metrics['mae']}\n")
+	out_file.close()
+
+	expr = hof[0]
+	nodes, edges, labels = gp.graph(expr)
+	g = nx.Graph()
+	g.add_nodes_from(nodes)
+	g.add_edges_from(edges)
+	pos = nx.nx_agraph.graphviz_layout(g, prog='dot')
+
+	plt.figure(figsize=(7,7))
+	nx.draw_networkx_nodes(g, pos, node_size=900, node_color='skyblue')
+	nx.draw_networkx_edges(g, pos, edge_color='gray')
+	nx.draw_networkx_labels(g, pos, labels, font_color='black')
+	plt.axis('off')
+	plt.savefig(f'{rootPath}/graph.png', dpi=300)
+	plt.close()
+
+if __name__ == '__main__':
+	main()
@@ -0,0 +1,217 @@
+import random, os, json, math, pickle, time
+from deap import base, creator, tools, algorithms, cma
+import numpy
+import matplotlib.pyplot as plt
+from functools import reduce, partial
+from scoop import futures
+from deap import benchmarks
+from itertools import chain
+random.seed(42)
+numpy.random.seed(42)
+
+def diversity(population):
+	try:
+		points = numpy.array([list(ind) for ind in population], dtype=float)
+	except (TypeError, ValueError):
+		return len({str(ind) for ind in population}) / len(population)
+	return float(numpy.mean(numpy.linalg.norm(points - points.mean(axis=0), axis=1)))
+
+metric_history = []
+
+def emit_metrics(gen, evals, population, best=None):
+	fitnesses = numpy.array([ind.fitness.values for ind in population], dtype=float)
+	def summary(values):
+		values = values.tolist()
+		return values[0] if len(values) == 1 else values
+	record = {
+		'gen': gen,
+		'evals': evals,
+		'avg': summary(fitnesses.mean(axis=0)),
+		'min': summary(fitnesses.min(axis=0)),
+		'max': summary(fitnesses.max(axis=0)),
+		'std': summary(fitnesses.std(axis=0)),
+		'diversity': diversity(population),
+		'best': best.fitness.values[0] if best is not None and fitnesses.shape[1] == 1 else None,
+	}
+	metric_history.append(record)
+	print('@@METRIC ' + json.dumps(record), flush=True)
+
+def save_results(path, best, stop=None):
+	results = {
+		'best': list(best.fitness.values) if best is not None else None,
+		'generations': metric_history[-1]['gen'] if metric_history else 0,
+		'evaluations': sum(record['evals'] for record in metric_history),
+		'metrics': metric_history,
+	}
+	if stop is not None:
+		results.update(stop.finish())
+	with open(path, 'w') as f:
+		json.dump(results, f, indent=2)
+
+def save_checkpoint(path, population, generation, halloffame, logbook, stop=None):
+	state = {
+		'population': population,
+		'generation': generation,
+		'halloffame': list(halloffame) if halloffame is not None else None,
+		'logbook': logbook,
+		'random': random.getstate(),
+		'numpy': numpy.random.get_state(),
+		'termination': stop.state() if stop else None,
+		'metric_history': metric_history,
+	}
+	# Written to a temporary file first so a crash never leaves a partial checkpoint.
+	with open(path + '.tmp', 'wb') as f:
+		pickle.dump(state, f)
+	os.replace(path + '.tmp', path)
+
+def load_checkpoint(path, population, halloffame, stop=None):
+	with open(path, 'rb') as f:
+		state = pickle.load(f)
+	population[:] = state['population']
+	if halloffame is not None:
+		halloffame.clear()
+		halloffame.update(state['halloffame'])
+	random.setstate(state['random'])
+	numpy.random.set_state(state['numpy'])
+	if stop and state.get('termination'):
+		stop.restore(state['termination'])
+	# results.json covers the generations before the checkpoint too.
+	metric_history[:] = state.get('metric_history', [])
+	print(f'Resuming from checkpoint at generation {state["generation"]}')
+	return state['logbook'], state['generation'] + 1
+
+def evaluate(population, toolbox, halloffame):
+	invalid = [ind for ind in population if not ind.fitness.valid]
+	for ind, fit in zip(invalid, toolbox.map(toolbox.evaluate, invalid)):
+		ind.fitness.values = fit
+	if halloffame is not None:
+		halloffame.update(population)
+	return len(invalid)
+
+def generation(population, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_):
+	if algorithm == 'eaSimple':
+		offspring = algorithms.varAnd(toolbox.select(population, len(population)), toolbox, cxpb, mutpb)
+	else:
+		offspring = algorithms.varOr(population, toolbox, lambda_, cxpb, mutpb)
+	nevals = evaluate(offspring, toolbox, halloffame)
+	if algorithm == 'eaSimple':
+		population[:] = offspring
+	elif algorithm == 'eaMuPlusLambda':
+		population[:] = toolbox.select(population + offspring, mu)
+	else:
+		population[:] = toolbox.select(offspring, mu)
+	return nevals
+
+def evolve(population, toolbox, algorithm, cxpb, mutpb, ngen, stats, halloffame, mu=0, lambda_=0, checkpoint_every=0, stop=None):
+	checkpoint = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'checkpoint.pkl')
+	if os.path.exists(checkpoint):
+		logbook, start = load_checkpoint(checkpoint, population, halloffame, stop)
+	else:
+		logbook = tools.Logbook()
+		logbook.header = ['gen', 'nevals'] + (stats.fields if stats else [])
+		nevals = evaluate(population, toolbox, halloffame)
+		logbook.record(gen=0, nevals=nevals, **(stats.compile(population) if stats else {}))
+		print(logbook.stream)
+		emit_metrics(0, nevals, population, halloffame[0] if halloffame else None)
+		if stop:
+			stop.update(0, population, nevals)
+		start = 1
+
+	for gen in range(start, ngen + 1):
+		if stop and stop.reason:
+			break
+		nevals = generation(population, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_)
+		logbook.record(gen=gen, nevals=nevals, **(stats.compile(population) if stats else {}))
+		print(logbook.stream)
+		emit_metrics(gen, nevals, population, halloffame[0] if halloffame else None)
+		if stop:
+			stop.update(gen, population, nevals)
+		if checkpoint_every and gen % checkpoint_every == 0:
+			save_checkpoint(checkpoint, population, gen, halloffame, logbook, stop)
+	return population, logbook
+
+def record_islands(logbook, gen, islands, nevals, stats, halloffame):
+	# The top level holds statistics over all islands, each island has its own chapter.
+	population = [ind for island in islands for ind in island]
+	chapters = {f'island{i}': dict(nevals=n, **(stats.compile(island) if stats else {})) for i, (island, n) in enumerate(zip(islands, nevals))}
+	logbook.record(gen=gen, nevals=sum(nevals), **(stats.compile(population) if stats else {}), **chapters)
+	print(logbook.stream)
+	emit_metrics(gen, sum(nevals), population, halloffame[0] if halloffame else None)
+
+def evolve_islands(islands, toolbox, algorithm, cxpb, mutpb, ngen, stats, halloffame, mu=0, lambda_=0, checkpoint_every=0, stop=None, migration_interval=1, migrants=1, emigrants=tools.selBest, replacement=None, migarray=None):
+	checkpoint = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'checkpoint.pkl')
+	if os.path.exists(checkpoint):
+		logbook, start = load_checkpoint(checkpoint, islands, halloffame, stop)
+	else:
+		logbook = tools.Logbook()
+		logbook.header = ['gen', 'nevals'] + (stats.fields if stats else []) + [f'island{i}' for i in range(len(islands))]
+		nevals = [evaluate(island, toolbox, halloffame) for island in islands]
+		record_islands(logbook, 0, islands, nevals, stats, halloffame)
+		if stop:
+			stop.update(0, [ind for island in islands for ind in island], sum(nevals))
+		start = 1
+
+	for gen in range(start, ngen + 1):
+		if stop and stop.reason:
+			break
+		nevals = [generation(island, toolbox, algorithm, cxpb, mutpb, halloffame, mu, lambda_) for island in islands]
+		if gen % migration_interval == 0:
+			tools.migRing(islands, migrants, emigrants, replacement=replacement, migarray=migarray)
+		record_islands(logbook, gen, islands, nevals, stats, halloffame)
+		if stop:
+			stop.update(gen, [ind for island in islands for ind in island], sum(nevals))
+		if checkpoint_every and gen % checkpoint_every == 0:
+			save_checkpoint(checkpoint, islands, gen, halloffame, logbook, stop)
+	return islands, logbook
+
+toolbox = base.Toolbox()
+
+creator.create('FitnessMulti', base.Fitness, weights=(-1, -1))
+creator.create('Individual', list, fitness=creator.FitnessMulti)
+
+toolbox.register('attr', random.uniform, 0, 1)
+toolbox.register('individual', tools.initRepeat, creator.Individual, toolbox.attr, 30)
+toolbox.register('population', tools.initRepeat, list, toolbox.individual)
+toolbox.register('evaluate', benchmarks.zdt1)
+toolbox.register('mutate', tools.mutShuffleIndexes, indpb=0.1)
+toolbox.register('mate', tools.cxTwoPoint)
+toolbox.register('select', tools.selNSGA2)
+
+toolbox.register('map', futures.map)
+
+def main():
+	populationSize = 100
+	generations = 50
+	cxpb = 0.6
+	mutpb = 0.3
+	N = 30
+
+	pop = toolbox.population(n=populationSize)
+	hof = tools.ParetoFront()
+
+	stats = tools.Statistics(lambda ind: ind.fitness.values)
+	stats.register('avg', numpy.mean, axis=0)
+	stats.register('min', numpy.min, axis=0)
+	stats.register('max', numpy.max, axis=0)
+
+	pop, logbook = evolve(pop, toolbox, 'eaMuPlusLambda', cxpb=cxpb, mutpb=mutpb, ngen=generations, stats=stats, halloffame=hof, mu=100, lambda_=100, checkpoint_every=0)
+	save_results(os.path.join(os.path.dirname(os.path.abspath(__file__)), 'results.json'), None, stop=None)
+
+	rootPath = os.path.dirname(os.path.abspath(__file__))
+	with open(f"{rootPath}/logbook.txt", "w") as f:
+		f.write(str(logbook))
+
+	front = [{"fitness": list(ind.fitness.values), "individual": list(ind)} for ind in hof]
+	with open(f"{rootPath}/pareto.json", "w") as f:
+		json.dump(front, f, indent=2)
+
+	fitnesses = numpy.array([ind.fitness.values for ind in hof])
+	plt.scatter(fitnesses[:, 0], fitnesses[:, 1], color="red")
+	plt.xlabel("Objective 1")
+	plt.ylabel("Objective 2")
+	plt.title("Pareto Front")
+	plt.savefig(f"{rootPath}/pareto_front.png", dpi=300)
+	plt.close()
+
+if __name__ == '__main__':
+	main()
@@ -0,0 +1,402 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evolve/db/connection"
+	"evolve/util"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"time"
+)
+
+// Most runs a trial group can have.
+const maxTrials = 100
+
+type (
+	// TrialReq runs Config Trials times with distinct seeds. Seeds follow
+	// the seed of Config when it has one, and are drawn otherwise.
+	TrialReq struct {
+		Name   string         `json:"name"`
+		Type   string         `json:"type"` // "ea", "gp", "ml" or "pso".
+		Config map[string]any `json:"config"`
+		Trials int            `json:"trials"`
+
+		seeds []int64
+	}
+
+	TrialDataReq struct {
+		GroupID string `json:"groupID"`
+	}
+
+	TrialCompareReq struct {
+		GroupA string `json:"groupA"`
+		GroupB string `json:"groupB"`
+	}
+
+	// TrialSummary aggregates the completed runs of a trial group. Best
+	// and Convergence are only set for single-objective runs.
+	TrialSummary struct {
+		ID          string             `json:"id"`
+		Name        string             `json:"name"`
+		Type        string             `json:"type"`
+		Total       int                `json:"total"`
+		Finished    int                `json:"finished"`
+		Statuses    map[string]int     `json:"statuses"`
+		Runs        []TrialRun         `json:"runs"`
+		Best        *Statistics        `json:"best,omitempty"` // Best fitness of the completed runs.
+		Convergence []ConvergencePoint `json:"convergence,omitempty"`
+		CreatedAt   string             `json:"createdAt"`
+
+		bests []float64
+	}
+
+	TrialRun struct {
+		RunID  string    `json:"runID"`
+		Seed   int64     `json:"seed"`
+		Status string    `json:"status"`
+		Best   []float64 `json:"best,omitempty"`
+	}
+
+	// ConvergencePoint is the best fitness so far at a generation, across
+	// runs. Runs that stopped early keep their last value. Lower and Upper
+	// bound the 95% confidence interval of the mean.
+	ConvergencePoint struct {
+		Gen    int     `json:"gen"`
+		N      int     `json:"n"`
+		Mean   float64 `json:"mean"`
+		Lower  float64 `json:"lower"`
+		Upper  float64 `json:"upper"`
+		Median float64 `json:"median"`
+		Q1     float64 `json:"q1"`
+		Q3     float64 `json:"q3"`
+	}
+
+	// TrialComparison compares the best fitness of two trial groups.
+	TrialComparison struct {
+		GroupA string      `json:"groupA"`
+		GroupB string      `json:"groupB"`
+		BestA  Statistics  `json:"bestA"`
+		BestB  Statistics  `json:"bestB"`
+		Test   RankSumTest `json:"test"`
+	}
+)
+
+func TrialReqFromJSON(jsonData map[string]any) (*TrialReq, error) {
+	t := &TrialReq{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func TrialDataReqFromJSON(jsonData map[string]any) (*TrialDataReq, error) {
+	t := &TrialDataReq{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func TrialCompareReqFromJSON(jsonData map[string]any) (*TrialCompareReq, error) {
+	t := &TrialCompareReq{}
+	jsonDataBytes, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(jsonDataBytes, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Runs validates the trial group and returns its runs. Errors in the
+// config are reported under config.
+func (t *TrialReq) Runs() ([]*NewRun, error) {
+	v := &util.ValidationError{}
+	v.Length("name", len(t.Name), 0, 200)
+	v.OneOf("type", t.Type, GeneratorTypes())
+	v.Relation("config", t.Config != nil, "is required")
+	v.IntRange("trials", t.Trials, 1, maxTrials)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	t.seeds = trialSeeds(t.Config["seed"], t.Trials)
+	runs := make([]*NewRun, t.Trials)
+	for i, seed := range t.seeds {
+		config := maps.Clone(t.Config)
+		config["seed"] = seed
+		run, err := RunFromJSON(t.Type, config)
+		var verr *util.ValidationError
+		if errors.As(err, &verr) {
+			for _, f := range verr.Fields {
+				f.Field = "config." + f.Field
+				v.Add(f)
+			}
+			return nil, v.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs[i] = run
+	}
+	return runs, nil
+}
+
+// trialSeeds returns n distinct seeds, counting up from seed when it is a
+// number and drawn otherwise.
+func trialSeeds(seed any, n int) []int64 {
+	seeds := make([]int64, 0, n)
+	if first, ok := seed.(float64); ok {
+		for i := range n {
+			seeds = append(seeds, (int64(first)+int64(i))%(maxSeed+1))
+		}
+		return seeds
+	}
+
+	drawn := map[int64]bool{}
+	for len(seeds) < n {
+		s := rand.Int64N(maxSeed + 1)
+		if !drawn[s] {
+			drawn[s] = true
+			seeds = append(seeds, s)
+		}
+	}
+	return seeds
+}
+
+// Create inserts the trial group and creates its runs, which Runs
+// returned. The group and its runs are inserted in one transaction, and the
+// runs are only queued once it is committed. It returns the ID of the group
+// and of every run.
+func (t *TrialReq) Create(ctx context.Context, runs []*NewRun, userID string, check *CodeCheck, template *CodeTemplate, logger *util.LoggerService) (string, []string, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateTrials: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	config, err := json.Marshal(t.Config)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateTrials.json.Marshal: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateTrials.db.Begin: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+	defer tx.Rollback(ctx)
+
+	var groupID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO trial_group (name, type, config, trials, createdBy)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, t.Name, t.Type, config, t.Trials, userID).Scan(&groupID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CreateTrials.row.Scan: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	runIDs := make([]string, len(runs))
+	for i, run := range runs {
+		run.Description = fmt.Sprintf("%s, trial %d of %d in %s", run.Description, i+1, len(runs), groupID)
+		runID, err := run.insert(ctx, tx, userID, check, template, logger)
+		if err != nil {
+			return "", nil, err
+		}
+		runIDs[i] = runID
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO trial_run (groupID, runID, position, seed)
+			VALUES ($1, $2, $3, $4)
+		`, groupID, runID, i, t.seeds[i])
+		if err != nil {
+			logger.Error(fmt.Sprintf("CreateTrials.tx.Exec: %s", err.Error()), err)
+			return "", nil, fmt.Errorf("something went wrong")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Error(fmt.Sprintf("CreateTrials.tx.Commit: %s", err.Error()), err)
+		return "", nil, fmt.Errorf("something went wrong")
+	}
+
+	if err := queueRuns(ctx, db, runIDs, logger); err != nil {
+		return "", nil, err
+	}
+	return groupID, runIDs, nil
+}
+
+// Summary aggregates the results of the completed runs of the group.
+func (r *TrialDataReq) Summary(ctx context.Context, userID string, logger *util.LoggerService) (*TrialSummary, error) {
+	return trialSummary(ctx, r.GroupID, userID, logger)
+}
+
+// Compare tests whether the best fitness of two trial groups differs.
+func (r *TrialCompareReq) Compare(ctx context.Context, userID string, logger *util.LoggerService) (*TrialComparison, error) {
+	a, err := trialSummary(ctx, r.GroupA, userID, logger)
+	if err != nil {
+		return nil, err
+	}
+	b, err := trialSummary(ctx, r.GroupB, userID, logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.bests) == 0 || len(b.bests) == 0 {
+		return nil, fmt.Errorf("both groups need a completed single-objective run")
+	}
+
+	return &TrialComparison{
+		GroupA: r.GroupA,
+		GroupB: r.GroupB,
+		BestA:  *a.Best,
+		BestB:  *b.Best,
+		Test:   rankSum(a.bests, b.bests),
+	}, nil
+}
+
+func trialSummary(ctx context.Context, groupID string, userID string, logger *util.LoggerService) (*TrialSummary, error) {
+	db, err := connection.PoolConn(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("TrialSummary: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	s := &TrialSummary{ID: groupID, Statuses: map[string]int{}, Runs: []TrialRun{}}
+	var createdAt time.Time
+	err = db.QueryRow(ctx, "SELECT name, type, createdAt FROM trial_group WHERE id = $1 AND createdBy = $2", groupID, userID).Scan(&s.Name, &s.Type, &createdAt)
+	if err != nil {
+		logger.Error(fmt.Sprintf("TrialSummary.db.QueryRow: %s", err.Error()), err)
+		return nil, fmt.Errorf("trial group does not exist")
+	}
+	s.CreatedAt = createdAt.Local().String()
+
+	rows, err := db.Query(ctx, `
+		SELECT tr.runID, tr.seed, r.status
+		FROM trial_run tr JOIN run r ON r.id = tr.runID
+		WHERE tr.groupID = $1
+		ORDER BY tr.position
+	`, groupID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("TrialSummary.db.Query: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+	for rows.Next() {
+		var run TrialRun
+		if err := rows.Scan(&run.RunID, &run.Seed, &run.Status); err != nil {
+			logger.Error(fmt.Sprintf("TrialSummary.rows.Scan: %s", err.Error()), err)
+			return nil, fmt.Errorf("something went wrong")
+		}
+		s.Runs = append(s.Runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(fmt.Sprintf("TrialSummary.rows.Err: %s", err.Error()), err)
+		return nil, fmt.Errorf("something went wrong")
+	}
+
+	var curves [][]float64
+	for i := range s.Runs {
+		run := &s.Runs[i]
+		s.Total++
+		s.Statuses[run.Status]++
+		if run.Status == RunCompleted || run.Status == RunFailed {
+			s.Finished++
+		}
+		if run.Status != RunCompleted {
+			continue
+		}
+
+		results, err := ReadResults(ctx, run.RunID, logger)
+		if err != nil {
+			return nil, err
+		}
+		if results == nil {
+			continue
+		}
+		run.Best = results.Best
+		if len(results.Best) == 1 {
+			s.bests = append(s.bests, results.Best[0])
+			curves = append(curves, results.convergence())
+		}
+	}
+
+	if len(s.bests) > 0 {
+		best := describe(s.bests)
+		s.Best = &best
+		s.Convergence = convergence(curves)
+	}
+	return s, nil
+}
+
+// convergence returns the best fitness so far of every generation.
+func (r *Results) convergence() []float64 {
+	var curve []float64
+	for _, record := range r.Metrics {
+		gen, ok := record["gen"].(float64)
+		best, isNumber := record["best"].(float64)
+		if !ok || !isNumber || int(gen) < len(curve) {
+			continue
+		}
+		// Carry the last value over generations without a record.
+		for len(curve) < int(gen) {
+			curve = append(curve, curveLast(curve, best))
+		}
+		curve = append(curve, best)
+	}
+	return curve
+}
+
+func curveLast(curve []float64, fallback float64) float64 {
+	if len(curve) == 0 {
+		return fallback
+	}
+	return curve[len(curve)-1]
+}
+
+// convergence aggregates the curves of several runs by generation.
+func convergence(curves [][]float64) []ConvergencePoint {
+	length := 0
+	for _, curve := range curves {
+		length = max(length, len(curve))
+	}
+
+	points := make([]ConvergencePoint, 0, length)
+	for gen := range length {
+		var values []float64
+		for _, curve := range curves {
+			if len(curve) > 0 {
+				values = append(values, curve[min(gen, len(curve)-1)])
+			}
+		}
+		stats := describe(values)
+		lower, upper := confidenceInterval95(values)
+		points = append(points, ConvergencePoint{
+			Gen:    gen,
+			N:      stats.N,
+			Mean:   stats.Mean,
+			Lower:  lower,
+			Upper:  upper,
+			Median: stats.Median,
+			Q1:     stats.Q1,
+			Q3:     stats.Q3,
+		})
+	}
+	return points
+}
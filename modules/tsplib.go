@@ -0,0 +1,165 @@
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxCities bounds TSP instances; the distance matrix is stored in full.
+const maxCities = 2000
+
+// parseTSPLIB reads a symmetric TSP in TSPLIB format and returns its
+// distance matrix. Coordinates (EUC_2D, CEIL_2D, ATT, GEO) and explicit
+// weights (FULL_MATRIX and the triangular formats) are supported.
+func parseTSPLIB(text string) ([][]float64, error) {
+	spec := map[string]string{}
+	var numbers []float64
+	section := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line == "EOF":
+			continue
+		case strings.HasSuffix(line, "_SECTION"):
+			section = line
+			continue
+		case strings.Contains(line, ":"):
+			key, value, _ := strings.Cut(line, ":")
+			spec[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			section = ""
+			continue
+		}
+
+		if section != "NODE_COORD_SECTION" && section != "EDGE_WEIGHT_SECTION" {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			n, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid number %q", section, field)
+			}
+			numbers = append(numbers, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if t := spec["TYPE"]; t != "" && t != "TSP" {
+		return nil, fmt.Errorf("TYPE %s is not supported, only TSP", t)
+	}
+	dimension, err := strconv.Atoi(spec["DIMENSION"])
+	if err != nil || dimension < 2 || dimension > maxCities {
+		return nil, fmt.Errorf("DIMENSION must be between 2 and %d", maxCities)
+	}
+
+	if spec["EDGE_WEIGHT_TYPE"] == "EXPLICIT" {
+		return explicitMatrix(dimension, spec["EDGE_WEIGHT_FORMAT"], numbers)
+	}
+	return coordinateMatrix(dimension, spec["EDGE_WEIGHT_TYPE"], numbers)
+}
+
+// coordinateMatrix computes distances from NODE_COORD_SECTION lines of the
+// form "id x y", rounded as the TSPLIB specification requires.
+func coordinateMatrix(dimension int, weightType string, numbers []float64) ([][]float64, error) {
+	if len(numbers) != 3*dimension {
+		return nil, fmt.Errorf("NODE_COORD_SECTION must have %d nodes", dimension)
+	}
+
+	var distance func(a, b []float64) float64
+	switch weightType {
+	case "EUC_2D":
+		distance = func(a, b []float64) float64 {
+			return math.Round(math.Hypot(a[0]-b[0], a[1]-b[1]))
+		}
+	case "CEIL_2D":
+		distance = func(a, b []float64) float64 {
+			return math.Ceil(math.Hypot(a[0]-b[0], a[1]-b[1]))
+		}
+	case "ATT":
+		distance = func(a, b []float64) float64 {
+			r := math.Sqrt((math.Pow(a[0]-b[0], 2) + math.Pow(a[1]-b[1], 2)) / 10)
+			if t := math.Round(r); t < r {
+				return t + 1
+			}
+			return math.Round(r)
+		}
+	case "GEO":
+		radians := func(x float64) float64 {
+			deg := math.Trunc(x)
+			return math.Pi * (deg + 5*(x-deg)/3) / 180
+		}
+		distance = func(a, b []float64) float64 {
+			const earthRadius = 6378.388
+			q1 := math.Cos(radians(a[1]) - radians(b[1]))
+			q2 := math.Cos(radians(a[0]) - radians(b[0]))
+			q3 := math.Cos(radians(a[0]) + radians(b[0]))
+			return math.Trunc(earthRadius*math.Acos(0.5*((1+q1)*q2-(1-q1)*q3)) + 1)
+		}
+	default:
+		return nil, fmt.Errorf("EDGE_WEIGHT_TYPE %s is not supported", weightType)
+	}
+
+	coords := make([][]float64, dimension)
+	for i := range dimension {
+		coords[i] = numbers[3*i+1 : 3*i+3]
+	}
+	matrix := make([][]float64, dimension)
+	for i := range dimension {
+		matrix[i] = make([]float64, dimension)
+		for j := range dimension {
+			if i != j {
+				matrix[i][j] = distance(coords[i], coords[j])
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// explicitMatrix expands an EDGE_WEIGHT_SECTION into a full matrix.
+func explicitMatrix(dimension int, format string, numbers []float64) ([][]float64, error) {
+	// Each format lists, row by row, the columns from first(i) to last(i).
+	var first, last func(i int) int
+	switch format {
+	case "FULL_MATRIX":
+		first, last = func(int) int { return 0 }, func(int) int { return dimension - 1 }
+	case "UPPER_ROW":
+		first, last = func(i int) int { return i + 1 }, func(int) int { return dimension - 1 }
+	case "UPPER_DIAG_ROW":
+		first, last = func(i int) int { return i }, func(int) int { return dimension - 1 }
+	case "LOWER_ROW":
+		first, last = func(int) int { return 0 }, func(i int) int { return i - 1 }
+	case "LOWER_DIAG_ROW":
+		first, last = func(int) int { return 0 }, func(i int) int { return i }
+	default:
+		return nil, fmt.Errorf("EDGE_WEIGHT_FORMAT %s is not supported", format)
+	}
+
+	matrix := make([][]float64, dimension)
+	for i := range dimension {
+		matrix[i] = make([]float64, dimension)
+	}
+	k := 0
+	for i := range dimension {
+		for j := first(i); j <= last(i); j++ {
+			if k >= len(numbers) {
+				return nil, fmt.Errorf("EDGE_WEIGHT_SECTION is too short for %s", format)
+			}
+			matrix[i][j] = numbers[k]
+			if format != "FULL_MATRIX" {
+				matrix[j][i] = numbers[k]
+			}
+			k++
+		}
+	}
+	if k != len(numbers) {
+		return nil, fmt.Errorf("EDGE_WEIGHT_SECTION is too long for %s", format)
+	}
+	return matrix, nil
+}
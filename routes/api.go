@@ -11,8 +11,33 @@ const (
 	GP        = BASE + "/gp"
 	ML        = BASE + "/ml"
 	PSO       = BASE + "/pso"
+	OPERATORS = BASE + "/operators"
 	RUNS      = BASE + "/runs"
 	SHARE_RUN = RUNS + "/share"
 	RUN       = RUNS + "/run"
 	LOGS      = RUNS + "/logs"
+	RESUME    = RUNS + "/resume"
+	POLICY    = BASE + "/admin/policy"
+
+	TEMPLATES       = BASE + "/admin/templates"
+	ACTIVE_TEMPLATE = TEMPLATES + "/active"
+
+	EXPERIMENTS = BASE + "/experiments"
+	EXPERIMENT  = EXPERIMENTS + "/experiment"
+
+	TRIALS        = BASE + "/trials"
+	TRIAL_GROUP   = TRIALS + "/group"
+	TRIAL_COMPARE = TRIALS + "/compare"
+
+	EA_PREVIEW  = EA + "/preview"
+	GP_PREVIEW  = GP + "/preview"
+	ML_PREVIEW  = ML + "/preview"
+	PSO_PREVIEW = PSO + "/preview"
+
+	ALGORITHMS        = BASE + "/algorithms"
+	ALGORITHM         = ALGORITHMS + "/{type}"
+	ALGORITHM_PREVIEW = ALGORITHM + "/preview"
+
+	SCHEMAS = BASE + "/schemas"
+	SCHEMA  = SCHEMAS + "/{type}"
 )
@@ -5,22 +5,31 @@ import (
 	"fmt"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
 	"os"
 )
 
-func UploadFile(ctx context.Context, runID string, fileName string, extension string) error {
-	var logger = SharedLogger
+// bucketName holds a folder per run with its code, input and outputs.
+const bucketName = "code"
 
+func newMinioClient() (*minio.Client, error) {
 	endpoint := os.Getenv("MINIO_ENDPOINT")
 	accessKeyID := os.Getenv("MINIO_ACCESS_KEY_ID")
 	secretAccessKey := os.Getenv("MINIO_SECRET_KEY")
-	bucketName := "code"
 
-	// Initialize minio client object.
-	minioClient, err := minio.New(endpoint, &minio.Options{
+	return minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
 		Secure: false,
 	})
+}
+
+func UploadFile(ctx context.Context, runID string, fileName string, extension string) error {
+	var logger = SharedLogger
+
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+
+	// Initialize minio client object.
+	minioClient, err := newMinioClient()
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to create minio client: %v", err), err)
 		return err
@@ -64,3 +73,63 @@ func UploadFile(ctx context.Context, runID string, fileName string, extension st
 
 	return nil
 }
+
+// CopyFile copies fileName from the folder of one run to another. It reports
+// false, without an error, when the source does not exist.
+func CopyFile(ctx context.Context, fromRunID string, toRunID string, fileName string) (bool, error) {
+	var logger = SharedLogger
+
+	minioClient, err := newMinioClient()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to create minio client: %v", err), err)
+		return false, err
+	}
+
+	src := minio.CopySrcOptions{Bucket: bucketName, Object: fmt.Sprintf("%s/%s", fromRunID, fileName)}
+	if _, err := minioClient.StatObject(ctx, src.Bucket, src.Object, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		logger.Error(fmt.Sprintf("Failed to stat %s: %v", src.Object, err), err)
+		return false, err
+	}
+
+	dst := minio.CopyDestOptions{Bucket: bucketName, Object: fmt.Sprintf("%s/%s", toRunID, fileName)}
+	if _, err := minioClient.CopyObject(ctx, dst, src); err != nil {
+		logger.Error(fmt.Sprintf("Failed to copy %s to %s: %v", src.Object, dst.Object, err), err)
+		return false, err
+	}
+
+	logger.Info(fmt.Sprintf("Successfully copied %s to %s", src.Object, dst.Object))
+	return true, nil
+}
+
+// ReadFile returns fileName from the folder of a run. It reports false,
+// without an error, when the file does not exist.
+func ReadFile(ctx context.Context, runID string, fileName string) ([]byte, bool, error) {
+	var logger = SharedLogger
+
+	minioClient, err := newMinioClient()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to create minio client: %v", err), err)
+		return nil, false, err
+	}
+
+	objectName := fmt.Sprintf("%s/%s", runID, fileName)
+	object, err := minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get %s: %v", objectName, err), err)
+		return nil, false, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, false, nil
+		}
+		logger.Error(fmt.Sprintf("Failed to read %s: %v", objectName, err), err)
+		return nil, false, err
+	}
+	return data, true, nil
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -24,3 +25,14 @@ func JSONResponse(w http.ResponseWriter, code int, message string, data any) {
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(response)
 }
+
+// ValidationResponse writes err as a 422 listing every invalid field when it
+// is a *ValidationError, and as a plain 400 otherwise.
+func ValidationResponse(w http.ResponseWriter, err error) {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		JSONResponse(w, http.StatusUnprocessableEntity, verr.Error(), verr)
+		return
+	}
+	JSONResponse(w, http.StatusBadRequest, err.Error(), nil)
+}
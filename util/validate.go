@@ -3,11 +3,133 @@ package util
 import (
 	"fmt"
 	"slices"
+	"strings"
 )
 
+// AlgorithmNames lists the evolutionary algorithms the generators support.
+var AlgorithmNames = []string{"eaSimple", "eaMuPlusLambda", "eaMuCommaLambda", "eaGenerateUpdate", "de"}
+
 func ValidateAlgorithmName(algo string) error {
-	if slices.Contains([]string{"eaSimple", "eaMuPlusLambda", "eaMuCommaLambda", "eaGenerateUpdate", "de"}, algo) {
+	if slices.Contains(AlgorithmNames, algo) {
 		return nil
 	}
 	return fmt.Errorf("invalid algorithm name: %s", algo)
 }
+
+// Rules reported in a FieldError.
+const (
+	RuleRequired   = "required"
+	RuleRange      = "range"
+	RuleOneOf      = "oneOf"
+	RuleLength     = "length"
+	RuleRelation   = "relation"
+	RulePolicy     = "policy"     // Python code the code policy does not allow.
+	RuleIdentifier = "identifier" // Names that become Python identifiers.
+	RuleType       = "type"       // Values of the wrong JSON type.
+)
+
+// FieldError describes a single invalid field in a request body.
+// Field is the JSON path of the field, e.g. "weights[0]" or "mu".
+type FieldError struct {
+	Field   string   `json:"field"`
+	Rule    string   `json:"rule"`
+	Message string   `json:"message"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Options []string `json:"options,omitempty"`
+	Line    int      `json:"line,omitempty"`   // Location in a code field, 1-based.
+	Column  int      `json:"column,omitempty"` // Location in a code field, 1-based.
+}
+
+// ValidationError collects every FieldError found while validating
+// a config, so the client can highlight all bad fields at once.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Err returns nil if no field errors were recorded.
+func (v *ValidationError) Err() error {
+	if len(v.Fields) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *ValidationError) Add(fe FieldError) {
+	v.Fields = append(v.Fields, fe)
+}
+
+// Required records an error if the string is empty.
+func (v *ValidationError) Required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(FieldError{Field: field, Rule: RuleRequired, Message: "is required"})
+		return false
+	}
+	return true
+}
+
+// IntRange records an error if value is outside [min, max].
+func (v *ValidationError) IntRange(field string, value int, min int, max int) bool {
+	return v.FloatRange(field, float64(value), float64(min), float64(max))
+}
+
+// FloatRange records an error if value is outside [min, max].
+func (v *ValidationError) FloatRange(field string, value float64, min float64, max float64) bool {
+	if value >= min && value <= max {
+		return true
+	}
+	v.Add(FieldError{
+		Field:   field,
+		Rule:    RuleRange,
+		Message: fmt.Sprintf("must be between %v and %v, got %v", min, max, value),
+		Min:     &min,
+		Max:     &max,
+	})
+	return false
+}
+
+// OneOf records an error if value is not one of options.
+func (v *ValidationError) OneOf(field string, value string, options []string) bool {
+	if slices.Contains(options, value) {
+		return true
+	}
+	v.Add(FieldError{
+		Field:   field,
+		Rule:    RuleOneOf,
+		Message: fmt.Sprintf("must be one of %s, got %q", strings.Join(options, ", "), value),
+		Options: options,
+	})
+	return false
+}
+
+// Length records an error if the length n is outside [min, max].
+func (v *ValidationError) Length(field string, n int, min int, max int) bool {
+	if n >= min && n <= max {
+		return true
+	}
+	fmin, fmax := float64(min), float64(max)
+	v.Add(FieldError{
+		Field:   field,
+		Rule:    RuleLength,
+		Message: fmt.Sprintf("must have between %d and %d entries, got %d", min, max, n),
+		Min:     &fmin,
+		Max:     &fmax,
+	})
+	return false
+}
+
+// Relation records a cross-field error, e.g. "mu must be <= lambda_".
+func (v *ValidationError) Relation(field string, ok bool, message string) bool {
+	if !ok {
+		v.Add(FieldError{Field: field, Rule: RuleRelation, Message: message})
+	}
+	return ok
+}